@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/devkarim/goredis/resp"
+	"github.com/devkarim/goredis/storage"
+)
+
+// checkAof implements "goredis check-aof [-fix] <file>", which validates an
+// AOF offline and with -fix truncates it to its last complete command. The
+// file may be a manifest, in which case every file it lists is checked and
+// only the last one can be fixed. It returns the exit code of the process.
+//
+// With -truncate-to-timestamp or -truncate-to-offset it instead drops the
+// commands written after a point in time, or past an offset of the last
+// file, to recover the keyspace as it was then. Encrypted files are read
+// with the key given by -key-file.
+func checkAof(args []string) int {
+	fs := flag.NewFlagSet("check-aof", flag.ContinueOnError)
+	fix := fs.Bool("fix", false, "Truncate the file to its last complete command")
+	var limit storage.AofLimit
+	fs.Int64Var(&limit.Timestamp, "truncate-to-timestamp", 0, "Truncate the AOF to the commands written up to this unix time, see aof-timestamp-enabled")
+	fs.Int64Var(&limit.Offset, "truncate-to-offset", 0, "Truncate the last file to the commands ending up to this offset, of the plaintext of an encrypted file")
+	keyFile := fs.String("key-file", "", "File holding the key the AOF is encrypted with")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: goredis check-aof [-key-file <path>] [-fix | -truncate-to-timestamp <unix> | -truncate-to-offset <bytes>] <file or manifest>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if limit.Timestamp < 0 || limit.Offset < 0 {
+		fmt.Fprintln(os.Stderr, "The timestamp and offset must be positive")
+		return 2
+	}
+
+	var cipher *storage.Cipher
+	if *keyFile != "" {
+		var err error
+		if cipher, err = storage.LoadCipher(*keyFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	paths := []string{fs.Arg(0)}
+	if strings.HasSuffix(fs.Arg(0), ".manifest") {
+		var err error
+		if paths, err = storage.AofFiles(fs.Arg(0)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if limit != (storage.AofLimit{}) {
+		return truncateAof(paths, cipher, limit)
+	}
+
+	for i, path := range paths {
+		count, err := checkAofFile(path, cipher)
+		unit := "commands"
+		if filepath.Ext(path) == ".rdb" {
+			unit = "keys"
+		}
+		if err == nil {
+			fmt.Printf("%s is valid: %d %s\n", filepath.Base(path), count, unit)
+			continue
+		}
+
+		fmt.Println(err)
+		var aofErr *storage.AofError
+		if !errors.As(err, &aofErr) || i < len(paths)-1 {
+			return 1
+		}
+		if !*fix {
+			fmt.Println("Run with -fix to truncate it to its last complete command.")
+			return 1
+		}
+
+		fmt.Printf("Truncating from %d to %d bytes, %d bytes are lost\n", aofErr.Size, aofErr.Valid, aofErr.Size-aofErr.Valid)
+		if err := os.Truncate(path, aofErr.Valid); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("%s is valid: %d %s\n", filepath.Base(path), count, unit)
+	}
+
+	return 0
+}
+
+// checkAofFile reads the file at path, returning how many commands or keys
+// it holds before the first error.
+func checkAofFile(path string, cipher *storage.Cipher) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	count := 0
+	if filepath.Ext(path) == ".rdb" {
+		info, err := file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		err = storage.ReadRdbFile(file, info.Size(), cipher, func(string, *storage.RedisObject, int64) { count++ })
+		return count, fileError(path, err)
+	}
+
+	_, err = storage.ReadAofFile(file, cipher, storage.AofLimit{}, func(resp.Value) { count++ })
+	return count, fileError(path, err)
+}
+
+// fileError names the file at path in err.
+func fileError(path string, err error) error {
+	var aofErr *storage.AofError
+	if errors.As(err, &aofErr) {
+		aofErr.File = filepath.Base(path)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// truncateAof truncates the AOF made of paths at limit. Only the last file
+// can be truncated: a limit falling in an earlier one is older than the
+// last rewrite, which left no trace of the commands made before it.
+func truncateAof(paths []string, cipher *storage.Cipher, limit storage.AofLimit) int {
+	for i, path := range paths {
+		last := i == len(paths)-1
+		if filepath.Ext(path) == ".rdb" || (!last && limit.Offset > 0) {
+			continue
+		}
+
+		size, valid, err := readAofUntil(path, cipher, limit)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		if valid == size {
+			if last {
+				fmt.Printf("%s has no commands past the limit\n", filepath.Base(path))
+			}
+			continue
+		}
+		if !last {
+			fmt.Printf("%s has commands past the limit, which is older than the last rewrite\n", filepath.Base(path))
+			return 1
+		}
+
+		fmt.Printf("Truncating %s from %d to %d bytes, %d bytes are dropped\n", filepath.Base(path), size, valid, size-valid)
+		if err := os.Truncate(path, valid); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// readAofUntil reads the AOF file at path up to limit, returning its size
+// and the offset reading stopped at.
+func readAofUntil(path string, cipher *storage.Cipher, limit storage.AofLimit) (int64, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	valid, err := storage.ReadAofFile(file, cipher, limit, func(resp.Value) {})
+	return info.Size(), valid, fileError(path, err)
+}
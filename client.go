@@ -0,0 +1,199 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/devkarim/goredis/core"
+	"github.com/devkarim/goredis/pubsub"
+	"github.com/devkarim/goredis/resp"
+)
+
+var nextClientID atomic.Int64
+
+// client is the state of a single connection. Replies and pub/sub messages
+// are appended to an output buffer written by a dedicated goroutine, so
+// publishers never block on a slow connection. Replies are only handed to
+// that goroutine once the client has no more pipelined commands pending, so
+// a pipeline is answered with as few writes as possible.
+type client struct {
+	conn   net.Conn
+	reader *resp.Reader
+	sub    *pubsub.Subscription
+	limit  core.OutputBufferLimit
+	quit   bool // set by QUIT to end the connection after its reply
+	id     int64
+	name   string // set by HELLO SETNAME
+
+	multi    bool              // inside MULTI, commands are queued until EXEC
+	multiErr bool              // a command could not be queued, EXEC aborts
+	queued   []resp.Value      // commands of the current transaction
+	watched  map[string]uint64 // versions of the keys passed to WATCH
+
+	mu        sync.Mutex
+	proto     int // protocol version replies are marshaled for, set by HELLO
+	cond      *sync.Cond
+	out       []byte    // output not handed to the write loop yet
+	ready     bool      // out should be written without waiting for more
+	softSince time.Time // when out first went over the soft limit
+	closed    bool
+	done      chan struct{}
+}
+
+func newClient(conn net.Conn, limit core.OutputBufferLimit) *client {
+	c := &client{
+		conn:   conn,
+		reader: resp.NewReader(conn),
+		id:     nextClientID.Add(1),
+		limit:  limit,
+		proto:  resp.RESP2,
+		done:   make(chan struct{}),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	c.sub = pubsub.NewSubscription(c)
+
+	go c.writeLoop()
+
+	return c
+}
+
+// Send buffers a reply to a command sent by the client itself, it is written
+// on the next flush.
+func (c *client) Send(v resp.Value) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.enqueue(v)
+}
+
+// flush hands the buffered replies to the write loop.
+func (c *client) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ready = true
+	c.cond.Signal()
+}
+
+// Push queues a pub/sub message, disconnecting the client when it does not
+// read them fast enough to stay within its output buffer limits.
+func (c *client) Push(v resp.Value) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	c.enqueue(v)
+	c.ready = true
+	c.cond.Signal()
+
+	if c.overLimit() {
+		slog.Warn("Closing client that exceeded its output buffer limit",
+			"remoteAddr", c.conn.RemoteAddr().String(), "queuedBytes", len(c.out))
+		c.out = nil
+		c.closed = true
+		c.cond.Broadcast()
+		c.conn.Close()
+	}
+}
+
+// setProto switches the protocol version of the replies that follow.
+func (c *client) setProto(proto int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.proto = proto
+}
+
+// resp3 reports whether the client negotiated RESP3.
+func (c *client) resp3() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.proto >= resp.RESP3
+}
+
+// enqueue must be called with c.mu held.
+func (c *client) enqueue(v resp.Value) {
+	if c.closed {
+		return
+	}
+
+	c.out = v.Append(c.out, c.proto)
+}
+
+// overLimit must be called with c.mu held.
+func (c *client) overLimit() bool {
+	if c.limit.Hard > 0 && len(c.out) >= c.limit.Hard {
+		return true
+	}
+
+	if c.limit.Soft == 0 || len(c.out) < c.limit.Soft {
+		c.softSince = time.Time{}
+		return false
+	}
+	if c.softSince.IsZero() {
+		c.softSince = time.Now()
+		return false
+	}
+
+	return time.Since(c.softSince) >= time.Duration(c.limit.SoftSeconds)*time.Second
+}
+
+// maxReusedBuffer bounds the output buffers kept between writes, so a
+// single large reply does not pin its memory for the life of the connection.
+const maxReusedBuffer = 64 * 1024
+
+// writeLoop writes the output buffer whenever it is flushed. It swaps it
+// with the buffer written last time, so steady traffic does not allocate.
+func (c *client) writeLoop() {
+	defer close(c.done)
+
+	var batch []byte
+	for {
+		c.mu.Lock()
+		for !c.ready && !c.closed {
+			c.cond.Wait()
+		}
+		c.ready = false
+		if len(c.out) == 0 {
+			closed := c.closed
+			c.mu.Unlock()
+			if closed {
+				return
+			}
+			continue
+		}
+
+		if cap(batch) > maxReusedBuffer {
+			batch = nil
+		}
+		batch, c.out = c.out, batch[:0]
+		c.mu.Unlock()
+
+		if _, err := c.conn.Write(batch); err != nil {
+			slog.Debug("Error while writing to connection", "error", err)
+			c.close()
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+// close stops accepting output, the replies already queued are still written.
+func (c *client) close() {
+	c.mu.Lock()
+	c.closed = true
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+// wait blocks until the queued replies have been written.
+func (c *client) wait() {
+	<-c.done
+}
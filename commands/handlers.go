@@ -1,22 +1,196 @@
 package commands
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/devkarim/goredis/resp"
 	"github.com/devkarim/goredis/storage"
 )
 
 type Command struct {
 	Handler func([]resp.Value) resp.Value
+	// Arity is the number of arguments including the command name, or its
+	// negation for commands taking at least that many.
+	Arity   int
 	IsWrite bool
+	// Keys returns the keys the command operates on, nil for commands that
+	// do not touch the keyspace.
+	Keys func(args []resp.Value) []string
+	// AllShards is set for commands that act on the whole keyspace, such as
+	// FLUSHALL, rather than on the keys returned by Keys.
+	AllShards bool
+	// Propagate returns the commands written to the AOF in place of the
+	// received one, for commands whose effect depends on when or how they ran.
+	Propagate func(args []resp.Value, response resp.Value) []resp.Value
+	// Apply runs the command like Handler and also returns the commands
+	// written to the AOF, for commands that log a value they computed while
+	// running, such as the deadline SET applied. It takes precedence over
+	// Handler and Propagate when set.
+	Apply func(args []resp.Value) (resp.Value, []resp.Value)
 }
 
 var Registry = map[string]Command{
-	"PING":    {Handler: ping, IsWrite: false},
-	"SET":     {Handler: set, IsWrite: true},
-	"GET":     {Handler: get, IsWrite: false},
-	"HSET":    {Handler: hset, IsWrite: true},
-	"HGET":    {Handler: hget, IsWrite: false},
-	"HGETALL": {Handler: hgetall, IsWrite: false},
+	"PING":             {Handler: ping, Arity: -1, IsWrite: false},
+	"SET":              {Handler: set, Arity: -3, Apply: applySet, IsWrite: true, Keys: firstKey},
+	"GET":              {Handler: get, Arity: 2, IsWrite: false, Keys: firstKey},
+	"APPEND":           {Handler: appendCommand, Arity: 3, IsWrite: true, Keys: firstKey},
+	"STRLEN":           {Handler: strlen, Arity: 2, IsWrite: false, Keys: firstKey},
+	"GETRANGE":         {Handler: getrange, Arity: 4, IsWrite: false, Keys: firstKey},
+	"SETRANGE":         {Handler: setrange, Arity: 4, IsWrite: true, Keys: firstKey},
+	"GETSET":           {Handler: getset, Arity: 3, IsWrite: true, Keys: firstKey},
+	"GETDEL":           {Handler: getdel, Arity: 2, IsWrite: true, Keys: firstKey},
+	"GETEX":            {Handler: getex, Arity: -2, Apply: applyGetEx, IsWrite: true, Keys: firstKey},
+	"SETNX":            {Handler: setnx, Arity: 3, IsWrite: true, Keys: firstKey},
+	"MSET":             {Handler: mset, Arity: -3, IsWrite: true, Keys: everyOtherKey},
+	"MSETNX":           {Handler: msetnx, Arity: -3, IsWrite: true, Keys: everyOtherKey},
+	"MGET":             {Handler: mget, Arity: -2, IsWrite: false, Keys: allKeys},
+	"INCR":             {Handler: incr, Arity: 2, IsWrite: true, Keys: firstKey},
+	"DECR":             {Handler: decr, Arity: 2, IsWrite: true, Keys: firstKey},
+	"INCRBY":           {Handler: incrby, Arity: 3, IsWrite: true, Keys: firstKey},
+	"DECRBY":           {Handler: decrby, Arity: 3, IsWrite: true, Keys: firstKey},
+	"INCRBYFLOAT":      {Handler: incrbyfloat, Arity: 3, IsWrite: true, Propagate: propagateIncrByFloat, Keys: firstKey},
+	"HSET":             {Handler: hset, Arity: -4, IsWrite: true, Keys: firstKey},
+	"HGET":             {Handler: hget, Arity: 3, IsWrite: false, Keys: firstKey},
+	"HGETALL":          {Handler: hgetall, Arity: 2, IsWrite: false, Keys: firstKey},
+	"HSETNX":           {Handler: hsetnx, Arity: 4, IsWrite: true, Keys: firstKey},
+	"HDEL":             {Handler: hdel, Arity: -3, IsWrite: true, Keys: firstKey},
+	"HEXISTS":          {Handler: hexists, Arity: 3, IsWrite: false, Keys: firstKey},
+	"HLEN":             {Handler: hlen, Arity: 2, IsWrite: false, Keys: firstKey},
+	"HSTRLEN":          {Handler: hstrlen, Arity: 3, IsWrite: false, Keys: firstKey},
+	"HKEYS":            {Handler: hkeys, Arity: 2, IsWrite: false, Keys: firstKey},
+	"HVALS":            {Handler: hvals, Arity: 2, IsWrite: false, Keys: firstKey},
+	"HMGET":            {Handler: hmget, Arity: -3, IsWrite: false, Keys: firstKey},
+	"HRANDFIELD":       {Handler: hrandfield, Arity: -2, IsWrite: false, Keys: firstKey},
+	"HEXPIRE":          {Handler: hexpire, Arity: -6, Apply: applyHExpire("hexpire", time.Second, false), IsWrite: true, Keys: firstKey},
+	"HPEXPIRE":         {Handler: hpexpire, Arity: -6, Apply: applyHExpire("hpexpire", time.Millisecond, false), IsWrite: true, Keys: firstKey},
+	"HEXPIREAT":        {Handler: hexpireat, Arity: -6, Apply: applyHExpire("hexpireat", time.Second, true), IsWrite: true, Keys: firstKey},
+	"HPEXPIREAT":       {Handler: hpexpireat, Arity: -6, Apply: applyHExpire("hpexpireat", time.Millisecond, true), IsWrite: true, Keys: firstKey},
+	"HTTL":             {Handler: httl, Arity: -5, IsWrite: false, Keys: firstKey},
+	"HPTTL":            {Handler: hpttl, Arity: -5, IsWrite: false, Keys: firstKey},
+	"HPERSIST":         {Handler: hpersist, Arity: -5, IsWrite: true, Keys: firstKey},
+	"HINCRBY":          {Handler: hincrby, Arity: 4, IsWrite: true, Keys: firstKey},
+	"HINCRBYFLOAT":     {Handler: hincrbyfloat, Arity: 4, IsWrite: true, Propagate: propagateHIncrByFloat, Keys: firstKey},
+	"EXPIRE":           {Handler: expire, Arity: -3, Apply: applyExpire("expire", time.Second, false), IsWrite: true, Keys: firstKey},
+	"PEXPIRE":          {Handler: pexpire, Arity: -3, Apply: applyExpire("pexpire", time.Millisecond, false), IsWrite: true, Keys: firstKey},
+	"EXPIREAT":         {Handler: expireat, Arity: -3, Apply: applyExpire("expireat", time.Second, true), IsWrite: true, Keys: firstKey},
+	"PEXPIREAT":        {Handler: pexpireat, Arity: -3, Apply: applyExpire("pexpireat", time.Millisecond, true), IsWrite: true, Keys: firstKey},
+	"TTL":              {Handler: ttl, Arity: 2, IsWrite: false, Keys: firstKey},
+	"PTTL":             {Handler: pttl, Arity: 2, IsWrite: false, Keys: firstKey},
+	"PERSIST":          {Handler: persist, Arity: 2, IsWrite: true, Keys: firstKey},
+	"LPUSH":            {Handler: lpush, Arity: -3, IsWrite: true, Keys: firstKey},
+	"RPUSH":            {Handler: rpush, Arity: -3, IsWrite: true, Keys: firstKey},
+	"LPUSHX":           {Handler: lpushx, Arity: -3, IsWrite: true, Keys: firstKey},
+	"RPUSHX":           {Handler: rpushx, Arity: -3, IsWrite: true, Keys: firstKey},
+	"LPOP":             {Handler: lpop, Arity: -2, IsWrite: true, Keys: firstKey},
+	"RPOP":             {Handler: rpop, Arity: -2, IsWrite: true, Keys: firstKey},
+	"LRANGE":           {Handler: lrange, Arity: 4, IsWrite: false, Keys: firstKey},
+	"LLEN":             {Handler: llen, Arity: 2, IsWrite: false, Keys: firstKey},
+	"LINDEX":           {Handler: lindex, Arity: 3, IsWrite: false, Keys: firstKey},
+	"LSET":             {Handler: lset, Arity: 4, IsWrite: true, Keys: firstKey},
+	"LREM":             {Handler: lrem, Arity: 4, IsWrite: true, Keys: firstKey},
+	"LTRIM":            {Handler: ltrim, Arity: 4, IsWrite: true, Keys: firstKey},
+	"LINSERT":          {Handler: linsert, Arity: 5, IsWrite: true, Keys: firstKey},
+	"LMOVE":            {Handler: lmove, Arity: 5, IsWrite: true, Keys: firstTwoKeys},
+	"SADD":             {Handler: sadd, Arity: -3, IsWrite: true, Keys: firstKey},
+	"SREM":             {Handler: srem, Arity: -3, IsWrite: true, Keys: firstKey},
+	"SMEMBERS":         {Handler: smembers, Arity: 2, IsWrite: false, Keys: firstKey},
+	"SISMEMBER":        {Handler: sismember, Arity: 3, IsWrite: false, Keys: firstKey},
+	"SMISMEMBER":       {Handler: smismember, Arity: -3, IsWrite: false, Keys: firstKey},
+	"SCARD":            {Handler: scard, Arity: 2, IsWrite: false, Keys: firstKey},
+	"SPOP":             {Handler: spop, Arity: -2, IsWrite: true, Propagate: propagateSpop, Keys: firstKey},
+	"SRANDMEMBER":      {Handler: srandmember, Arity: -2, IsWrite: false, Keys: firstKey},
+	"SMOVE":            {Handler: smove, Arity: 4, IsWrite: true, Keys: firstTwoKeys},
+	"SINTER":           {Handler: sinter, Arity: -2, IsWrite: false, Keys: allKeys},
+	"SUNION":           {Handler: sunion, Arity: -2, IsWrite: false, Keys: allKeys},
+	"SDIFF":            {Handler: sdiff, Arity: -2, IsWrite: false, Keys: allKeys},
+	"SINTERSTORE":      {Handler: sinterstore, Arity: -3, IsWrite: true, Keys: allKeys},
+	"SUNIONSTORE":      {Handler: sunionstore, Arity: -3, IsWrite: true, Keys: allKeys},
+	"SDIFFSTORE":       {Handler: sdiffstore, Arity: -3, IsWrite: true, Keys: allKeys},
+	"ZADD":             {Handler: zadd, Arity: -4, IsWrite: true, Keys: firstKey},
+	"ZINCRBY":          {Handler: zincrby, Arity: 4, IsWrite: true, Keys: firstKey},
+	"ZREM":             {Handler: zrem, Arity: -3, IsWrite: true, Keys: firstKey},
+	"ZSCORE":           {Handler: zscore, Arity: 3, IsWrite: false, Keys: firstKey},
+	"ZCARD":            {Handler: zcard, Arity: 2, IsWrite: false, Keys: firstKey},
+	"ZRANK":            {Handler: zrank, Arity: -3, IsWrite: false, Keys: firstKey},
+	"ZREVRANK":         {Handler: zrevrank, Arity: -3, IsWrite: false, Keys: firstKey},
+	"ZCOUNT":           {Handler: zcount, Arity: 4, IsWrite: false, Keys: firstKey},
+	"ZRANGE":           {Handler: zrange, Arity: -4, IsWrite: false, Keys: firstKey},
+	"ZREVRANGE":        {Handler: zrevrange, Arity: -4, IsWrite: false, Keys: firstKey},
+	"ZRANGEBYSCORE":    {Handler: zrangebyscore, Arity: -4, IsWrite: false, Keys: firstKey},
+	"ZREVRANGEBYSCORE": {Handler: zrevrangebyscore, Arity: -4, IsWrite: false, Keys: firstKey},
+	"ZPOPMIN":          {Handler: zpopmin, Arity: -2, IsWrite: true, Keys: firstKey},
+	"ZPOPMAX":          {Handler: zpopmax, Arity: -2, IsWrite: true, Keys: firstKey},
+	"DEL":              {Handler: del, Arity: -2, IsWrite: true, Keys: allKeys},
+	"UNLINK":           {Handler: unlink, Arity: -2, IsWrite: true, Keys: allKeys},
+	"EXISTS":           {Handler: exists, Arity: -2, IsWrite: false, Keys: allKeys},
+	"TYPE":             {Handler: typeCommand, Arity: 2, IsWrite: false, Keys: firstKey},
+	"RENAME":           {Handler: rename, Arity: 3, IsWrite: true, Keys: firstTwoKeys},
+	"RENAMENX":         {Handler: renamenx, Arity: 3, IsWrite: true, Keys: firstTwoKeys},
+	"COPY":             {Handler: copyCommand, Arity: -3, IsWrite: true, Keys: firstTwoKeys},
+	"RANDOMKEY":        {Handler: randomkey, Arity: 1, IsWrite: false, AllShards: true},
+	"DBSIZE":           {Handler: dbsize, Arity: 1, IsWrite: false, AllShards: true},
+	"FLUSHDB":          {Handler: flushdb, Arity: -1, IsWrite: true, AllShards: true},
+	"FLUSHALL":         {Handler: flushall, Arity: -1, IsWrite: true, AllShards: true},
+	"SCAN":             {Handler: scan, Arity: -2, IsWrite: false, AllShards: true},
+	"KEYS":             {Handler: keys, Arity: 2, IsWrite: false, AllShards: true},
+	"HSCAN":            {Handler: hscan, Arity: -3, IsWrite: false, Keys: firstKey},
+	"SSCAN":            {Handler: sscan, Arity: -3, IsWrite: false, Keys: firstKey},
+	"ZSCAN":            {Handler: zscan, Arity: -3, IsWrite: false, Keys: firstKey},
+	"PUBLISH":          {Handler: publish, Arity: 3, IsWrite: false},
+	"PUBSUB":           {Handler: pubsubCommand, Arity: -2, IsWrite: false},
+}
+
+// ValidArity reports whether argc arguments, counting the command name, fit
+// the arity of the command.
+func (c Command) ValidArity(argc int) bool {
+	if c.Arity < 0 {
+		return argc >= -c.Arity
+	}
+	return argc == c.Arity
+}
+
+// NewCommand builds a command value the same way a client would send it.
+func NewCommand(name string, args ...string) resp.Value {
+	arr := make([]resp.Value, len(args)+1)
+	arr[0] = resp.Value{Type: resp.RespBulk, Str: name}
+	for i, arg := range args {
+		arr[i+1] = resp.Value{Type: resp.RespBulk, Str: arg}
+	}
+
+	return resp.Value{Type: resp.RespArray, Array: arr}
+}
+
+func firstKey(args []resp.Value) []string {
+	if len(args) < 1 {
+		return nil
+	}
+	return []string{args[0].Str}
+}
+
+func firstTwoKeys(args []resp.Value) []string {
+	if len(args) < 2 {
+		return firstKey(args)
+	}
+	return []string{args[0].Str, args[1].Str}
+}
+
+func allKeys(args []resp.Value) []string {
+	return argStrings(args)
+}
+
+// everyOtherKey returns the keys of key value [key value ...] arguments.
+func everyOtherKey(args []resp.Value) []string {
+	keys := make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, args[i].Str)
+	}
+	return keys
+}
+
+func wrongArgs(name string) resp.Value {
+	return resp.Value{Type: resp.RespError, Str: "ERR wrong number of arguments for '" + name + "' command"}
 }
 
 func ping(args []resp.Value) resp.Value {
@@ -27,22 +201,116 @@ func ping(args []resp.Value) resp.Value {
 	return resp.Value{Type: resp.RespString, Str: "PONG"}
 }
 
+// SET key value [NX | XX] [GET] [EX seconds | PX milliseconds |
+// EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
 func set(args []resp.Value) resp.Value {
-	if len(args) != 2 {
-		return resp.Value{Type: resp.RespError, Str: "ERR wrong number of arguments for 'set' command"}
+	response, _ := applySet(args)
+	return response
+}
+
+// applySet runs SET and returns it as logged to the AOF: with the absolute
+// PXAT deadline it applied and without the NX/XX/GET options, nothing when
+// the value was not set.
+func applySet(args []resp.Value) (resp.Value, []resp.Value) {
+	if len(args) < 2 {
+		return wrongArgs("set"), nil
 	}
 
 	key := args[0].Str
 	val := args[1].Str
 
+	opts, get, errVal, ok := parseSetOptions(args[2:])
+	if !ok {
+		return errVal, nil
+	}
+
 	shard := storage.GetShard(key)
-	err := shard.SetString(key, val)
+	result, err := shard.Set(key, val, opts)
 
 	if err != nil {
-		return resp.Value{Type: resp.RespError, Str: err.Error()}
+		return resp.Value{Type: resp.RespError, Str: err.Error()}, nil
 	}
 
-	return resp.Value{Type: resp.RespString, Str: "OK"}
+	var propagated []resp.Value
+	if result.Applied {
+		cmd := NewCommand("SET", key, val)
+		if opts.ExpireAt > 0 {
+			cmd.Array = append(cmd.Array,
+				resp.Value{Type: resp.RespBulk, Str: "PXAT"},
+				resp.Value{Type: resp.RespBulk, Str: strconv.FormatInt(opts.ExpireAt, 10)},
+			)
+		} else if opts.KeepTTL {
+			cmd.Array = append(cmd.Array, resp.Value{Type: resp.RespBulk, Str: "KEEPTTL"})
+		}
+		propagated = []resp.Value{cmd}
+	}
+
+	if get {
+		if !result.OldFound {
+			return resp.Value{Type: resp.RespNil}, propagated
+		}
+		return resp.Value{Type: resp.RespBulk, Str: result.Old}, propagated
+	}
+
+	if !result.Applied {
+		return resp.Value{Type: resp.RespNil}, nil
+	}
+
+	return resp.Value{Type: resp.RespString, Str: "OK"}, propagated
+}
+
+func parseSetOptions(args []resp.Value) (storage.SetOptions, bool, resp.Value, bool) {
+	var opts storage.SetOptions
+	get := false
+	hasExpire := false
+	syntaxErr := resp.Value{Type: resp.RespError, Str: "ERR syntax error"}
+
+	for i := 0; i < len(args); i++ {
+		opt := strings.ToUpper(args[i].Str)
+		switch opt {
+		case "NX", "XX":
+			if opts.Condition != storage.SetAlways {
+				return opts, false, syntaxErr, false
+			}
+			opts.Condition = storage.SetNX
+			if opt == "XX" {
+				opts.Condition = storage.SetXX
+			}
+		case "GET":
+			get = true
+		case "KEEPTTL":
+			if hasExpire {
+				return opts, false, syntaxErr, false
+			}
+			opts.KeepTTL = true
+			hasExpire = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasExpire || i+1 >= len(args) {
+				return opts, false, syntaxErr, false
+			}
+			i++
+
+			unit := time.Second
+			if opt == "PX" || opt == "PXAT" {
+				unit = time.Millisecond
+			}
+			absolute := opt == "EXAT" || opt == "PXAT"
+
+			if n, err := strconv.ParseInt(args[i].Str, 10, 64); err == nil && n <= 0 {
+				return opts, false, resp.Value{Type: resp.RespError, Str: "ERR invalid expire time in 'set' command"}, false
+			}
+			at, errVal, ok := parseDeadline("set", args[i].Str, unit, absolute)
+			if !ok {
+				return opts, false, errVal, false
+			}
+			opts.ExpireAt = at
+			hasExpire = true
+		default:
+			return opts, false, syntaxErr, false
+		}
+	}
+
+	return opts, get, resp.Value{}, true
 }
 
 func get(args []resp.Value) resp.Value {
@@ -66,23 +334,26 @@ func get(args []resp.Value) resp.Value {
 	return resp.Value{Type: resp.RespBulk, Str: val}
 }
 
+// HSET key field value [field value ...]
 func hset(args []resp.Value) resp.Value {
-	if len(args) != 3 {
+	if len(args) < 3 || len(args)%2 != 1 {
 		return resp.Value{Type: resp.RespError, Str: "ERR wrong number of arguments for 'hset' command"}
 	}
 
 	hash := args[0].Str
-	key := args[1].Str
-	val := args[2].Str
+	fields := make([]storage.HashField, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		fields = append(fields, storage.HashField{Field: args[i].Str, Value: args[i+1].Str})
+	}
 
 	shard := storage.GetShard(hash)
-	err := shard.HSet(hash, key, val)
+	added, err := shard.HSet(hash, fields)
 
 	if err != nil {
 		return resp.Value{Type: resp.RespError, Str: err.Error()}
 	}
 
-	return resp.Value{Type: resp.RespString, Str: "OK"}
+	return resp.Value{Type: resp.RespInteger, Int: int64(added)}
 }
 
 func hget(args []resp.Value) resp.Value {
@@ -122,14 +393,8 @@ func hgetall(args []resp.Value) resp.Value {
 	}
 
 	if !found {
-		return resp.Value{Type: resp.RespArray, Array: make([]resp.Value, 0)}
-	}
-
-	respArray := make([]resp.Value, len(arr))
-
-	for idx, value := range arr {
-		respArray[idx] = resp.Value{Type: resp.RespBulk, Str: value}
+		return resp.Value{Type: resp.RespMap, Array: make([]resp.Value, 0)}
 	}
 
-	return resp.Value{Type: resp.RespArray, Array: respArray}
+	return bulkMap(arr)
 }
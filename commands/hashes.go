@@ -0,0 +1,389 @@
+package commands
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devkarim/goredis/resp"
+	"github.com/devkarim/goredis/storage"
+)
+
+func hsetnx(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return wrongArgs("hsetnx")
+	}
+
+	key := args[0].Str
+	shard := storage.GetShard(key)
+	set, err := shard.HSetNX(key, args[1].Str, args[2].Str)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return boolInteger(set)
+}
+
+func hdel(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return wrongArgs("hdel")
+	}
+
+	key := args[0].Str
+	shard := storage.GetShard(key)
+	removed, err := shard.HDel(key, argStrings(args[1:]))
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(removed)}
+}
+
+func hexists(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return wrongArgs("hexists")
+	}
+
+	key := args[0].Str
+	shard := storage.GetShard(key)
+	exists, err := shard.HExists(key, args[1].Str)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return boolInteger(exists)
+}
+
+func hlen(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("hlen")
+	}
+
+	key := args[0].Str
+	shard := storage.GetShard(key)
+	n, err := shard.HLen(key)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
+
+func hstrlen(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return wrongArgs("hstrlen")
+	}
+
+	key := args[0].Str
+	shard := storage.GetShard(key)
+	n, err := shard.HStrLen(key, args[1].Str)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
+
+func hkeys(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("hkeys")
+	}
+
+	key := args[0].Str
+	shard := storage.GetShard(key)
+	fields, err := shard.HKeys(key)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return bulkArray(fields)
+}
+
+func hvals(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("hvals")
+	}
+
+	key := args[0].Str
+	shard := storage.GetShard(key)
+	vals, err := shard.HVals(key)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return bulkArray(vals)
+}
+
+func hmget(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return wrongArgs("hmget")
+	}
+
+	key := args[0].Str
+	shard := storage.GetShard(key)
+	vals, found, err := shard.HMGet(key, argStrings(args[1:]))
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	respArray := make([]resp.Value, len(vals))
+	for i, val := range vals {
+		if !found[i] {
+			respArray[i] = resp.Value{Type: resp.RespNil}
+			continue
+		}
+		respArray[i] = resp.Value{Type: resp.RespBulk, Str: val}
+	}
+
+	return resp.Value{Type: resp.RespArray, Array: respArray}
+}
+
+// HRANDFIELD key [count [WITHVALUES]]
+func hrandfield(args []resp.Value) resp.Value {
+	if len(args) < 1 || len(args) > 3 {
+		return wrongArgs("hrandfield")
+	}
+
+	key := args[0].Str
+	count := 1
+	if len(args) >= 2 {
+		n, err := strconv.Atoi(args[1].Str)
+		if err != nil {
+			return errNotInteger
+		}
+		count = n
+	}
+	withValues := false
+	if len(args) == 3 {
+		if strings.ToUpper(args[2].Str) != "WITHVALUES" {
+			return resp.Value{Type: resp.RespError, Str: "ERR syntax error"}
+		}
+		withValues = true
+	}
+
+	shard := storage.GetShard(key)
+	fields, err := shard.HRandField(key, count)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	if len(args) == 1 {
+		if len(fields) == 0 {
+			return resp.Value{Type: resp.RespNil}
+		}
+		return resp.Value{Type: resp.RespBulk, Str: fields[0].Field}
+	}
+
+	arr := make([]string, 0, len(fields)*2)
+	for _, f := range fields {
+		arr = append(arr, f.Field)
+		if withValues {
+			arr = append(arr, f.Value)
+		}
+	}
+
+	return bulkArray(arr)
+}
+
+func hincrby(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return wrongArgs("hincrby")
+	}
+
+	key, field := args[0].Str, args[1].Str
+	delta, err := strconv.ParseInt(args[2].Str, 10, 64)
+	if err != nil {
+		return errNotInteger
+	}
+
+	shard := storage.GetShard(key)
+	n, err := shard.HIncrBy(key, field, delta)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: n}
+}
+
+func hincrbyfloat(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return wrongArgs("hincrbyfloat")
+	}
+
+	key, field := args[0].Str, args[1].Str
+	delta, ok := parseFloat(args[2].Str)
+	if !ok {
+		return errNotFloat
+	}
+
+	shard := storage.GetShard(key)
+	val, err := shard.HIncrByFloat(key, field, delta)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespBulk, Str: val}
+}
+
+// propagateHIncrByFloat stores the resulting value, like propagateIncrByFloat.
+func propagateHIncrByFloat(args []resp.Value, response resp.Value) []resp.Value {
+	return []resp.Value{NewCommand("HSET", args[0].Str, args[1].Str, response.Str)}
+}
+
+func hexpire(args []resp.Value) resp.Value {
+	response, _ := applyHExpire("hexpire", time.Second, false)(args)
+	return response
+}
+
+func hpexpire(args []resp.Value) resp.Value {
+	response, _ := applyHExpire("hpexpire", time.Millisecond, false)(args)
+	return response
+}
+
+func hexpireat(args []resp.Value) resp.Value {
+	response, _ := applyHExpire("hexpireat", time.Second, true)(args)
+	return response
+}
+
+func hpexpireat(args []resp.Value) resp.Value {
+	response, _ := applyHExpire("hpexpireat", time.Millisecond, true)(args)
+	return response
+}
+
+// parseFields parses the FIELDS numfields field [field ...] block that ends
+// the field expiration commands.
+func parseFields(args []resp.Value) ([]string, resp.Value, bool) {
+	if len(args) < 2 || strings.ToUpper(args[0].Str) != "FIELDS" {
+		return nil, resp.Value{Type: resp.RespError, Str: "ERR Mandatory argument FIELDS is missing or not at the right position"}, false
+	}
+
+	n, err := strconv.Atoi(args[1].Str)
+	if err != nil {
+		return nil, errNotInteger, false
+	}
+	if n <= 0 {
+		return nil, resp.Value{Type: resp.RespError, Str: "ERR Parameter `numFields` should be greater than 0"}, false
+	}
+	if n != len(args)-2 {
+		return nil, resp.Value{Type: resp.RespError, Str: "ERR The `numfields` parameter must match the number of arguments"}, false
+	}
+
+	return argStrings(args[2:]), resp.Value{}, true
+}
+
+func integerArray[T int | int64](arr []T) resp.Value {
+	respArray := make([]resp.Value, len(arr))
+	for i, n := range arr {
+		respArray[i] = resp.Value{Type: resp.RespInteger, Int: int64(n)}
+	}
+
+	return resp.Value{Type: resp.RespArray, Array: respArray}
+}
+
+// applyHExpire implements the HEXPIRE family:
+// key <time> [NX | XX | GT | LT] FIELDS numfields field [field ...]
+// It logs the deadline it applied to the fields it changed as HPEXPIREAT,
+// like applyExpire.
+func applyHExpire(name string, unit time.Duration, absolute bool) func([]resp.Value) (resp.Value, []resp.Value) {
+	return func(args []resp.Value) (resp.Value, []resp.Value) {
+		if len(args) < 4 {
+			return wrongArgs(name), nil
+		}
+
+		key := args[0].Str
+		at, errVal, ok := parseDeadline(name, args[1].Str, unit, absolute)
+		if !ok {
+			return errVal, nil
+		}
+
+		rest := args[2:]
+		cond, ok := parseExpireCondition(rest[0].Str)
+		if ok {
+			rest = rest[1:]
+		}
+		fields, errVal, ok := parseFields(rest)
+		if !ok {
+			return errVal, nil
+		}
+
+		shard := storage.GetShard(key)
+		results, err := shard.HExpireAt(key, fields, at, cond)
+		if err != nil {
+			return resp.Value{Type: resp.RespError, Str: err.Error()}, nil
+		}
+
+		var changed []string
+		for i, r := range results {
+			if r == storage.FieldUpdated || r == storage.FieldDeleted {
+				changed = append(changed, fields[i])
+			}
+		}
+		if len(changed) == 0 {
+			return integerArray(results), nil
+		}
+
+		cmd := NewCommand("HPEXPIREAT", key, strconv.FormatInt(at, 10), "FIELDS", strconv.Itoa(len(changed)))
+		for _, field := range changed {
+			cmd.Array = append(cmd.Array, resp.Value{Type: resp.RespBulk, Str: field})
+		}
+		return integerArray(results), []resp.Value{cmd}
+	}
+}
+
+func httl(args []resp.Value) resp.Value {
+	return httlGeneric("httl", args, time.Second)
+}
+
+func hpttl(args []resp.Value) resp.Value {
+	return httlGeneric("hpttl", args, time.Millisecond)
+}
+
+// HTTL key FIELDS numfields field [field ...]
+func httlGeneric(name string, args []resp.Value, unit time.Duration) resp.Value {
+	if len(args) < 3 {
+		return wrongArgs(name)
+	}
+
+	key := args[0].Str
+	fields, errVal, ok := parseFields(args[1:])
+	if !ok {
+		return errVal
+	}
+
+	shard := storage.GetShard(key)
+	results, err := shard.HTTL(key, fields)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	if unit == time.Second {
+		for i, ms := range results {
+			if ms >= 0 {
+				results[i] = (ms + 500) / 1000
+			}
+		}
+	}
+
+	return integerArray(results)
+}
+
+// HPERSIST key FIELDS numfields field [field ...]
+func hpersist(args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return wrongArgs("hpersist")
+	}
+
+	key := args[0].Str
+	fields, errVal, ok := parseFields(args[1:])
+	if !ok {
+		return errVal
+	}
+
+	shard := storage.GetShard(key)
+	results, err := shard.HPersist(key, fields)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return integerArray(results)
+}
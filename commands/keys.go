@@ -0,0 +1,151 @@
+package commands
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devkarim/goredis/resp"
+	"github.com/devkarim/goredis/storage"
+)
+
+var errNotInteger = resp.Value{Type: resp.RespError, Str: "ERR value is not an integer or out of range"}
+
+func expire(args []resp.Value) resp.Value {
+	response, _ := applyExpire("expire", time.Second, false)(args)
+	return response
+}
+
+func pexpire(args []resp.Value) resp.Value {
+	response, _ := applyExpire("pexpire", time.Millisecond, false)(args)
+	return response
+}
+
+func expireat(args []resp.Value) resp.Value {
+	response, _ := applyExpire("expireat", time.Second, true)(args)
+	return response
+}
+
+func pexpireat(args []resp.Value) resp.Value {
+	response, _ := applyExpire("pexpireat", time.Millisecond, true)(args)
+	return response
+}
+
+// applyExpire implements the EXPIRE family: key <time> [NX | XX | GT | LT].
+// It logs the deadline it applied as PEXPIREAT without the condition, so that
+// replaying the AOF later neither extends the lifetime of the key nor
+// evaluates the condition again.
+func applyExpire(name string, unit time.Duration, absolute bool) func([]resp.Value) (resp.Value, []resp.Value) {
+	return func(args []resp.Value) (resp.Value, []resp.Value) {
+		if len(args) < 2 || len(args) > 3 {
+			return wrongArgs(name), nil
+		}
+
+		key := args[0].Str
+		at, errVal, ok := parseDeadline(name, args[1].Str, unit, absolute)
+		if !ok {
+			return errVal, nil
+		}
+
+		cond := storage.ExpireAlways
+		if len(args) == 3 {
+			cond, ok = parseExpireCondition(args[2].Str)
+			if !ok {
+				return resp.Value{Type: resp.RespError, Str: "ERR Unsupported option " + args[2].Str}, nil
+			}
+		}
+
+		shard := storage.GetShard(key)
+		if !shard.ExpireAt(key, at, cond) {
+			return resp.Value{Type: resp.RespInteger, Int: 0}, nil
+		}
+
+		cmd := NewCommand("PEXPIREAT", key, strconv.FormatInt(at, 10))
+		return resp.Value{Type: resp.RespInteger, Int: 1}, []resp.Value{cmd}
+	}
+}
+
+// parseDeadline converts a relative or absolute time in unit into an absolute
+// unix time in milliseconds.
+func parseDeadline(name, str string, unit time.Duration, absolute bool) (int64, resp.Value, bool) {
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return 0, errNotInteger, false
+	}
+
+	invalid := resp.Value{Type: resp.RespError, Str: "ERR invalid expire time in '" + name + "' command"}
+
+	scale := int64(unit / time.Millisecond)
+	if n > math.MaxInt64/scale || n < math.MinInt64/scale {
+		return 0, invalid, false
+	}
+	at := n * scale
+
+	if !absolute {
+		base := time.Now().UnixMilli()
+		if at > math.MaxInt64-base {
+			return 0, invalid, false
+		}
+		at += base
+	}
+
+	return at, resp.Value{}, true
+}
+
+func parseExpireCondition(opt string) (storage.ExpireCondition, bool) {
+	switch strings.ToUpper(opt) {
+	case "NX":
+		return storage.ExpireNX, true
+	case "XX":
+		return storage.ExpireXX, true
+	case "GT":
+		return storage.ExpireGT, true
+	case "LT":
+		return storage.ExpireLT, true
+	}
+
+	return storage.ExpireAlways, false
+}
+
+func ttl(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("ttl")
+	}
+
+	key := args[0].Str
+
+	shard := storage.GetShard(key)
+	ms := shard.TTL(key)
+	if ms < 0 {
+		return resp.Value{Type: resp.RespInteger, Int: ms}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: (ms + 500) / 1000}
+}
+
+func pttl(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("pttl")
+	}
+
+	key := args[0].Str
+
+	shard := storage.GetShard(key)
+	return resp.Value{Type: resp.RespInteger, Int: shard.TTL(key)}
+}
+
+func persist(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("persist")
+	}
+
+	key := args[0].Str
+
+	shard := storage.GetShard(key)
+	if !shard.Persist(key) {
+		return resp.Value{Type: resp.RespInteger, Int: 0}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: 1}
+}
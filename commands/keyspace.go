@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"strings"
+
+	"github.com/devkarim/goredis/resp"
+	"github.com/devkarim/goredis/storage"
+)
+
+// del also implements UNLINK: values are reclaimed by the garbage collector
+// rather than freed by the server, so deleting never blocks on a large value.
+func del(args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return wrongArgs("del")
+	}
+
+	deleted := storage.Delete(argStrings(args))
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(deleted)}
+}
+
+func unlink(args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return wrongArgs("unlink")
+	}
+
+	return del(args)
+}
+
+func exists(args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return wrongArgs("exists")
+	}
+
+	count := storage.Exists(argStrings(args))
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(count)}
+}
+
+func typeCommand(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("type")
+	}
+
+	key := args[0].Str
+	shard := storage.GetShard(key)
+
+	return resp.Value{Type: resp.RespString, Str: shard.Type(key)}
+}
+
+func rename(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return wrongArgs("rename")
+	}
+
+	if _, err := storage.Rename(args[0].Str, args[1].Str, false); err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespString, Str: "OK"}
+}
+
+func renamenx(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return wrongArgs("renamenx")
+	}
+
+	renamed, err := storage.Rename(args[0].Str, args[1].Str, true)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return boolInteger(renamed)
+}
+
+// COPY source destination [DB destination-db] [REPLACE]
+func copyCommand(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return wrongArgs("copy")
+	}
+
+	replace := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Str) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			// there is a single database
+			if i+1 >= len(args) || args[i+1].Str != "0" {
+				return resp.Value{Type: resp.RespError, Str: "ERR DB index is out of range"}
+			}
+			i++
+		default:
+			return resp.Value{Type: resp.RespError, Str: "ERR syntax error"}
+		}
+	}
+
+	copied, err := storage.Copy(args[0].Str, args[1].Str, replace)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return boolInteger(copied)
+}
+
+func randomkey(args []resp.Value) resp.Value {
+	if len(args) != 0 {
+		return wrongArgs("randomkey")
+	}
+
+	key, ok := storage.RandomKey()
+	if !ok {
+		return resp.Value{Type: resp.RespNil}
+	}
+
+	return resp.Value{Type: resp.RespBulk, Str: key}
+}
+
+func dbsize(args []resp.Value) resp.Value {
+	if len(args) != 0 {
+		return wrongArgs("dbsize")
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(storage.DBSize())}
+}
+
+func flushdb(args []resp.Value) resp.Value {
+	return flushGeneric("flushdb", args)
+}
+
+func flushall(args []resp.Value) resp.Value {
+	return flushGeneric("flushall", args)
+}
+
+// flushGeneric implements FLUSHDB and FLUSHALL [ASYNC | SYNC], which are the
+// same since there is a single database. ASYNC and SYNC are accepted but
+// behave alike: the garbage collector reclaims the old keyspace either way.
+func flushGeneric(name string, args []resp.Value) resp.Value {
+	if len(args) > 1 {
+		return wrongArgs(name)
+	}
+
+	if len(args) == 1 {
+		switch strings.ToUpper(args[0].Str) {
+		case "ASYNC", "SYNC":
+		default:
+			return resp.Value{Type: resp.RespError, Str: "ERR syntax error"}
+		}
+	}
+
+	storage.Flush()
+
+	return resp.Value{Type: resp.RespString, Str: "OK"}
+}
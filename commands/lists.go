@@ -0,0 +1,313 @@
+package commands
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/devkarim/goredis/resp"
+	"github.com/devkarim/goredis/storage"
+)
+
+func bulkArray(arr []string) resp.Value {
+	respArray := make([]resp.Value, len(arr))
+
+	for idx, value := range arr {
+		respArray[idx] = resp.Value{Type: resp.RespBulk, Str: value}
+	}
+
+	return resp.Value{Type: resp.RespArray, Array: respArray}
+}
+
+// bulkSet replies with members as a RESP3 set, an array for RESP2.
+func bulkSet(members []string) resp.Value {
+	v := bulkArray(members)
+	v.Type = resp.RespSet
+	return v
+}
+
+// bulkMap replies with flattened key value pairs as a RESP3 map, a flat
+// array for RESP2.
+func bulkMap(pairs []string) resp.Value {
+	v := bulkArray(pairs)
+	v.Type = resp.RespMap
+	return v
+}
+
+func lpush(args []resp.Value) resp.Value {
+	return pushGeneric("lpush", args, true, false)
+}
+
+func rpush(args []resp.Value) resp.Value {
+	return pushGeneric("rpush", args, false, false)
+}
+
+func lpushx(args []resp.Value) resp.Value {
+	return pushGeneric("lpushx", args, true, true)
+}
+
+func rpushx(args []resp.Value) resp.Value {
+	return pushGeneric("rpushx", args, false, true)
+}
+
+func pushGeneric(name string, args []resp.Value, left bool, onlyIfExists bool) resp.Value {
+	if len(args) < 2 {
+		return wrongArgs(name)
+	}
+
+	key := args[0].Str
+	vals := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		vals[i] = arg.Str
+	}
+
+	shard := storage.GetShard(key)
+	n, err := shard.ListPush(key, vals, left, onlyIfExists)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
+
+func lpop(args []resp.Value) resp.Value {
+	return popGeneric("lpop", args, true)
+}
+
+func rpop(args []resp.Value) resp.Value {
+	return popGeneric("rpop", args, false)
+}
+
+// LPOP/RPOP key [count]
+func popGeneric(name string, args []resp.Value, left bool) resp.Value {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgs(name)
+	}
+
+	key := args[0].Str
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1].Str)
+		if err != nil || n < 0 {
+			return resp.Value{Type: resp.RespError, Str: "ERR value is out of range, must be positive"}
+		}
+		count = n
+	}
+
+	shard := storage.GetShard(key)
+	popped, found, err := shard.ListPop(key, count, left)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	if len(args) == 2 {
+		if !found {
+			return resp.Value{Type: resp.RespNil, NullArray: true}
+		}
+		return bulkArray(popped)
+	}
+
+	if len(popped) == 0 {
+		return resp.Value{Type: resp.RespNil}
+	}
+
+	return resp.Value{Type: resp.RespBulk, Str: popped[0]}
+}
+
+func lrange(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return wrongArgs("lrange")
+	}
+
+	key := args[0].Str
+	start, err1 := strconv.Atoi(args[1].Str)
+	stop, err2 := strconv.Atoi(args[2].Str)
+	if err1 != nil || err2 != nil {
+		return errNotInteger
+	}
+
+	shard := storage.GetShard(key)
+	arr, err := shard.LRange(key, start, stop)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return bulkArray(arr)
+}
+
+func llen(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("llen")
+	}
+
+	key := args[0].Str
+
+	shard := storage.GetShard(key)
+	n, err := shard.LLen(key)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
+
+func lindex(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return wrongArgs("lindex")
+	}
+
+	key := args[0].Str
+	index, err := strconv.Atoi(args[1].Str)
+	if err != nil {
+		return errNotInteger
+	}
+
+	shard := storage.GetShard(key)
+	val, found, err := shard.LIndex(key, index)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	if !found {
+		return resp.Value{Type: resp.RespNil}
+	}
+
+	return resp.Value{Type: resp.RespBulk, Str: val}
+}
+
+func lset(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return wrongArgs("lset")
+	}
+
+	key := args[0].Str
+	index, err := strconv.Atoi(args[1].Str)
+	if err != nil {
+		return errNotInteger
+	}
+	val := args[2].Str
+
+	shard := storage.GetShard(key)
+	err = shard.LSet(key, index, val)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespString, Str: "OK"}
+}
+
+func lrem(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return wrongArgs("lrem")
+	}
+
+	key := args[0].Str
+	count, err := strconv.Atoi(args[1].Str)
+	if err != nil {
+		return errNotInteger
+	}
+	val := args[2].Str
+
+	shard := storage.GetShard(key)
+	n, err := shard.LRem(key, count, val)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
+
+func ltrim(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return wrongArgs("ltrim")
+	}
+
+	key := args[0].Str
+	start, err1 := strconv.Atoi(args[1].Str)
+	stop, err2 := strconv.Atoi(args[2].Str)
+	if err1 != nil || err2 != nil {
+		return errNotInteger
+	}
+
+	shard := storage.GetShard(key)
+	err := shard.LTrim(key, start, stop)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespString, Str: "OK"}
+}
+
+// LINSERT key <BEFORE | AFTER> pivot element
+func linsert(args []resp.Value) resp.Value {
+	if len(args) != 4 {
+		return wrongArgs("linsert")
+	}
+
+	key := args[0].Str
+	var before bool
+	switch strings.ToUpper(args[1].Str) {
+	case "BEFORE":
+		before = true
+	case "AFTER":
+		before = false
+	default:
+		return resp.Value{Type: resp.RespError, Str: "ERR syntax error"}
+	}
+	pivot := args[2].Str
+	val := args[3].Str
+
+	shard := storage.GetShard(key)
+	n, err := shard.LInsert(key, before, pivot, val)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
+
+// LMOVE source destination <LEFT | RIGHT> <LEFT | RIGHT>
+func lmove(args []resp.Value) resp.Value {
+	if len(args) != 4 {
+		return wrongArgs("lmove")
+	}
+
+	src := args[0].Str
+	dst := args[1].Str
+	fromLeft, ok1 := parseListSide(args[2].Str)
+	toLeft, ok2 := parseListSide(args[3].Str)
+	if !ok1 || !ok2 {
+		return resp.Value{Type: resp.RespError, Str: "ERR syntax error"}
+	}
+
+	val, found, err := storage.LMove(src, dst, fromLeft, toLeft)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	if !found {
+		return resp.Value{Type: resp.RespNil}
+	}
+
+	return resp.Value{Type: resp.RespBulk, Str: val}
+}
+
+func parseListSide(side string) (bool, bool) {
+	switch strings.ToUpper(side) {
+	case "LEFT":
+		return true, true
+	case "RIGHT":
+		return false, true
+	}
+
+	return false, false
+}
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"strings"
+
+	"github.com/devkarim/goredis/pubsub"
+	"github.com/devkarim/goredis/resp"
+)
+
+func publish(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return wrongArgs("publish")
+	}
+
+	receivers := pubsub.Publish(args[0].Str, args[1].Str)
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(receivers)}
+}
+
+// PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT
+func pubsubCommand(args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return wrongArgs("pubsub")
+	}
+
+	sub := strings.ToUpper(args[0].Str)
+	switch {
+	case sub == "CHANNELS" && len(args) <= 2:
+		pattern := ""
+		if len(args) == 2 {
+			pattern = args[1].Str
+		}
+		return bulkArray(pubsub.Channels(pattern))
+	case sub == "NUMSUB":
+		respArray := make([]resp.Value, 0, 2*(len(args)-1))
+		for _, channel := range args[1:] {
+			respArray = append(respArray,
+				resp.Value{Type: resp.RespBulk, Str: channel.Str},
+				resp.Value{Type: resp.RespInteger, Int: int64(pubsub.NumSub(channel.Str))},
+			)
+		}
+		return resp.Value{Type: resp.RespArray, Array: respArray}
+	case sub == "NUMPAT" && len(args) == 1:
+		return resp.Value{Type: resp.RespInteger, Int: int64(pubsub.NumPat())}
+	}
+
+	return resp.Value{Type: resp.RespError, Str: "ERR unknown subcommand or wrong number of arguments for '" + args[0].Str + "'. Try PUBSUB HELP."}
+}
@@ -0,0 +1,183 @@
+package commands
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/devkarim/goredis/resp"
+	"github.com/devkarim/goredis/storage"
+)
+
+func scanReply(cursor uint64, items resp.Value) resp.Value {
+	return resp.Value{Type: resp.RespArray, Array: []resp.Value{
+		{Type: resp.RespBulk, Str: strconv.FormatUint(cursor, 10)},
+		items,
+	}}
+}
+
+// parseScanOptions parses [MATCH pattern] [COUNT count], along with
+// [TYPE type] when withType is set and [NOVALUES] when withNoValues is set.
+func parseScanOptions(args []resp.Value, withType, withNoValues bool) (storage.ScanOptions, bool, resp.Value, bool) {
+	syntaxErr := resp.Value{Type: resp.RespError, Str: "ERR syntax error"}
+	opts := storage.ScanOptions{Count: storage.DefaultScanCount}
+	noValues := false
+
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(args[i].Str)
+		switch {
+		case option == "NOVALUES" && withNoValues:
+			noValues = true
+			continue
+		case option != "MATCH" && option != "COUNT" && (option != "TYPE" || !withType):
+			return opts, false, syntaxErr, false
+		case i+1 >= len(args):
+			return opts, false, syntaxErr, false
+		}
+
+		i++
+		switch option {
+		case "MATCH":
+			opts.Match = args[i].Str
+		case "COUNT":
+			count, err := strconv.Atoi(args[i].Str)
+			if err != nil {
+				return opts, false, errNotInteger, false
+			}
+			if count < 1 {
+				return opts, false, syntaxErr, false
+			}
+			opts.Count = count
+		case "TYPE":
+			opts.Type = storage.RedisObjectType(strings.ToLower(args[i].Str))
+		}
+	}
+
+	return opts, noValues, resp.Value{}, true
+}
+
+func parseCursor(str string) (uint64, resp.Value, bool) {
+	cursor, err := strconv.ParseUint(str, 10, 64)
+	if err != nil {
+		return 0, resp.Value{Type: resp.RespError, Str: "ERR invalid cursor"}, false
+	}
+	return cursor, resp.Value{}, true
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func scan(args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return wrongArgs("scan")
+	}
+
+	cursor, errVal, ok := parseCursor(args[0].Str)
+	if !ok {
+		return errVal
+	}
+	opts, _, errVal, ok := parseScanOptions(args[1:], true, false)
+	if !ok {
+		return errVal
+	}
+
+	keys, cursor := storage.Scan(cursor, opts)
+
+	return scanReply(cursor, bulkArray(keys))
+}
+
+// HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+func hscan(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return wrongArgs("hscan")
+	}
+
+	key := args[0].Str
+	cursor, errVal, ok := parseCursor(args[1].Str)
+	if !ok {
+		return errVal
+	}
+	opts, noValues, errVal, ok := parseScanOptions(args[2:], false, true)
+	if !ok {
+		return errVal
+	}
+
+	shard := storage.GetShard(key)
+	pairs, cursor, err := shard.HScan(key, cursor, opts)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	if noValues {
+		fields := make([]string, 0, len(pairs)/2)
+		for i := 0; i < len(pairs); i += 2 {
+			fields = append(fields, pairs[i])
+		}
+		pairs = fields
+	}
+
+	return scanReply(cursor, bulkArray(pairs))
+}
+
+// SSCAN key cursor [MATCH pattern] [COUNT count]
+func sscan(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return wrongArgs("sscan")
+	}
+
+	key := args[0].Str
+	cursor, errVal, ok := parseCursor(args[1].Str)
+	if !ok {
+		return errVal
+	}
+	opts, _, errVal, ok := parseScanOptions(args[2:], false, false)
+	if !ok {
+		return errVal
+	}
+
+	shard := storage.GetShard(key)
+	members, cursor, err := shard.SScan(key, cursor, opts)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return scanReply(cursor, bulkArray(members))
+}
+
+// ZSCAN key cursor [MATCH pattern] [COUNT count]
+func zscan(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return wrongArgs("zscan")
+	}
+
+	key := args[0].Str
+	cursor, errVal, ok := parseCursor(args[1].Str)
+	if !ok {
+		return errVal
+	}
+	opts, _, errVal, ok := parseScanOptions(args[2:], false, false)
+	if !ok {
+		return errVal
+	}
+
+	shard := storage.GetShard(key)
+	members, cursor, err := shard.ZScan(key, cursor, opts)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	// unlike the other replies with scores, ZSCAN has them as strings
+	arr := make([]resp.Value, 0, len(members)*2)
+	for _, m := range members {
+		arr = append(arr,
+			resp.Value{Type: resp.RespBulk, Str: m.Member},
+			resp.Value{Type: resp.RespBulk, Str: resp.FormatDouble(m.Score)})
+	}
+
+	return scanReply(cursor, resp.Value{Type: resp.RespArray, Array: arr})
+}
+
+func keys(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("keys")
+	}
+
+	return bulkArray(storage.Keys(args[0].Str))
+}
@@ -0,0 +1,284 @@
+package commands
+
+import (
+	"strconv"
+
+	"github.com/devkarim/goredis/resp"
+	"github.com/devkarim/goredis/storage"
+)
+
+func argStrings(args []resp.Value) []string {
+	arr := make([]string, len(args))
+	for i, arg := range args {
+		arr[i] = arg.Str
+	}
+	return arr
+}
+
+func sadd(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return wrongArgs("sadd")
+	}
+
+	key := args[0].Str
+
+	shard := storage.GetShard(key)
+	n, err := shard.SAdd(key, argStrings(args[1:]))
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
+
+func srem(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return wrongArgs("srem")
+	}
+
+	key := args[0].Str
+
+	shard := storage.GetShard(key)
+	n, err := shard.SRem(key, argStrings(args[1:]))
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
+
+func smembers(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("smembers")
+	}
+
+	key := args[0].Str
+
+	shard := storage.GetShard(key)
+	members, err := shard.SMembers(key)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return bulkSet(members)
+}
+
+func sismember(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return wrongArgs("sismember")
+	}
+
+	key := args[0].Str
+
+	shard := storage.GetShard(key)
+	result, err := shard.SIsMember(key, []string{args[1].Str})
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return boolInteger(result[0])
+}
+
+func smismember(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return wrongArgs("smismember")
+	}
+
+	key := args[0].Str
+
+	shard := storage.GetShard(key)
+	result, err := shard.SIsMember(key, argStrings(args[1:]))
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	respArray := make([]resp.Value, len(result))
+	for i, ok := range result {
+		respArray[i] = boolInteger(ok)
+	}
+
+	return resp.Value{Type: resp.RespArray, Array: respArray}
+}
+
+func boolInteger(b bool) resp.Value {
+	if b {
+		return resp.Value{Type: resp.RespInteger, Int: 1}
+	}
+	return resp.Value{Type: resp.RespInteger, Int: 0}
+}
+
+func scard(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("scard")
+	}
+
+	key := args[0].Str
+
+	shard := storage.GetShard(key)
+	n, err := shard.SCard(key)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
+
+// SPOP key [count]
+func spop(args []resp.Value) resp.Value {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgs("spop")
+	}
+
+	key := args[0].Str
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1].Str)
+		if err != nil || n < 0 {
+			return resp.Value{Type: resp.RespError, Str: "ERR value is out of range, must be positive"}
+		}
+		count = n
+	}
+
+	shard := storage.GetShard(key)
+	members, _, err := shard.SPop(key, count)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	if len(args) == 2 {
+		return bulkArray(members)
+	}
+
+	if len(members) == 0 {
+		return resp.Value{Type: resp.RespNil}
+	}
+
+	return resp.Value{Type: resp.RespBulk, Str: members[0]}
+}
+
+// propagateSpop logs the randomly chosen members as an SREM so that replaying
+// the AOF removes exactly the same ones.
+func propagateSpop(args []resp.Value, response resp.Value) []resp.Value {
+	var members []resp.Value
+	switch response.Type {
+	case resp.RespBulk:
+		members = []resp.Value{response}
+	case resp.RespArray:
+		members = response.Array
+	}
+
+	if len(members) == 0 {
+		return nil
+	}
+
+	cmd := NewCommand("SREM", args[0].Str)
+	cmd.Array = append(cmd.Array, members...)
+	return []resp.Value{cmd}
+}
+
+// SRANDMEMBER key [count]
+func srandmember(args []resp.Value) resp.Value {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgs("srandmember")
+	}
+
+	key := args[0].Str
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1].Str)
+		if err != nil {
+			return errNotInteger
+		}
+		count = n
+	}
+
+	shard := storage.GetShard(key)
+	members, found, err := shard.SRandMember(key, count)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	if len(args) == 2 {
+		return bulkArray(members)
+	}
+
+	if !found || len(members) == 0 {
+		return resp.Value{Type: resp.RespNil}
+	}
+
+	return resp.Value{Type: resp.RespBulk, Str: members[0]}
+}
+
+func smove(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return wrongArgs("smove")
+	}
+
+	moved, err := storage.SMove(args[0].Str, args[1].Str, args[2].Str)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return boolInteger(moved)
+}
+
+func sinter(args []resp.Value) resp.Value {
+	return setCombineGeneric("sinter", args, storage.SetInter)
+}
+
+func sunion(args []resp.Value) resp.Value {
+	return setCombineGeneric("sunion", args, storage.SetUnion)
+}
+
+func sdiff(args []resp.Value) resp.Value {
+	return setCombineGeneric("sdiff", args, storage.SetDiff)
+}
+
+func setCombineGeneric(name string, args []resp.Value, op storage.SetOperation) resp.Value {
+	if len(args) < 1 {
+		return wrongArgs(name)
+	}
+
+	members, err := storage.SetCombine(op, argStrings(args))
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return bulkSet(members)
+}
+
+func sinterstore(args []resp.Value) resp.Value {
+	return setCombineStoreGeneric("sinterstore", args, storage.SetInter)
+}
+
+func sunionstore(args []resp.Value) resp.Value {
+	return setCombineStoreGeneric("sunionstore", args, storage.SetUnion)
+}
+
+func sdiffstore(args []resp.Value) resp.Value {
+	return setCombineStoreGeneric("sdiffstore", args, storage.SetDiff)
+}
+
+func setCombineStoreGeneric(name string, args []resp.Value, op storage.SetOperation) resp.Value {
+	if len(args) < 2 {
+		return wrongArgs(name)
+	}
+
+	n, err := storage.SetCombineStore(op, args[0].Str, argStrings(args[1:]))
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
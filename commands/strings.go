@@ -0,0 +1,345 @@
+package commands
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devkarim/goredis/resp"
+	"github.com/devkarim/goredis/storage"
+)
+
+func incr(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("incr")
+	}
+	return incrGeneric(args[0].Str, 1)
+}
+
+func decr(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("decr")
+	}
+	return incrGeneric(args[0].Str, -1)
+}
+
+func incrby(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return wrongArgs("incrby")
+	}
+
+	delta, err := strconv.ParseInt(args[1].Str, 10, 64)
+	if err != nil {
+		return errNotInteger
+	}
+	return incrGeneric(args[0].Str, delta)
+}
+
+func decrby(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return wrongArgs("decrby")
+	}
+
+	delta, err := strconv.ParseInt(args[1].Str, 10, 64)
+	if err != nil {
+		return errNotInteger
+	}
+	if delta == math.MinInt64 {
+		return resp.Value{Type: resp.RespError, Str: "ERR decrement would overflow"}
+	}
+	return incrGeneric(args[0].Str, -delta)
+}
+
+func incrGeneric(key string, delta int64) resp.Value {
+	shard := storage.GetShard(key)
+	n, err := shard.IncrBy(key, delta)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: n}
+}
+
+func incrbyfloat(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return wrongArgs("incrbyfloat")
+	}
+
+	key := args[0].Str
+	delta, ok := parseFloat(args[1].Str)
+	if !ok {
+		return errNotFloat
+	}
+
+	shard := storage.GetShard(key)
+	val, err := shard.IncrByFloat(key, delta)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespBulk, Str: val}
+}
+
+// propagateIncrByFloat stores the resulting value rather than the increment,
+// since adding floats may give a different result on another platform.
+func propagateIncrByFloat(args []resp.Value, response resp.Value) []resp.Value {
+	return []resp.Value{NewCommand("SET", args[0].Str, response.Str, "KEEPTTL")}
+}
+
+// bulkOrNil replies with str, or a nil reply when it was not found.
+func bulkOrNil(str string, found bool) resp.Value {
+	if !found {
+		return resp.Value{Type: resp.RespNil}
+	}
+	return resp.Value{Type: resp.RespBulk, Str: str}
+}
+
+func appendCommand(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return wrongArgs("append")
+	}
+
+	key := args[0].Str
+	shard := storage.GetShard(key)
+	n, err := shard.Append(key, args[1].Str)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
+
+func strlen(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("strlen")
+	}
+
+	key := args[0].Str
+	shard := storage.GetShard(key)
+	n, err := shard.StrLen(key)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
+
+func getrange(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return wrongArgs("getrange")
+	}
+
+	key := args[0].Str
+	start, err := strconv.Atoi(args[1].Str)
+	if err != nil {
+		return errNotInteger
+	}
+	end, err := strconv.Atoi(args[2].Str)
+	if err != nil {
+		return errNotInteger
+	}
+
+	shard := storage.GetShard(key)
+	str, err := shard.GetRange(key, start, end)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespBulk, Str: str}
+}
+
+func setrange(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return wrongArgs("setrange")
+	}
+
+	key := args[0].Str
+	offset, err := strconv.Atoi(args[1].Str)
+	if err != nil {
+		return errNotInteger
+	}
+	if offset < 0 {
+		return resp.Value{Type: resp.RespError, Str: "ERR offset is out of range"}
+	}
+
+	shard := storage.GetShard(key)
+	n, err := shard.SetRange(key, offset, args[2].Str)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
+
+func getset(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return wrongArgs("getset")
+	}
+
+	key := args[0].Str
+	shard := storage.GetShard(key)
+	result, err := shard.Set(key, args[1].Str, storage.SetOptions{})
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return bulkOrNil(result.Old, result.OldFound)
+}
+
+func getdel(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("getdel")
+	}
+
+	key := args[0].Str
+	shard := storage.GetShard(key)
+	val, found, err := shard.GetDel(key)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return bulkOrNil(val, found)
+}
+
+// parseGetExOptions parses [EX seconds | PX milliseconds |
+// EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST].
+func parseGetExOptions(args []resp.Value) (int64, bool, resp.Value, bool) {
+	syntaxErr := resp.Value{Type: resp.RespError, Str: "ERR syntax error"}
+
+	if len(args) == 0 {
+		return 0, false, resp.Value{}, true
+	}
+
+	opt := strings.ToUpper(args[0].Str)
+	switch opt {
+	case "PERSIST":
+		if len(args) != 1 {
+			return 0, false, syntaxErr, false
+		}
+		return 0, true, resp.Value{}, true
+	case "EX", "PX", "EXAT", "PXAT":
+		if len(args) != 2 {
+			return 0, false, syntaxErr, false
+		}
+	default:
+		return 0, false, syntaxErr, false
+	}
+
+	unit := time.Second
+	if opt == "PX" || opt == "PXAT" {
+		unit = time.Millisecond
+	}
+	absolute := opt == "EXAT" || opt == "PXAT"
+
+	if n, err := strconv.ParseInt(args[1].Str, 10, 64); err == nil && n <= 0 {
+		return 0, false, resp.Value{Type: resp.RespError, Str: "ERR invalid expire time in 'getex' command"}, false
+	}
+	at, errVal, ok := parseDeadline("getex", args[1].Str, unit, absolute)
+	if !ok {
+		return 0, false, errVal, false
+	}
+
+	return at, false, resp.Value{}, true
+}
+
+// GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds |
+// PXAT unix-time-milliseconds | PERSIST]
+func getex(args []resp.Value) resp.Value {
+	response, _ := applyGetEx(args)
+	return response
+}
+
+// applyGetEx runs GETEX and logs the change of deadline it made, if any, as
+// PEXPIREAT with the deadline it applied or as PERSIST.
+func applyGetEx(args []resp.Value) (resp.Value, []resp.Value) {
+	if len(args) < 1 {
+		return wrongArgs("getex"), nil
+	}
+
+	key := args[0].Str
+	at, persist, errVal, ok := parseGetExOptions(args[1:])
+	if !ok {
+		return errVal, nil
+	}
+
+	shard := storage.GetShard(key)
+	val, found, err := shard.GetEx(key, at, persist)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}, nil
+	}
+
+	response := bulkOrNil(val, found)
+	switch {
+	case !found:
+		return response, nil
+	case at > 0:
+		return response, []resp.Value{NewCommand("PEXPIREAT", key, strconv.FormatInt(at, 10))}
+	case persist:
+		return response, []resp.Value{NewCommand("PERSIST", key)}
+	}
+	return response, nil
+}
+
+func setnx(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return wrongArgs("setnx")
+	}
+
+	key := args[0].Str
+	shard := storage.GetShard(key)
+	result, err := shard.Set(key, args[1].Str, storage.SetOptions{Condition: storage.SetNX})
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return boolInteger(result.Applied)
+}
+
+func keyValuePairs(args []resp.Value) []storage.KeyValue {
+	pairs := make([]storage.KeyValue, 0, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		pairs = append(pairs, storage.KeyValue{Key: args[i].Str, Value: args[i+1].Str})
+	}
+	return pairs
+}
+
+func mset(args []resp.Value) resp.Value {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return wrongArgs("mset")
+	}
+
+	if _, err := storage.MSet(keyValuePairs(args), false); err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespString, Str: "OK"}
+}
+
+func msetnx(args []resp.Value) resp.Value {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return wrongArgs("msetnx")
+	}
+
+	set, err := storage.MSet(keyValuePairs(args), true)
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return boolInteger(set)
+}
+
+func mget(args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return wrongArgs("mget")
+	}
+
+	vals, found := storage.MGet(argStrings(args))
+
+	respArray := make([]resp.Value, len(vals))
+	for i, val := range vals {
+		respArray[i] = bulkOrNil(val, found[i])
+	}
+
+	return resp.Value{Type: resp.RespArray, Array: respArray}
+}
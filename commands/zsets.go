@@ -0,0 +1,455 @@
+package commands
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/devkarim/goredis/resp"
+	"github.com/devkarim/goredis/storage"
+)
+
+var errNotFloat = resp.Value{Type: resp.RespError, Str: "ERR value is not a valid float"}
+
+var errMinMaxNotFloat = resp.Value{Type: resp.RespError, Str: "ERR min or max is not a float"}
+
+func parseFloat(str string) (float64, bool) {
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+// parseScoreBound parses a range bound such as 1.5, (1.5, -inf or +inf.
+func parseScoreBound(str string) (float64, bool, bool) {
+	exclusive := strings.HasPrefix(str, "(")
+	if exclusive {
+		str = str[1:]
+	}
+
+	f, ok := parseFloat(str)
+	return f, exclusive, ok
+}
+
+func parseScoreRange(minStr, maxStr string) (storage.ScoreRange, bool) {
+	var r storage.ScoreRange
+	var ok1, ok2 bool
+
+	r.Min, r.MinEx, ok1 = parseScoreBound(minStr)
+	r.Max, r.MaxEx, ok2 = parseScoreBound(maxStr)
+
+	return r, ok1 && ok2
+}
+
+// zmembersArray replies with members and, withScores, their scores: as
+// [member, score] pairs in RESP3 and as a flat array in RESP2, like Redis.
+func zmembersArray(members []storage.ZMember, withScores bool) resp.Value {
+	respArray := make([]resp.Value, len(members))
+
+	for i, m := range members {
+		respArray[i] = resp.Value{Type: resp.RespBulk, Str: m.Member}
+		if withScores {
+			respArray[i] = zmemberPair(m)
+		}
+	}
+
+	return resp.Value{Type: resp.RespArray, Array: respArray, Pairs: withScores}
+}
+
+func zmemberPair(m storage.ZMember) resp.Value {
+	return resp.Value{Type: resp.RespArray, Array: []resp.Value{
+		{Type: resp.RespBulk, Str: m.Member},
+		{Type: resp.RespDouble, Float: m.Score},
+	}}
+}
+
+// ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member [score member ...]
+func zadd(args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return wrongArgs("zadd")
+	}
+
+	key := args[0].Str
+
+	var opts storage.ZAddOptions
+	ch := false
+	i := 1
+loop:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Str) {
+		case "NX":
+			opts.Condition = storage.SetNX
+		case "XX":
+			opts.Condition = storage.SetXX
+		case "GT":
+			opts.GT = true
+		case "LT":
+			opts.LT = true
+		case "CH":
+			ch = true
+		case "INCR":
+			opts.Incr = true
+		default:
+			break loop
+		}
+	}
+
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return resp.Value{Type: resp.RespError, Str: "ERR syntax error"}
+	}
+	if hasOption(args[1:i], "NX") && hasOption(args[1:i], "XX") {
+		return resp.Value{Type: resp.RespError, Str: "ERR XX and NX options at the same time are not compatible"}
+	}
+	if opts.Condition == storage.SetNX && (opts.GT || opts.LT) || opts.GT && opts.LT {
+		return resp.Value{Type: resp.RespError, Str: "ERR GT, LT, and/or NX options at the same time are not compatible"}
+	}
+	if opts.Incr && len(pairs) != 2 {
+		return resp.Value{Type: resp.RespError, Str: "ERR INCR option supports a single increment-element pair"}
+	}
+
+	members := make([]storage.ZMember, len(pairs)/2)
+	for j := range members {
+		score, ok := parseFloat(pairs[2*j].Str)
+		if !ok {
+			return errNotFloat
+		}
+		members[j] = storage.ZMember{Score: score, Member: pairs[2*j+1].Str}
+	}
+
+	shard := storage.GetShard(key)
+	result, err := shard.ZAdd(key, opts, members)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	if opts.Incr {
+		if !result.Applied {
+			return resp.Value{Type: resp.RespNil}
+		}
+		return resp.Value{Type: resp.RespDouble, Float: result.Score}
+	}
+
+	if ch {
+		return resp.Value{Type: resp.RespInteger, Int: int64(result.Added + result.Updated)}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(result.Added)}
+}
+
+func hasOption(args []resp.Value, opt string) bool {
+	for _, arg := range args {
+		if strings.EqualFold(arg.Str, opt) {
+			return true
+		}
+	}
+	return false
+}
+
+func zincrby(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return wrongArgs("zincrby")
+	}
+
+	key := args[0].Str
+	incr, ok := parseFloat(args[1].Str)
+	if !ok {
+		return errNotFloat
+	}
+	member := args[2].Str
+
+	shard := storage.GetShard(key)
+	result, err := shard.ZAdd(key, storage.ZAddOptions{Incr: true}, []storage.ZMember{{Member: member, Score: incr}})
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespDouble, Float: result.Score}
+}
+
+func zrem(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return wrongArgs("zrem")
+	}
+
+	key := args[0].Str
+
+	shard := storage.GetShard(key)
+	n, err := shard.ZRem(key, argStrings(args[1:]))
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
+
+func zscore(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return wrongArgs("zscore")
+	}
+
+	key := args[0].Str
+
+	shard := storage.GetShard(key)
+	score, found, err := shard.ZScore(key, args[1].Str)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	if !found {
+		return resp.Value{Type: resp.RespNil}
+	}
+
+	return resp.Value{Type: resp.RespDouble, Float: score}
+}
+
+func zcard(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return wrongArgs("zcard")
+	}
+
+	key := args[0].Str
+
+	shard := storage.GetShard(key)
+	n, err := shard.ZCard(key)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
+
+func zrank(args []resp.Value) resp.Value {
+	return zrankGeneric("zrank", args, false)
+}
+
+func zrevrank(args []resp.Value) resp.Value {
+	return zrankGeneric("zrevrank", args, true)
+}
+
+func zrankGeneric(name string, args []resp.Value, reverse bool) resp.Value {
+	if len(args) != 2 {
+		return wrongArgs(name)
+	}
+
+	key := args[0].Str
+
+	shard := storage.GetShard(key)
+	rank, found, err := shard.ZRank(key, args[1].Str, reverse)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	if !found {
+		return resp.Value{Type: resp.RespNil}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(rank)}
+}
+
+func zcount(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return wrongArgs("zcount")
+	}
+
+	key := args[0].Str
+	r, ok := parseScoreRange(args[1].Str, args[2].Str)
+	if !ok {
+		return errMinMaxNotFloat
+	}
+
+	shard := storage.GetShard(key)
+	n, err := shard.ZCount(key, r)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return resp.Value{Type: resp.RespInteger, Int: int64(n)}
+}
+
+type zrangeOptions struct {
+	byScore    bool
+	reverse    bool
+	withScores bool
+	limit      bool
+	offset     int
+	count      int
+}
+
+// ZRANGE key start stop [BYSCORE] [REV] [LIMIT offset count] [WITHSCORES]
+func zrange(args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return wrongArgs("zrange")
+	}
+
+	opts := zrangeOptions{count: -1}
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Str) {
+		case "BYSCORE":
+			opts.byScore = true
+		case "REV":
+			opts.reverse = true
+		case "WITHSCORES":
+			opts.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return resp.Value{Type: resp.RespError, Str: "ERR syntax error"}
+			}
+			offset, err1 := strconv.Atoi(args[i+1].Str)
+			count, err2 := strconv.Atoi(args[i+2].Str)
+			if err1 != nil || err2 != nil {
+				return errNotInteger
+			}
+			opts.limit, opts.offset, opts.count = true, offset, count
+			i += 2
+		default:
+			return resp.Value{Type: resp.RespError, Str: "ERR syntax error"}
+		}
+	}
+
+	if opts.limit && !opts.byScore {
+		return resp.Value{Type: resp.RespError, Str: "ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX"}
+	}
+
+	return zrangeGeneric(args[0].Str, args[1].Str, args[2].Str, opts)
+}
+
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func zrangebyscore(args []resp.Value) resp.Value {
+	return zrangeByScoreGeneric("zrangebyscore", args, false)
+}
+
+// ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+func zrevrangebyscore(args []resp.Value) resp.Value {
+	return zrangeByScoreGeneric("zrevrangebyscore", args, true)
+}
+
+func zrangeByScoreGeneric(name string, args []resp.Value, reverse bool) resp.Value {
+	if len(args) < 3 {
+		return wrongArgs(name)
+	}
+
+	opts := zrangeOptions{byScore: true, reverse: reverse, count: -1}
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Str) {
+		case "WITHSCORES":
+			opts.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return resp.Value{Type: resp.RespError, Str: "ERR syntax error"}
+			}
+			offset, err1 := strconv.Atoi(args[i+1].Str)
+			count, err2 := strconv.Atoi(args[i+2].Str)
+			if err1 != nil || err2 != nil {
+				return errNotInteger
+			}
+			opts.limit, opts.offset, opts.count = true, offset, count
+			i += 2
+		default:
+			return resp.Value{Type: resp.RespError, Str: "ERR syntax error"}
+		}
+	}
+
+	return zrangeGeneric(args[0].Str, args[1].Str, args[2].Str, opts)
+}
+
+// ZREVRANGE key start stop [WITHSCORES]
+func zrevrange(args []resp.Value) resp.Value {
+	if len(args) != 3 && len(args) != 4 {
+		return wrongArgs("zrevrange")
+	}
+
+	opts := zrangeOptions{reverse: true, count: -1}
+	if len(args) == 4 {
+		if !strings.EqualFold(args[3].Str, "WITHSCORES") {
+			return resp.Value{Type: resp.RespError, Str: "ERR syntax error"}
+		}
+		opts.withScores = true
+	}
+
+	return zrangeGeneric(args[0].Str, args[1].Str, args[2].Str, opts)
+}
+
+func zrangeGeneric(key, start, stop string, opts zrangeOptions) resp.Value {
+	shard := storage.GetShard(key)
+
+	var members []storage.ZMember
+	var err error
+
+	if opts.byScore {
+		// reversed score ranges are given as max then min
+		if opts.reverse {
+			start, stop = stop, start
+		}
+		r, ok := parseScoreRange(start, stop)
+		if !ok {
+			return errMinMaxNotFloat
+		}
+		if opts.offset < 0 {
+			return resp.Value{Type: resp.RespArray, Array: []resp.Value{}}
+		}
+		members, err = shard.ZRangeByScore(key, r, opts.reverse, opts.offset, opts.count)
+	} else {
+		startIdx, err1 := strconv.Atoi(start)
+		stopIdx, err2 := strconv.Atoi(stop)
+		if err1 != nil || err2 != nil {
+			return errNotInteger
+		}
+		members, err = shard.ZRange(key, startIdx, stopIdx, opts.reverse)
+	}
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	return zmembersArray(members, opts.withScores)
+}
+
+func zpopmin(args []resp.Value) resp.Value {
+	return zpopGeneric("zpopmin", args, false)
+}
+
+func zpopmax(args []resp.Value) resp.Value {
+	return zpopGeneric("zpopmax", args, true)
+}
+
+// ZPOPMIN/ZPOPMAX key [count]
+func zpopGeneric(name string, args []resp.Value, max bool) resp.Value {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgs(name)
+	}
+
+	key := args[0].Str
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1].Str)
+		if err != nil || n < 0 {
+			return resp.Value{Type: resp.RespError, Str: "ERR value is out of range, must be positive"}
+		}
+		count = n
+	}
+
+	shard := storage.GetShard(key)
+	popped, err := shard.ZPop(key, count, max)
+
+	if err != nil {
+		return resp.Value{Type: resp.RespError, Str: err.Error()}
+	}
+
+	// without a count a single member is popped, not an array of them
+	if len(args) == 1 {
+		if len(popped) == 0 {
+			return resp.Value{Type: resp.RespArray, Array: []resp.Value{}}
+		}
+		return zmemberPair(popped[0])
+	}
+	return zmembersArray(popped, true)
+}
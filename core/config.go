@@ -7,24 +7,48 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/devkarim/goredis/eviction"
+	"github.com/devkarim/goredis/storage"
 )
 
 var (
-	ErrInvalidMaxMemory = errors.New("maxmemory must be a positive integer")
-	ErrInvalidVerbose = errors.New("verbose must be a boolean")
-	ErrUnknownKey       = errors.New("unknown configuration key")
+	ErrInvalidMaxMemory         = errors.New("maxmemory must be a positive integer")
+	ErrInvalidVerbose           = errors.New("verbose must be a boolean")
+	ErrInvalidOutputBufferLimit = errors.New("client-output-buffer-limit must be: pubsub <hard> <soft> <soft-seconds>")
+	ErrInvalidProtoMaxBulkLen   = errors.New("proto-max-bulk-len must be 1mb or greater")
+	ErrInvalidMaxMultiBulkLen   = errors.New("max-multibulk-len must be a positive integer")
+	ErrInvalidQueryBufferLimit  = errors.New("client-query-buffer-limit must be a positive size, not less than proto-max-bulk-len")
+	ErrInvalidAutoRewritePct    = errors.New("auto-aof-rewrite-percentage must be a non-negative integer")
+	ErrInvalidAutoRewriteMin    = errors.New("auto-aof-rewrite-min-size must be a size")
+	ErrInvalidAofName           = errors.New("aof must be the path of a file")
+	ErrInvalidRdbPreamble       = errors.New("aof-use-rdb-preamble must be a boolean")
+	ErrInvalidLoadTruncated     = errors.New("aof-load-truncated must be a boolean")
+	ErrInvalidAofTimestamp      = errors.New("aof-timestamp-enabled must be a boolean")
+	ErrInvalidSave              = errors.New("save must be pairs of <seconds> <changes>, or \"\" to disable snapshots")
+	ErrUnknownKey               = errors.New("unknown configuration key")
 )
 
 const (
 	defaultConfigFilePath = "goredis.conf"
 
 	defaultPort      = "6379"
-	defaultAofPath   = "database.aof"
+	defaultAofName   = "database.aof"
+	defaultAofDir    = "appendonlydir"
 	defaultMaxMemory = 1e+8
+
+	defaultClientOutputBufferLimit = "pubsub 32mb 8mb 60"
+	defaultProtoMaxBulkLen         = "512mb"
+	defaultMaxMultiBulkLen         = 1024 * 1024
+	defaultClientQueryBufferLimit  = "1gb"
+	defaultAutoAofRewritePct       = 100
+	defaultAutoAofRewriteMinSize   = "64mb"
+	defaultAppendFsync             = storage.FsyncEverySec
+	defaultDbFilename              = "dump.rdb"
+	defaultSave                    = "3600 1 300 100 60 10000"
 )
 
 const (
@@ -33,14 +57,76 @@ const (
 	keyMaxMemory = "maxmemory"
 	keyPolicy    = "policy"
 	keyVerbose   = "verbose"
+
+	keyClientOutputBufferLimit = "client-output-buffer-limit"
+	keyProtoMaxBulkLen         = "proto-max-bulk-len"
+	keyMaxMultiBulkLen         = "max-multibulk-len"
+	keyClientQueryBufferLimit  = "client-query-buffer-limit"
+	keyAutoAofRewritePct       = "auto-aof-rewrite-percentage"
+	keyAutoAofRewriteMinSize   = "auto-aof-rewrite-min-size"
+	keyAppendFsync             = "appendfsync"
+	keyAppendDirName           = "appenddirname"
+	keyAofUseRdbPreamble       = "aof-use-rdb-preamble"
+	keyAofLoadTruncated        = "aof-load-truncated"
+	keyAofTimestampEnabled     = "aof-timestamp-enabled"
+	keyDbFilename              = "dbfilename"
+	keySave                    = "save"
+	keyEncryptionKeyFile       = "encryption-key-file"
 )
 
+// SaveRule triggers a snapshot once Changes changes were made to the
+// keyspace in Seconds seconds since the last one.
+type SaveRule struct {
+	Seconds int
+	Changes int64
+}
+
+// OutputBufferLimit bounds the pending output of a client: it is disconnected
+// as soon as Hard bytes are queued, or once Soft bytes stay queued for
+// SoftSeconds. A zero limit is disabled.
+type OutputBufferLimit struct {
+	Hard        int
+	Soft        int
+	SoftSeconds int
+}
+
 type Config struct {
-	ListenAddr *string
-	AofPath    *string
-	Policy     *eviction.PolicyType
-	MaxMemory  *int
-	Verbose    *bool
+	ListenAddr  *string
+	AofName     *string // path of the AOF, see AofPaths
+	Policy      *eviction.PolicyType
+	MaxMemory   *int
+	Verbose     *bool
+	PubSubLimit *OutputBufferLimit
+
+	// Limits on what a client may send, so a bogus length header cannot
+	// make the server allocate memory that never arrives.
+	ProtoMaxBulkLen  *int // largest bulk string argument
+	MaxMultiBulkLen  *int // most arguments in a command
+	QueryBufferLimit *int // largest command in bytes
+
+	// The AOF is rewritten once it grew by AutoAofRewritePct percent since
+	// the last rewrite and is at least AutoAofRewriteMinSize bytes.
+	AutoAofRewritePct     *int // 0 disables automatic rewrites
+	AutoAofRewriteMinSize *int
+
+	AppendFsync *storage.FsyncPolicy
+	AofDir      *string
+	// AofRdbBase makes rewrites write the base file of the AOF as a
+	// snapshot, which loads faster than commands.
+	AofRdbBase *bool
+	// AofLoadTruncated allows starting from an AOF whose last command was
+	// cut short, which is then truncated.
+	AofLoadTruncated *bool
+	// AofTimestamps annotates the AOF with the time of the writes, so that
+	// check-aof can truncate it to a point in time.
+	AofTimestamps *bool
+
+	RdbPath   *string
+	SaveRules *[]SaveRule // empty disables automatic snapshots
+
+	// EncryptionKeyFile holds the AES key the AOF and the snapshots are
+	// encrypted with, empty for none.
+	EncryptionKeyFile *string
 }
 
 func ptr[T any](v T) *T { return &v }
@@ -48,19 +134,116 @@ func ptr[T any](v T) *T { return &v }
 func (cfg Config) LogValue() slog.Value {
 	return slog.GroupValue(
 		slog.String("ListenAddr", *cfg.ListenAddr),
-		slog.String("AofPath", *cfg.AofPath),
+		slog.String("AofName", *cfg.AofName),
 		slog.Any("Policy", *cfg.Policy),
 		slog.Int("MaxMemory", *cfg.MaxMemory),
 		slog.Bool("Verbose", *cfg.Verbose),
+		slog.Any("PubSubLimit", *cfg.PubSubLimit),
+		slog.Int("ProtoMaxBulkLen", *cfg.ProtoMaxBulkLen),
+		slog.Int("MaxMultiBulkLen", *cfg.MaxMultiBulkLen),
+		slog.Int("QueryBufferLimit", *cfg.QueryBufferLimit),
+		slog.Int("AutoAofRewritePct", *cfg.AutoAofRewritePct),
+		slog.Int("AutoAofRewriteMinSize", *cfg.AutoAofRewriteMinSize),
+		slog.Any("AppendFsync", *cfg.AppendFsync),
+		slog.String("AofDir", *cfg.AofDir),
+		slog.Bool("AofRdbBase", *cfg.AofRdbBase),
+		slog.Bool("AofLoadTruncated", *cfg.AofLoadTruncated),
+		slog.Bool("AofTimestamps", *cfg.AofTimestamps),
+		slog.String("RdbPath", *cfg.RdbPath),
+		slog.Any("SaveRules", *cfg.SaveRules),
+		slog.String("EncryptionKeyFile", *cfg.EncryptionKeyFile),
 	)
 }
 
+// ParseMemory parses a size in bytes with an optional k, kb, m, mb, g or gb
+// unit, where the "b" forms are powers of 1024 like in redis.conf.
+func ParseMemory(value string) (int, error) {
+	units := []struct {
+		suffix string
+		scale  int
+	}{
+		{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10},
+		{"g", 1e9}, {"m", 1e6}, {"k", 1e3},
+	}
+
+	value = strings.ToLower(value)
+	scale := 1
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSuffix(value, unit.suffix)
+			scale = unit.scale
+			break
+		}
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid memory size: %s", value)
+	}
+
+	return v * scale, nil
+}
+
+func parseOutputBufferLimit(value string) (OutputBufferLimit, error) {
+	parts := strings.Fields(value)
+	if len(parts) != 4 || strings.ToLower(parts[0]) != "pubsub" {
+		return OutputBufferLimit{}, ErrInvalidOutputBufferLimit
+	}
+
+	hard, err1 := ParseMemory(parts[1])
+	soft, err2 := ParseMemory(parts[2])
+	seconds, err3 := strconv.Atoi(parts[3])
+	if err1 != nil || err2 != nil || err3 != nil || seconds < 0 {
+		return OutputBufferLimit{}, ErrInvalidOutputBufferLimit
+	}
+
+	return OutputBufferLimit{Hard: hard, Soft: soft, SoftSeconds: seconds}, nil
+}
+
+func parseSaveRules(value string) ([]SaveRule, error) {
+	if value == `""` {
+		return []SaveRule{}, nil
+	}
+
+	parts := strings.Fields(value)
+	if len(parts)%2 != 0 {
+		return nil, ErrInvalidSave
+	}
+
+	rules := make([]SaveRule, 0, len(parts)/2)
+	for i := 0; i < len(parts); i += 2 {
+		seconds, err1 := strconv.Atoi(parts[i])
+		changes, err2 := strconv.ParseInt(parts[i+1], 10, 64)
+		if err1 != nil || err2 != nil || seconds < 0 || changes < 0 {
+			return nil, ErrInvalidSave
+		}
+		rules = append(rules, SaveRule{Seconds: seconds, Changes: changes})
+	}
+
+	return rules, nil
+}
+
+// AofPaths returns the directory holding the files of the AOF and the name
+// they start with, the file name of AofName. A relative AofDir is in the
+// directory of AofName, where the single file AOF of older versions was.
+func (cfg *Config) AofPaths() (dir, name string) {
+	parent, name := filepath.Split(*cfg.AofName)
+	dir = *cfg.AofDir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(parent, dir)
+	}
+	return dir, name
+}
+
 func (cfg *Config) Set(name, value string) error {
 	switch name {
 	case keyPort:
 		cfg.ListenAddr = ptr(fmt.Sprintf(":%s", value))
 	case keyAof:
-		cfg.AofPath = ptr(value)
+		if value == "" || os.IsPathSeparator(value[len(value)-1]) {
+			return ErrInvalidAofName
+		}
+		cfg.AofName = ptr(value)
 	case keyMaxMemory:
 		v, err := strconv.Atoi(value)
 		if err != nil || v <= 0 {
@@ -79,6 +262,78 @@ func (cfg *Config) Set(name, value string) error {
 			return ErrInvalidVerbose
 		}
 		cfg.Verbose = ptr(v)
+	case keyClientOutputBufferLimit:
+		limit, err := parseOutputBufferLimit(value)
+		if err != nil {
+			return err
+		}
+		cfg.PubSubLimit = ptr(limit)
+	case keyProtoMaxBulkLen:
+		v, err := ParseMemory(value)
+		if err != nil || v < 1<<20 {
+			return ErrInvalidProtoMaxBulkLen
+		}
+		cfg.ProtoMaxBulkLen = ptr(v)
+	case keyMaxMultiBulkLen:
+		v, err := strconv.Atoi(value)
+		if err != nil || v <= 0 {
+			return ErrInvalidMaxMultiBulkLen
+		}
+		cfg.MaxMultiBulkLen = ptr(v)
+	case keyClientQueryBufferLimit:
+		v, err := ParseMemory(value)
+		if err != nil || v <= 0 {
+			return ErrInvalidQueryBufferLimit
+		}
+		cfg.QueryBufferLimit = ptr(v)
+	case keyAutoAofRewritePct:
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 0 {
+			return ErrInvalidAutoRewritePct
+		}
+		cfg.AutoAofRewritePct = ptr(v)
+	case keyAutoAofRewriteMinSize:
+		v, err := ParseMemory(value)
+		if err != nil {
+			return ErrInvalidAutoRewriteMin
+		}
+		cfg.AutoAofRewriteMinSize = ptr(v)
+	case keyAppendFsync:
+		var fsync storage.FsyncPolicy
+		if err := fsync.Set(value); err != nil {
+			return err
+		}
+		cfg.AppendFsync = ptr(fsync)
+	case keyAppendDirName:
+		cfg.AofDir = ptr(value)
+	case keyAofUseRdbPreamble:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return ErrInvalidRdbPreamble
+		}
+		cfg.AofRdbBase = ptr(v)
+	case keyAofLoadTruncated:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return ErrInvalidLoadTruncated
+		}
+		cfg.AofLoadTruncated = ptr(v)
+	case keyAofTimestampEnabled:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return ErrInvalidAofTimestamp
+		}
+		cfg.AofTimestamps = ptr(v)
+	case keyDbFilename:
+		cfg.RdbPath = ptr(value)
+	case keyEncryptionKeyFile:
+		cfg.EncryptionKeyFile = ptr(value)
+	case keySave:
+		rules, err := parseSaveRules(value)
+		if err != nil {
+			return err
+		}
+		cfg.SaveRules = ptr(rules)
 	default:
 		return fmt.Errorf("%w: %s", ErrUnknownKey, name)
 	}
@@ -95,6 +350,9 @@ func (cfg *Config) Validate() error {
 	if cfg.Policy == nil || *cfg.Policy == "" {
 		return eviction.ErrInvalidPolicyType
 	}
+	if *cfg.QueryBufferLimit < *cfg.ProtoMaxBulkLen {
+		return ErrInvalidQueryBufferLimit
+	}
 	return nil
 }
 
@@ -102,8 +360,8 @@ func (cfg *Config) MergeWith(other Config) {
 	if other.ListenAddr != nil {
 		cfg.ListenAddr = other.ListenAddr
 	}
-	if other.AofPath != nil {
-		cfg.AofPath = other.AofPath
+	if other.AofName != nil {
+		cfg.AofName = other.AofName
 	}
 	if other.MaxMemory != nil {
 		cfg.MaxMemory = other.MaxMemory
@@ -114,6 +372,48 @@ func (cfg *Config) MergeWith(other Config) {
 	if other.Verbose != nil {
 		cfg.Verbose = other.Verbose
 	}
+	if other.PubSubLimit != nil {
+		cfg.PubSubLimit = other.PubSubLimit
+	}
+	if other.ProtoMaxBulkLen != nil {
+		cfg.ProtoMaxBulkLen = other.ProtoMaxBulkLen
+	}
+	if other.MaxMultiBulkLen != nil {
+		cfg.MaxMultiBulkLen = other.MaxMultiBulkLen
+	}
+	if other.QueryBufferLimit != nil {
+		cfg.QueryBufferLimit = other.QueryBufferLimit
+	}
+	if other.AutoAofRewritePct != nil {
+		cfg.AutoAofRewritePct = other.AutoAofRewritePct
+	}
+	if other.AutoAofRewriteMinSize != nil {
+		cfg.AutoAofRewriteMinSize = other.AutoAofRewriteMinSize
+	}
+	if other.AppendFsync != nil {
+		cfg.AppendFsync = other.AppendFsync
+	}
+	if other.AofDir != nil {
+		cfg.AofDir = other.AofDir
+	}
+	if other.AofRdbBase != nil {
+		cfg.AofRdbBase = other.AofRdbBase
+	}
+	if other.AofLoadTruncated != nil {
+		cfg.AofLoadTruncated = other.AofLoadTruncated
+	}
+	if other.AofTimestamps != nil {
+		cfg.AofTimestamps = other.AofTimestamps
+	}
+	if other.RdbPath != nil {
+		cfg.RdbPath = other.RdbPath
+	}
+	if other.SaveRules != nil {
+		cfg.SaveRules = other.SaveRules
+	}
+	if other.EncryptionKeyFile != nil {
+		cfg.EncryptionKeyFile = other.EncryptionKeyFile
+	}
 }
 
 func LoadConfig() (Config, error) {
@@ -138,20 +438,60 @@ func LoadConfig() (Config, error) {
 func LoadDefaultConfig() Config {
 	return Config{
 		ListenAddr: ptr(fmt.Sprintf(":%s", defaultPort)),
-		AofPath:    ptr(defaultAofPath),
+		AofName:    ptr(defaultAofName),
 		MaxMemory:  ptr(int(defaultMaxMemory)),
 		Policy:     ptr(eviction.PolicyLRU),
 		Verbose:    ptr(false),
+		PubSubLimit: ptr(OutputBufferLimit{
+			Hard:        32 << 20,
+			Soft:        8 << 20,
+			SoftSeconds: 60,
+		}),
+		ProtoMaxBulkLen:  ptr(512 << 20),
+		MaxMultiBulkLen:  ptr(defaultMaxMultiBulkLen),
+		QueryBufferLimit: ptr(1 << 30),
+
+		AutoAofRewritePct:     ptr(defaultAutoAofRewritePct),
+		AutoAofRewriteMinSize: ptr(64 << 20),
+		AppendFsync:           ptr(defaultAppendFsync),
+		AofDir:                ptr(defaultAofDir),
+		AofRdbBase:            ptr(true),
+		AofLoadTruncated:      ptr(true),
+		AofTimestamps:         ptr(false),
+
+		RdbPath: ptr(defaultDbFilename),
+		SaveRules: ptr([]SaveRule{
+			{Seconds: 3600, Changes: 1},
+			{Seconds: 300, Changes: 100},
+			{Seconds: 60, Changes: 10000},
+		}),
+
+		EncryptionKeyFile: ptr(""),
 	}
 }
 
 func LoadArgs() Config {
 	var policy eviction.PolicyType
+	fsync := defaultAppendFsync
 	flag.String(keyPort, defaultPort, "Port to listen on")
-	flag.String(keyAof, defaultAofPath, "Path of the AOF file")
+	flag.String(keyAof, defaultAofName, "Path of the AOF, the files are kept in appenddirname next to it")
 	flag.Int(keyMaxMemory, defaultMaxMemory, "Max memory in bytes")
 	flag.Var(&policy, keyPolicy, "Eviction policy: lru, fifo")
 	flag.Bool(keyVerbose, false, "Verbose mode for debugging")
+	flag.String(keyClientOutputBufferLimit, defaultClientOutputBufferLimit, "Output buffer limit of pub/sub clients: pubsub <hard> <soft> <soft-seconds>")
+	flag.String(keyProtoMaxBulkLen, defaultProtoMaxBulkLen, "Largest bulk string a client may send")
+	flag.Int(keyMaxMultiBulkLen, defaultMaxMultiBulkLen, "Most arguments a command may have")
+	flag.String(keyClientQueryBufferLimit, defaultClientQueryBufferLimit, "Largest command a client may send")
+	flag.Int(keyAutoAofRewritePct, defaultAutoAofRewritePct, "Growth of the AOF since its last rewrite, in percent, that triggers a rewrite (0 to disable)")
+	flag.String(keyAutoAofRewriteMinSize, defaultAutoAofRewriteMinSize, "Smallest AOF rewritten automatically")
+	flag.Var(&fsync, keyAppendFsync, "When the AOF is flushed to disk: always, everysec, no")
+	flag.String(keyAppendDirName, defaultAofDir, "Directory of the AOF files, relative to the directory of aof")
+	flag.Bool(keyAofUseRdbPreamble, true, "Write the base file of the AOF as a snapshot when rewriting it")
+	flag.Bool(keyAofLoadTruncated, true, "Truncate an incomplete command at the end of the AOF instead of refusing to start")
+	flag.Bool(keyAofTimestampEnabled, false, "Annotate the AOF with the time of the writes")
+	flag.String(keyDbFilename, defaultDbFilename, "Path of the snapshot file")
+	flag.String(keySave, defaultSave, `Snapshot after <changes> changes in <seconds>: "<seconds> <changes> ...", or "" to disable`)
+	flag.String(keyEncryptionKeyFile, "", "File holding the AES key the AOF and snapshots are encrypted with, raw or hex encoded")
 
 	flag.Parse()
 
@@ -51,3 +51,11 @@ func (f *FIFO) SelectVictim() (string, bool) {
 	delete(f.dict, key)
 	return key, true
 }
+
+func (f *FIFO) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.list.Init()
+	f.dict = make(map[string]*list.Element)
+}
@@ -53,3 +53,10 @@ func (lru *LRU) SelectVictim() (string, bool) {
 	return key, true
 }
 
+func (lru *LRU) Reset() {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	lru.list.Init()
+	lru.dict = make(map[string]*list.Element)
+}
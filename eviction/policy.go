@@ -41,4 +41,7 @@ type Policy interface {
 	Remove(key string)
 
 	SelectVictim() (string, bool)
+
+	// Reset forgets every tracked key.
+	Reset()
 }
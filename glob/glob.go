@@ -0,0 +1,106 @@
+package glob
+
+// Match reports whether str matches the Redis style glob pattern, which
+// supports '*', '?', character classes such as [abc], [^a] or [a-z] and
+// backslash escapes.
+func Match(pattern, str string) bool {
+	p, s := 0, 0
+	// position to resume from when the last '*' needs to match more bytes
+	starP, starS := -1, -1
+
+	for s < len(str) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				for p < len(pattern) && pattern[p] == '*' {
+					p++
+				}
+				if p == len(pattern) {
+					return true
+				}
+				starP, starS = p, s
+				continue
+			case '?':
+				p++
+				s++
+				continue
+			case '[':
+				if end, ok := matchClass(pattern, p, str[s]); ok {
+					p = end
+					s++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) {
+					if pattern[p+1] == str[s] {
+						p += 2
+						s++
+						continue
+					}
+					break
+				}
+				fallthrough
+			default:
+				if pattern[p] == str[s] {
+					p++
+					s++
+					continue
+				}
+			}
+		}
+
+		if starP < 0 {
+			return false
+		}
+		starS++
+		p, s = starP, starS
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass matches c against the class starting at pattern[start] == '['
+// and returns the position right after the class.
+func matchClass(pattern string, start int, c byte) (int, bool) {
+	p := start + 1
+	negate := p < len(pattern) && pattern[p] == '^'
+	if negate {
+		p++
+	}
+
+	matched := false
+	for p < len(pattern) && pattern[p] != ']' {
+		switch {
+		case pattern[p] == '\\' && p+1 < len(pattern):
+			p++
+			if pattern[p] == c {
+				matched = true
+			}
+			p++
+		case p+2 < len(pattern) && pattern[p+1] == '-' && pattern[p+2] != ']':
+			lo, hi := pattern[p], pattern[p+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				matched = true
+			}
+			p += 3
+		default:
+			if pattern[p] == c {
+				matched = true
+			}
+			p++
+		}
+	}
+
+	if p < len(pattern) {
+		// skip the closing ']'
+		p++
+	}
+
+	return p, matched != negate
+}
@@ -0,0 +1,35 @@
+package glob
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern, str string
+		want         bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"news.*", "news.sports", true},
+		{"news.*", "weather", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"user:\\*", "user:*", true},
+		{"user:\\*", "user:1", false},
+		{"*:*:end", "a:b:c:end", true},
+		{"a*b*c", "abbbc", true},
+		{"a*b*c", "abbbd", false},
+	}
+
+	for _, c := range cases {
+		if got := Match(c.pattern, c.str); got != c.want {
+			t.Errorf("Match(%q, %q) = %t; want %t", c.pattern, c.str, got, c.want)
+		}
+	}
+}
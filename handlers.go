@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/devkarim/goredis/commands"
+	"github.com/devkarim/goredis/resp"
+	"github.com/devkarim/goredis/storage"
+)
+
+// clientHandlers implement the commands that act on the connection or the
+// server itself rather than on the keyspace, so they are not part of
+// commands.Registry.
+var clientHandlers = map[string]func(s *Server, c *client, args []resp.Value){
+	"SUBSCRIBE":    subscribe,
+	"UNSUBSCRIBE":  unsubscribe,
+	"PSUBSCRIBE":   psubscribe,
+	"PUNSUBSCRIBE": punsubscribe,
+	"QUIT":         quit,
+	"PING":         ping,
+	"MULTI":        multi,
+	"EXEC":         exec,
+	"DISCARD":      discard,
+	"WATCH":        watch,
+	"UNWATCH":      unwatch,
+	"HELLO":        hello,
+	"BGREWRITEAOF": bgrewriteaof,
+	"INFO":         info,
+	"SAVE":         save,
+	"BGSAVE":       bgsave,
+	"LASTSAVE":     lastsave,
+}
+
+// subscriberCommands are the only commands accepted while in subscriber mode,
+// RESP3 connections accept every command since pushes are told apart.
+var subscriberCommands = map[string]bool{
+	"SUBSCRIBE":    true,
+	"UNSUBSCRIBE":  true,
+	"PSUBSCRIBE":   true,
+	"PUNSUBSCRIBE": true,
+	"PING":         true,
+	"QUIT":         true,
+}
+
+func wrongArgs(c *client, name string) {
+	c.Send(resp.Value{Type: resp.RespError, Str: "ERR wrong number of arguments for '" + name + "' command"})
+}
+
+func argStrings(args []resp.Value) []string {
+	arr := make([]string, len(args))
+	for i, arg := range args {
+		arr[i] = arg.Str
+	}
+	return arr
+}
+
+func subscribe(s *Server, c *client, args []resp.Value) {
+	if len(args) < 1 {
+		wrongArgs(c, "subscribe")
+		return
+	}
+
+	c.sub.Subscribe(argStrings(args)...)
+}
+
+func unsubscribe(s *Server, c *client, args []resp.Value) {
+	c.sub.Unsubscribe(argStrings(args)...)
+}
+
+func psubscribe(s *Server, c *client, args []resp.Value) {
+	if len(args) < 1 {
+		wrongArgs(c, "psubscribe")
+		return
+	}
+
+	c.sub.PSubscribe(argStrings(args)...)
+}
+
+func punsubscribe(s *Server, c *client, args []resp.Value) {
+	c.sub.PUnsubscribe(argStrings(args)...)
+}
+
+func quit(s *Server, c *client, args []resp.Value) {
+	c.Send(resp.Value{Type: resp.RespString, Str: "OK"})
+	c.quit = true
+}
+
+// ping replies like commands.Registry's PING outside of subscriber mode, and
+// with a [pong, message] array inside of it for RESP2 connections.
+func ping(s *Server, c *client, args []resp.Value) {
+	if c.sub.Count() == 0 || c.resp3() {
+		c.Send(commands.Registry["PING"].Handler(args))
+		return
+	}
+
+	message := ""
+	if len(args) > 0 {
+		message = args[0].Str
+	}
+
+	c.Send(resp.Value{Type: resp.RespArray, Array: []resp.Value{
+		{Type: resp.RespBulk, Str: "pong"},
+		{Type: resp.RespBulk, Str: message},
+	}})
+}
+
+// redisVersion is the version reported by HELLO, the Redis release whose
+// commands are implemented.
+const redisVersion = "7.4.0"
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+func hello(s *Server, c *client, args []resp.Value) {
+	proto := 0
+	if len(args) > 0 {
+		version, err := strconv.Atoi(args[0].Str)
+		if err != nil {
+			c.Send(resp.Value{Type: resp.RespError, Str: "ERR Protocol version is not an integer or out of range"})
+			return
+		}
+		if version != resp.RESP2 && version != resp.RESP3 {
+			c.Send(resp.Value{Type: resp.RespError, Str: "NOPROTO unsupported protocol version"})
+			return
+		}
+		proto = version
+	}
+
+	name, setName := "", false
+	for i := 1; i < len(args); i++ {
+		option := strings.ToUpper(args[i].Str)
+		switch {
+		case option == "AUTH" && i+2 < len(args):
+			// there is no password to check, only the default user exists
+			if args[i+1].Str != "default" {
+				c.Send(resp.Value{Type: resp.RespError, Str: "WRONGPASS invalid username-password pair or user is disabled."})
+				return
+			}
+			i += 2
+		case option == "SETNAME" && i+1 < len(args):
+			name, setName = args[i+1].Str, true
+			if !validClientName(name) {
+				c.Send(resp.Value{Type: resp.RespError, Str: "ERR Client names cannot contain spaces, newlines or special characters."})
+				return
+			}
+			i++
+		default:
+			c.Send(resp.Value{Type: resp.RespError, Str: "ERR Syntax error in HELLO option '" + args[i].Str + "'"})
+			return
+		}
+	}
+
+	if setName {
+		c.name = name
+	}
+	if proto != 0 {
+		c.setProto(proto)
+	}
+	if c.resp3() {
+		proto = resp.RESP3
+	} else {
+		proto = resp.RESP2
+	}
+
+	c.Send(resp.Value{Type: resp.RespMap, Array: []resp.Value{
+		{Type: resp.RespBulk, Str: "server"}, {Type: resp.RespBulk, Str: "redis"},
+		{Type: resp.RespBulk, Str: "version"}, {Type: resp.RespBulk, Str: redisVersion},
+		{Type: resp.RespBulk, Str: "proto"}, {Type: resp.RespInteger, Int: int64(proto)},
+		{Type: resp.RespBulk, Str: "id"}, {Type: resp.RespInteger, Int: c.id},
+		{Type: resp.RespBulk, Str: "mode"}, {Type: resp.RespBulk, Str: "standalone"},
+		{Type: resp.RespBulk, Str: "role"}, {Type: resp.RespBulk, Str: "master"},
+		{Type: resp.RespBulk, Str: "modules"}, {Type: resp.RespArray, Array: []resp.Value{}},
+	}})
+}
+
+// validClientName rejects the names CLIENT LIST could not print unquoted.
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func bgrewriteaof(s *Server, c *client, args []resp.Value) {
+	if len(args) != 0 {
+		wrongArgs(c, "bgrewriteaof")
+		return
+	}
+
+	if err := s.aof.RewriteInBackground(); err != nil {
+		c.Send(resp.Value{Type: resp.RespError, Str: err.Error()})
+		return
+	}
+	c.Send(resp.Value{Type: resp.RespString, Str: "Background append only file rewriting started"})
+}
+
+func save(s *Server, c *client, args []resp.Value) {
+	if len(args) != 0 {
+		wrongArgs(c, "save")
+		return
+	}
+
+	err := s.rdb.Save()
+	switch {
+	case errors.Is(err, storage.ErrSaveInProgress):
+		c.Send(resp.Value{Type: resp.RespError, Str: err.Error()})
+		return
+	case err != nil:
+		c.Send(resp.Value{Type: resp.RespError, Str: "ERR " + err.Error()})
+		return
+	}
+	c.Send(resp.Value{Type: resp.RespString, Str: "OK"})
+}
+
+func bgsave(s *Server, c *client, args []resp.Value) {
+	if len(args) != 0 {
+		wrongArgs(c, "bgsave")
+		return
+	}
+
+	if err := s.rdb.SaveInBackground(); err != nil {
+		c.Send(resp.Value{Type: resp.RespError, Str: err.Error()})
+		return
+	}
+	c.Send(resp.Value{Type: resp.RespString, Str: "Background saving started"})
+}
+
+func lastsave(s *Server, c *client, args []resp.Value) {
+	if len(args) != 0 {
+		wrongArgs(c, "lastsave")
+		return
+	}
+
+	c.Send(resp.Value{Type: resp.RespInteger, Int: s.rdb.LastSave().Unix()})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/devkarim/goredis/resp"
+	"github.com/devkarim/goredis/storage"
+)
+
+// infoSections are the sections of INFO in the order they are printed, each
+// one returning its "field:value" lines.
+var infoSections = []struct {
+	name   string
+	fields func(s *Server) []string
+}{
+	{"server", serverInfo},
+	{"persistence", persistenceInfo},
+	{"keyspace", keyspaceInfo},
+}
+
+// INFO [section [section ...]]
+func info(s *Server, c *client, args []resp.Value) {
+	wanted := map[string]bool{}
+	for _, arg := range args {
+		wanted[strings.ToLower(arg.Str)] = true
+	}
+	every := len(wanted) == 0 || wanted["default"] || wanted["all"] || wanted["everything"]
+
+	var b strings.Builder
+	for _, section := range infoSections {
+		if !every && !wanted[section.name] {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# " + strings.ToUpper(section.name[:1]) + section.name[1:] + "\r\n")
+		for _, field := range section.fields(s) {
+			b.WriteString(field + "\r\n")
+		}
+	}
+
+	c.Send(resp.Value{Type: resp.RespVerbatim, Str: b.String()})
+}
+
+func serverInfo(s *Server) []string {
+	port := *s.ListenAddr
+	if i := strings.LastIndexByte(port, ':'); i >= 0 {
+		port = port[i+1:]
+	}
+
+	return []string{
+		"redis_version:" + redisVersion,
+		fmt.Sprintf("process_id:%d", os.Getpid()),
+		"tcp_port:" + port,
+		fmt.Sprintf("uptime_in_seconds:%d", int(time.Since(s.started).Seconds())),
+	}
+}
+
+func persistenceInfo(s *Server) []string {
+	rdb := s.rdb.Info()
+	aof := s.aof.Info()
+
+	fields := []string{fmt.Sprintf("loading:%d", boolInt(s.loading.Load()))}
+	if s.loading.Load() {
+		fields = append(fields, loadingInfo(s)...)
+	}
+
+	return append(fields,
+		fmt.Sprintf("rdb_changes_since_last_save:%d", rdb.Changes),
+		fmt.Sprintf("rdb_bgsave_in_progress:%d", boolInt(rdb.Saving)),
+		fmt.Sprintf("rdb_last_save_time:%d", rdb.LastSave.Unix()),
+		"rdb_last_bgsave_status:"+status(rdb.LastErr),
+		"aof_enabled:1",
+		fmt.Sprintf("aof_rewrite_in_progress:%d", boolInt(aof.Rewriting)),
+		"aof_last_bgrewrite_status:"+status(aof.LastRewriteErr),
+		"aof_last_write_status:"+status(aof.LastErr),
+		fmt.Sprintf("aof_current_size:%d", aof.Size),
+		fmt.Sprintf("aof_base_size:%d", aof.BaseSize),
+	)
+}
+
+// loadingInfo estimates when the load ends from its rate so far.
+func loadingInfo(s *Server) []string {
+	loaded, total := s.progress.Loaded(), s.progress.Total()
+	elapsed := time.Since(s.loadingSince)
+
+	eta := 1
+	if loaded > 0 {
+		eta = int(elapsed.Seconds() * float64(total-loaded) / float64(loaded))
+	}
+
+	return []string{
+		fmt.Sprintf("loading_start_time:%d", s.loadingSince.Unix()),
+		fmt.Sprintf("loading_total_bytes:%d", total),
+		fmt.Sprintf("loading_loaded_bytes:%d", loaded),
+		fmt.Sprintf("loading_loaded_perc:%.2f", loadedPercent(loaded, total)),
+		fmt.Sprintf("loading_eta_seconds:%d", eta),
+	}
+}
+
+func keyspaceInfo(s *Server) []string {
+	keys := storage.DBSize()
+	if keys == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("db0:keys=%d,expires=%d,avg_ttl=0", keys, storage.ExpiresSize())}
+}
+
+func status(err error) string {
+	if err != nil {
+		return "err"
+	}
+	return "ok"
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/devkarim/goredis/commands"
+	"github.com/devkarim/goredis/resp"
+	"github.com/devkarim/goredis/storage"
+)
+
+// loadingCommands are the only commands accepted while the dataset is
+// loaded, the others are answered with a LOADING error.
+var loadingCommands = map[string]bool{
+	"INFO":  true,
+	"HELLO": true,
+	"QUIT":  true,
+}
+
+// loadingError is the reply to commands sent while the dataset is loaded.
+var loadingError = resp.Value{Type: resp.RespError, Str: "LOADING GoRedis is loading the dataset in memory"}
+
+// loaderQueueSize is the number of commands a worker of the loader can be
+// behind the reading goroutine.
+const loaderQueueSize = 1024
+
+// loader applies the commands read from the AOF on one worker per shard,
+// while the reading goroutine decodes the following ones. A command on the
+// keys of a single shard is queued to the worker of that shard, so the
+// writes to a key are applied in the order they were logged. Any other
+// command waits for every worker to be done and runs on the reading
+// goroutine, like FLUSHALL or an MSET spanning several shards. The keys of
+// a snapshot are queued to the worker of their shard too.
+type loader struct {
+	queues  []chan loadedCommand
+	pending sync.WaitGroup // commands queued but not applied yet
+	workers sync.WaitGroup
+	keys    atomic.Int64 // keys of snapshots added to the keyspace
+}
+
+// loadedCommand is a command, or a key of a snapshot when obj is set.
+type loadedCommand struct {
+	command commands.Command
+	val     resp.Value
+
+	key      string
+	obj      *storage.RedisObject
+	expireAt int64
+}
+
+func newLoader() *loader {
+	l := &loader{queues: make([]chan loadedCommand, storage.ShardCount)}
+	for i := range l.queues {
+		l.queues[i] = make(chan loadedCommand, loaderQueueSize)
+		l.workers.Add(1)
+		go l.work(l.queues[i])
+	}
+
+	return l
+}
+
+func (l *loader) work(queue chan loadedCommand) {
+	defer l.workers.Done()
+
+	for c := range queue {
+		if c.obj != nil {
+			if storage.LoadKey(c.key, c.obj, c.expireAt) {
+				l.keys.Add(1)
+			}
+		} else {
+			applyCommand(c.command, c.val)
+		}
+		l.pending.Done()
+	}
+}
+
+// apply is the callback of Aof.Read.
+func (l *loader) apply(val resp.Value) {
+	command, ok := commands.Registry[strings.ToUpper(val.Array[0].Str)]
+	if !ok {
+		return
+	}
+
+	shard := -1
+	if !command.AllShards {
+		for _, key := range commandKeys(command, val.Array[1:]) {
+			id := storage.GetShard(key).Id
+			if shard >= 0 && id != shard {
+				shard = -1
+				break
+			}
+			shard = id
+		}
+	}
+	if shard < 0 {
+		l.pending.Wait()
+		applyCommand(command, val)
+		return
+	}
+
+	l.pending.Add(1)
+	l.queues[shard] <- loadedCommand{command: command, val: val}
+}
+
+// loadKey is the callback of the keys of a snapshot.
+func (l *loader) loadKey(key string, obj *storage.RedisObject, expireAt int64) {
+	l.pending.Add(1)
+	l.queues[storage.GetShard(key).Id] <- loadedCommand{key: key, obj: obj, expireAt: expireAt}
+}
+
+// close waits for the queued commands to be applied and stops the workers.
+func (l *loader) close() {
+	for _, queue := range l.queues {
+		close(queue)
+	}
+	l.workers.Wait()
+}
+
+func applyCommand(command commands.Command, val resp.Value) {
+	slog.Debug("Executing from AOF", "command", val)
+	command.Handler(val.Array[1:])
+}
+
+// LOADING_REPORT_TIME is the period of the progress logged while loading.
+const LOADING_REPORT_TIME = time.Second * 1
+
+// reportLoading logs the progress of the load every LOADING_REPORT_TIME
+// until done is closed.
+func (s *Server) reportLoading(done chan struct{}) {
+	ticker := time.NewTicker(LOADING_REPORT_TIME)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			loaded, total := s.progress.Loaded(), s.progress.Total()
+			slog.Info("Loading the dataset", "loadedBytes", loaded, "totalBytes", total,
+				"percent", loadedPercent(loaded, total))
+		}
+	}
+}
+
+func loadedPercent(loaded, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(loaded) * 100 / float64(total)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/devkarim/goredis/commands"
+	"github.com/devkarim/goredis/eviction"
+	"github.com/devkarim/goredis/resp"
+	"github.com/devkarim/goredis/storage"
+)
+
+func TestLoader_KeepsTheOrderOfEachKey(t *testing.T) {
+	var log []resp.Value
+	for i := range 2000 {
+		log = append(log,
+			commands.NewCommand("INCR", "counter:"+strconv.Itoa(i%50)),
+			commands.NewCommand("RPUSH", "list:"+strconv.Itoa(i%20), strconv.Itoa(i)),
+		)
+		if i%500 == 0 {
+			// spans several shards, so it waits for the workers
+			log = append(log, commands.NewCommand("MSET", "counter:1", "0", "counter:2", "0", "counter:3", "0"))
+		}
+	}
+	log = append(log, commands.NewCommand("RENAME", "counter:4", "renamed"), commands.NewCommand("DEL", "counter:5"))
+
+	// what applying the log one command at a time leaves
+	storage.Setup(eviction.PolicyLRU, 1<<30)
+	for _, val := range log {
+		applyCommand(commands.Registry[val.Array[0].Str], val)
+	}
+	want := dump(t)
+
+	storage.Setup(eviction.PolicyLRU, 1<<30)
+	l := newLoader()
+	for _, val := range log {
+		l.apply(val)
+	}
+	l.close()
+
+	got := dump(t)
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %q; want %q", key, got[key], value)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("loaded %d keys; want %d", len(got), len(want))
+	}
+}
+
+// dump returns the values of the keys used by the test.
+func dump(t *testing.T) map[string]string {
+	t.Helper()
+
+	values := map[string]string{}
+	read := func(cmd string, args ...string) resp.Value {
+		return commands.Registry[cmd].Handler(commands.NewCommand(cmd, args...).Array[1:])
+	}
+	for i := range 50 {
+		key := "counter:" + strconv.Itoa(i)
+		if v := read("GET", key); v.Type == resp.RespBulk {
+			values[key] = v.Str
+		}
+	}
+	for i := range 20 {
+		key := "list:" + strconv.Itoa(i)
+		v := read("LRANGE", key, "0", "-1")
+		values[key] = string(v.Marshal(resp.RESP2))
+	}
+	if v := read("GET", "renamed"); v.Type == resp.RespBulk {
+		values["renamed"] = v.Str
+	}
+
+	return values
+}
+
+func TestLoader_AppliesSnapshotKeysBeforeLaterCommands(t *testing.T) {
+	storage.Setup(eviction.PolicyLRU, 1<<30)
+	l := newLoader()
+	for i := range 100 {
+		key := "counter:" + strconv.Itoa(i)
+		l.loadKey(key, &storage.RedisObject{Type: storage.RedisObjectString, Str: "10"}, 0)
+		l.apply(commands.NewCommand("INCR", key))
+	}
+	l.loadKey("expired", &storage.RedisObject{Type: storage.RedisObjectString, Str: "1"}, 1)
+	l.close()
+
+	if n := l.keys.Load(); n != 100 {
+		t.Errorf("loaded %d keys; want 100, the expired one skipped", n)
+	}
+	for i := range 100 {
+		key := "counter:" + strconv.Itoa(i)
+		if v, _, _ := storage.GetShard(key).GetString(key); v != "11" {
+			t.Errorf("%s = %q; want 11", key, v)
+		}
+	}
+}
@@ -2,11 +2,16 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/devkarim/goredis/core"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check-aof" {
+		os.Exit(checkAof(os.Args[2:]))
+	}
+
 	cfg, err := core.LoadConfig()
 	if err != nil {
 		log.Fatal(err)
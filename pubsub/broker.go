@@ -0,0 +1,134 @@
+package pubsub
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/devkarim/goredis/glob"
+	"github.com/devkarim/goredis/resp"
+)
+
+// Subscriber receives the messages published to the channels and patterns
+// its subscription listens on. Push must not block.
+type Subscriber interface {
+	Push(v resp.Value)
+}
+
+type Broker struct {
+	mu       sync.RWMutex
+	channels map[string]map[*Subscription]struct{}
+	patterns map[string]map[*Subscription]struct{}
+}
+
+var broker = NewBroker()
+
+func NewBroker() *Broker {
+	return &Broker{
+		channels: map[string]map[*Subscription]struct{}{},
+		patterns: map[string]map[*Subscription]struct{}{},
+	}
+}
+
+func bulk(str string) resp.Value {
+	return resp.Value{Type: resp.RespBulk, Str: str}
+}
+
+// Publish delivers message to every subscriber of channel and of any
+// pattern matching it, returning the number of deliveries.
+func (b *Broker) Publish(channel, message string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	receivers := 0
+
+	for sub := range b.channels[channel] {
+		sub.subscriber.Push(resp.Value{Type: resp.RespPush, Array: []resp.Value{
+			bulk("message"), bulk(channel), bulk(message),
+		}})
+		receivers++
+	}
+
+	for pattern, subs := range b.patterns {
+		if !glob.Match(pattern, channel) {
+			continue
+		}
+		for sub := range subs {
+			sub.subscriber.Push(resp.Value{Type: resp.RespPush, Array: []resp.Value{
+				bulk("pmessage"), bulk(pattern), bulk(channel), bulk(message),
+			}})
+			receivers++
+		}
+	}
+
+	return receivers
+}
+
+// Channels returns the channels with at least one subscriber matching
+// pattern, or all of them when pattern is empty.
+func (b *Broker) Channels(pattern string) []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	arr := []string{}
+	for channel := range b.channels {
+		if pattern == "" || glob.Match(pattern, channel) {
+			arr = append(arr, channel)
+		}
+	}
+	slices.Sort(arr)
+
+	return arr
+}
+
+func (b *Broker) NumSub(channel string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return len(b.channels[channel])
+}
+
+// NumPat returns the number of distinct patterns subscribed to.
+func (b *Broker) NumPat() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return len(b.patterns)
+}
+
+func (b *Broker) add(index map[string]map[*Subscription]struct{}, name string, sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs, ok := index[name]
+	if !ok {
+		subs = map[*Subscription]struct{}{}
+		index[name] = subs
+	}
+	subs[sub] = struct{}{}
+}
+
+func (b *Broker) remove(index map[string]map[*Subscription]struct{}, name string, sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(index[name], sub)
+	if len(index[name]) == 0 {
+		delete(index, name)
+	}
+}
+
+func Publish(channel, message string) int {
+	return broker.Publish(channel, message)
+}
+
+func Channels(pattern string) []string {
+	return broker.Channels(pattern)
+}
+
+func NumSub(channel string) int {
+	return broker.NumSub(channel)
+}
+
+func NumPat() int {
+	return broker.NumPat()
+}
@@ -0,0 +1,73 @@
+package pubsub
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/devkarim/goredis/resp"
+)
+
+type recorder struct {
+	pushed []resp.Value
+}
+
+func (r *recorder) Push(v resp.Value) {
+	r.pushed = append(r.pushed, v)
+}
+
+func (r *recorder) last() []string {
+	v := r.pushed[len(r.pushed)-1]
+	arr := make([]string, len(v.Array))
+	for i, el := range v.Array {
+		arr[i] = el.Str
+	}
+	return arr
+}
+
+func TestBroker_PublishToChannelsAndPatterns(t *testing.T) {
+	b := NewBroker()
+	a, p := &recorder{}, &recorder{}
+
+	b.NewSubscription(a).Subscribe("news")
+	b.NewSubscription(p).PSubscribe("n*")
+
+	if got := b.Publish("news", "hello"); got != 2 {
+		t.Errorf("Publish = %d; want 2", got)
+	}
+
+	if got := a.last(); !slices.Equal(got, []string{"message", "news", "hello"}) {
+		t.Errorf("channel subscriber got %v", got)
+	}
+	if got := p.last(); !slices.Equal(got, []string{"pmessage", "n*", "news", "hello"}) {
+		t.Errorf("pattern subscriber got %v", got)
+	}
+
+	if got := b.Publish("sports", "goal"); got != 0 {
+		t.Errorf("Publish = %d; want 0", got)
+	}
+}
+
+func TestSubscription_UnsubscribeAll(t *testing.T) {
+	b := NewBroker()
+	r := &recorder{}
+	sub := b.NewSubscription(r)
+
+	sub.Subscribe("a", "b")
+	sub.PSubscribe("c*")
+	if sub.Count() != 3 {
+		t.Errorf("Count = %d; want 3", sub.Count())
+	}
+
+	sub.Unsubscribe()
+	if sub.Count() != 1 {
+		t.Errorf("Count = %d; want 1", sub.Count())
+	}
+	if got := b.Channels(""); len(got) != 0 {
+		t.Errorf("Channels = %v; want none", got)
+	}
+
+	sub.Close()
+	if b.NumPat() != 0 {
+		t.Errorf("NumPat = %d; want 0", b.NumPat())
+	}
+}
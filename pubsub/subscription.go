@@ -0,0 +1,127 @@
+package pubsub
+
+import (
+	"slices"
+
+	"github.com/devkarim/goredis/resp"
+)
+
+// Subscription tracks the channels and patterns of a single connection.
+// It is only used from the goroutine serving that connection.
+type Subscription struct {
+	broker     *Broker
+	subscriber Subscriber
+	channels   map[string]struct{}
+	patterns   map[string]struct{}
+}
+
+func NewSubscription(sub Subscriber) *Subscription {
+	return broker.NewSubscription(sub)
+}
+
+func (b *Broker) NewSubscription(sub Subscriber) *Subscription {
+	return &Subscription{
+		broker:     b,
+		subscriber: sub,
+		channels:   map[string]struct{}{},
+		patterns:   map[string]struct{}{},
+	}
+}
+
+// Count returns the number of channels and patterns subscribed to, a
+// connection stays in subscriber mode while it is positive.
+func (s *Subscription) Count() int {
+	return len(s.channels) + len(s.patterns)
+}
+
+// confirm pushes the [kind, name, count] reply sent for every (un)subscription.
+func (s *Subscription) confirm(kind string, name *string) {
+	target := resp.Value{Type: resp.RespNil}
+	if name != nil {
+		target = bulk(*name)
+	}
+
+	s.subscriber.Push(resp.Value{Type: resp.RespPush, Array: []resp.Value{
+		bulk(kind), target, {Type: resp.RespInteger, Int: int64(s.Count())},
+	}})
+}
+
+func (s *Subscription) Subscribe(channels ...string) {
+	for _, channel := range channels {
+		if _, ok := s.channels[channel]; !ok {
+			s.channels[channel] = struct{}{}
+			s.broker.add(s.broker.channels, channel, s)
+		}
+		s.confirm("subscribe", &channel)
+	}
+}
+
+// Unsubscribe removes the given channels, or every channel when none is given.
+func (s *Subscription) Unsubscribe(channels ...string) {
+	if len(channels) == 0 {
+		channels = sortedKeys(s.channels)
+		if len(channels) == 0 {
+			s.confirm("unsubscribe", nil)
+			return
+		}
+	}
+
+	for _, channel := range channels {
+		if _, ok := s.channels[channel]; ok {
+			delete(s.channels, channel)
+			s.broker.remove(s.broker.channels, channel, s)
+		}
+		s.confirm("unsubscribe", &channel)
+	}
+}
+
+func (s *Subscription) PSubscribe(patterns ...string) {
+	for _, pattern := range patterns {
+		if _, ok := s.patterns[pattern]; !ok {
+			s.patterns[pattern] = struct{}{}
+			s.broker.add(s.broker.patterns, pattern, s)
+		}
+		s.confirm("psubscribe", &pattern)
+	}
+}
+
+// PUnsubscribe removes the given patterns, or every pattern when none is given.
+func (s *Subscription) PUnsubscribe(patterns ...string) {
+	if len(patterns) == 0 {
+		patterns = sortedKeys(s.patterns)
+		if len(patterns) == 0 {
+			s.confirm("punsubscribe", nil)
+			return
+		}
+	}
+
+	for _, pattern := range patterns {
+		if _, ok := s.patterns[pattern]; ok {
+			delete(s.patterns, pattern)
+			s.broker.remove(s.broker.patterns, pattern, s)
+		}
+		s.confirm("punsubscribe", &pattern)
+	}
+}
+
+// Close drops every subscription without sending confirmations, used when
+// the connection goes away.
+func (s *Subscription) Close() {
+	for channel := range s.channels {
+		s.broker.remove(s.broker.channels, channel, s)
+	}
+	for pattern := range s.patterns {
+		s.broker.remove(s.broker.patterns, pattern, s)
+	}
+	clear(s.channels)
+	clear(s.patterns)
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	arr := make([]string, 0, len(m))
+	for key := range m {
+		arr = append(arr, key)
+	}
+	slices.Sort(arr)
+	return arr
+}
@@ -2,14 +2,43 @@ package resp
 
 import (
 	"bufio"
-	"fmt"
+	"bytes"
+	"errors"
 	"io"
-	"log/slog"
+	"math/big"
+	"slices"
 	"strconv"
 )
 
+// bulkChunk is the most memory allocated for a bulk string before its data
+// has arrived, larger ones double their buffer as they are read.
+const bulkChunk = 64 * 1024
+
+// maxInlineSize bounds the length of an inline command, like Redis.
+const maxInlineSize = 64 * 1024
+
+// maxLineSize bounds the length of the other lines, such as the header of
+// a value or a simple string.
+const maxLineSize = 64 * 1024
+
+// ProtocolError is returned for malformed input. The stream cannot be
+// resynchronized after it, so the connection should be closed.
+type ProtocolError string
+
+func (e ProtocolError) Error() string {
+	return "Protocol error: " + string(e)
+}
+
+// Limits bound the commands read by ReadCommand, a zero field is unlimited.
+type Limits struct {
+	MaxBulkLen       int // largest bulk string argument
+	MaxMultiBulkLen  int // most arguments in a command
+	QueryBufferLimit int // largest command, counting the arguments only
+}
+
 type Reader struct {
 	reader *bufio.Reader
+	limits Limits
 }
 
 func NewReader(rd io.Reader) *Reader {
@@ -18,32 +47,288 @@ func NewReader(rd io.Reader) *Reader {
 	}
 }
 
+// SetLimits sets the limits enforced by ReadCommand.
+func (r *Reader) SetLimits(limits Limits) {
+	r.limits = limits
+}
+
+// Buffered returns the number of bytes already received but not parsed yet,
+// zero once a pipeline has been fully read.
+func (r *Reader) Buffered() int {
+	return r.reader.Buffered()
+}
+
+// Peek returns the next n bytes without consuming them.
+func (r *Reader) Peek(n int) ([]byte, error) {
+	return r.reader.Peek(n)
+}
+
+// ReadLine reads a line that is not a value, such as an annotation of an
+// AOF, and returns it without its \r\n.
+func (r *Reader) ReadLine() ([]byte, error) {
+	line, _, err := r.readLine()
+	return bytes.Clone(line), err
+}
+
+// Read parses the next value of any RESP2 or RESP3 type. Attributes are
+// skipped and blob errors are returned as RespError values.
 func (r *Reader) Read() (Value, error) {
 	_type, err := r.reader.ReadByte()
-
 	if err != nil {
 		return Value{}, err
 	}
 
-	switch _type {
-	case byte(RespArray):
-		return r.readArray()
-	case byte(RespBulk):
-		return r.readBulk()
+	switch RespDataType(_type) {
+	case RespString, RespError, RespBigNumber:
+		return r.readSimple(RespDataType(_type))
+	case RespInteger:
+		return r.readInteger()
+	case RespBulk, RespVerbatim:
+		return r.readBulk(RespDataType(_type))
+	case RespArray, RespSet, RespPush:
+		return r.readArray(RespDataType(_type))
+	case RespMap:
+		return r.readMap()
+	case RespNil:
+		return r.readNull()
+	case RespDouble:
+		return r.readDouble()
+	case RespBoolean:
+		return r.readBoolean()
+	case '!':
+		v, err := r.readBulk(RespBulk)
+		v.Type = RespError
+		return v, err
+	case '|':
+		if _, err := r.readMap(); err != nil {
+			return Value{}, err
+		}
+		return r.Read()
 	default:
-		slog.Error("Invalid type", "type", string(_type))
-		return Value{}, nil
+		return Value{}, ProtocolError("unexpected type byte " + strconv.QuoteRune(rune(_type)))
+	}
+}
+
+// ReadCommand parses the next request of a client: an array of bulk strings,
+// or an inline command such as the ones typed in telnet. Empty requests are
+// skipped.
+func (r *Reader) ReadCommand() (Value, error) {
+	for {
+		first, err := r.reader.Peek(1)
+		if err != nil {
+			return Value{}, err
+		}
+
+		var v Value
+		if first[0] == byte(RespArray) {
+			v, err = r.readMultiBulk()
+		} else {
+			v, err = r.readInline()
+		}
+		if err != nil || len(v.Array) > 0 {
+			return v, err
+		}
+	}
+}
+
+// *<number-of-arguments>\r\n$<length>\r\n<argument>\r\n...
+func (r *Reader) readMultiBulk() (Value, error) {
+	r.reader.ReadByte()
+
+	n, err := r.readInt()
+	if _, ok := err.(ProtocolError); ok || (r.limits.MaxMultiBulkLen > 0 && n > r.limits.MaxMultiBulkLen) {
+		return Value{}, ProtocolError("invalid multibulk length")
+	}
+	if err != nil {
+		return Value{}, err
+	}
+
+	// the slices only grow as arguments arrive, whatever the headers claim
+	v := Value{Type: RespArray, Array: make([]Value, 0)}
+	size := 0
+	for range max(n, 0) {
+		_type, err := r.reader.ReadByte()
+		if err != nil {
+			return v, unexpectedEOF(err)
+		}
+		if _type != byte(RespBulk) {
+			return v, ProtocolError("expected '$', got " + strconv.QuoteRune(rune(_type)))
+		}
+
+		length, err := r.readInt()
+		if _, ok := err.(ProtocolError); ok || length < 0 || (r.limits.MaxBulkLen > 0 && length > r.limits.MaxBulkLen) {
+			return v, ProtocolError("invalid bulk length")
+		}
+		if err != nil {
+			return v, err
+		}
+
+		size += length
+		if r.limits.QueryBufferLimit > 0 && size > r.limits.QueryBufferLimit {
+			return v, ProtocolError("query buffer limit exceeded")
+		}
+
+		arg, err := r.readBulkData(RespBulk, length)
+		if err != nil {
+			return v, err
+		}
+		v.Array = append(v.Array, arg)
+	}
+
+	return v, nil
+}
+
+// readInline parses a line of space separated arguments, which may be quoted.
+func (r *Reader) readInline() (Value, error) {
+	line, err := r.readSlice(maxInlineSize)
+	if errors.Is(err, errLineTooLong) {
+		return Value{}, ProtocolError("too big inline request")
+	}
+	if err != nil {
+		return Value{}, err
+	}
+
+	args, ok := splitArgs(string(bytes.TrimRight(line, "\r\n")))
+	if !ok {
+		return Value{}, ProtocolError("unbalanced quotes in request")
+	}
+
+	v := Value{Type: RespArray, Array: make([]Value, len(args))}
+	for i, arg := range args {
+		v.Array[i] = Value{Type: RespBulk, Str: arg}
+	}
+
+	return v, nil
+}
+
+// splitArgs splits an inline command the way redis-cli does: arguments are
+// separated by spaces, double quotes allow escapes such as \n or \x41 and
+// single quotes only \'.
+func splitArgs(line string) ([]string, bool) {
+	args := []string{}
+
+	for i := 0; ; {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, true
+		}
+
+		var arg []byte
+		quote := byte(0)
+	arg:
+		for ; i < len(line); i++ {
+			c := line[i]
+			switch {
+			case quote == '"' && c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]):
+				n, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+				arg = append(arg, byte(n))
+				i += 3
+			case quote == '"' && c == '\\' && i+1 < len(line):
+				i++
+				arg = append(arg, unescape(line[i]))
+			case quote == '\'' && c == '\\' && i+1 < len(line) && line[i+1] == '\'':
+				i++
+				arg = append(arg, '\'')
+			case quote != 0 && c == quote:
+				// the closing quote must end the argument
+				if i+1 < len(line) && !isSpace(line[i+1]) {
+					return nil, false
+				}
+				quote = 0
+				i++
+				break arg
+			case quote != 0:
+				arg = append(arg, c)
+			case isSpace(c):
+				break arg
+			case (c == '"' || c == '\'') && len(arg) == 0:
+				quote = c
+			default:
+				arg = append(arg, c)
+			}
+		}
+		if quote != 0 {
+			return nil, false
+		}
+		args = append(args, string(arg))
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unescape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'a':
+		return '\a'
 	}
+	return c
 }
 
+// unexpectedEOF reports a stream ending in the middle of a value.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+var errLineTooLong = errors.New("line too long")
+
+// readSlice reads up to and including the next \n, returning errLineTooLong
+// once the line is longer than limit. The line may point into the buffer of
+// the reader, so it is only valid until the next read.
+func (r *Reader) readSlice(limit int) ([]byte, error) {
+	line, err := r.reader.ReadSlice('\n')
+	if err == nil {
+		return line, nil
+	}
+
+	// the line does not fit in the buffer, gather it chunk by chunk
+	line = bytes.Clone(line)
+	for errors.Is(err, bufio.ErrBufferFull) && len(line) <= limit {
+		var chunk []byte
+		chunk, err = r.reader.ReadSlice('\n')
+		line = append(line, chunk...)
+	}
+	if len(line) > limit {
+		return nil, errLineTooLong
+	}
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return line, nil
+}
+
+// readLine reads a line ending with \r\n, which it returns without them
+// along with the number of bytes consumed. The line is only valid until the
+// next read.
 func (r *Reader) readLine() (line []byte, n int, err error) {
-	line, err = r.reader.ReadBytes('\n')
+	line, err = r.readSlice(maxLineSize)
+	if errors.Is(err, errLineTooLong) {
+		return nil, 0, ProtocolError("too big line")
+	}
 	if err != nil {
 		return nil, 0, err
 	}
 	n = len(line)
 	if n < 2 || line[n-2] != '\r' {
-		return nil, 0, fmt.Errorf("protocol error: line must end with \\r\\n")
+		return nil, 0, ProtocolError("line must end with \\r\\n")
 	}
 	return line[:n-2], n, nil
 }
@@ -55,27 +340,59 @@ func (r *Reader) readInt() (x int, err error) {
 	}
 	x, err = strconv.Atoi(string(line))
 	if err != nil {
-		return 0, err
+		return 0, ProtocolError("invalid length " + strconv.Quote(string(line)))
 	}
 	return x, nil
 }
 
-// *<number-of-elements>\r\n<element-1>...<element-n>
-func (r *Reader) readArray() (Value, error) {
-	v := Value{
-		Type: RespArray,
+// +OK\r\n, -Error message\r\n or (<big-number>\r\n
+func (r *Reader) readSimple(typ RespDataType) (Value, error) {
+	line, _, err := r.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+	if typ == RespBigNumber {
+		if _, ok := new(big.Int).SetString(string(line), 10); !ok {
+			return Value{}, ProtocolError("invalid big number")
+		}
+	}
+
+	return Value{Type: typ, Str: string(line)}, nil
+}
+
+// :<number>\r\n
+func (r *Reader) readInteger() (Value, error) {
+	line, _, err := r.readLine()
+	if err != nil {
+		return Value{}, err
 	}
+	n, err := strconv.ParseInt(string(line), 10, 64)
+	if err != nil {
+		return Value{}, ProtocolError("invalid integer")
+	}
+
+	return Value{Type: RespInteger, Int: n}, nil
+}
 
+// *<number-of-elements>\r\n<element-1>...<element-n>, *-1\r\n for a nil
+// array. Sets (~) and pushes (>) share the layout.
+func (r *Reader) readArray(typ RespDataType) (Value, error) {
 	n, err := r.readInt()
 	if err != nil {
-		return v, err
+		return Value{}, err
+	}
+	if n == -1 && typ == RespArray {
+		return Value{Type: RespNil, NullArray: true}, nil
+	}
+	if n < 0 {
+		return Value{}, ProtocolError("invalid multibulk length")
 	}
 
-	v.Array = make([]Value, 0)
+	v := Value{Type: typ, Array: make([]Value, 0)}
 	for range n {
 		val, err := r.Read()
 		if err != nil {
-			return v, err
+			return v, unexpectedEOF(err)
 		}
 
 		v.Array = append(v.Array, val)
@@ -84,24 +401,110 @@ func (r *Reader) readArray() (Value, error) {
 	return v, nil
 }
 
-// $<length>\r\n<data>\r\n
-func (r *Reader) readBulk() (Value, error) {
-	v := Value{
-		Type: RespBulk,
+// %<number-of-entries>\r\n<key-1><value-1>...<key-n><value-n>
+func (r *Reader) readMap() (Value, error) {
+	n, err := r.readInt()
+	if err != nil {
+		return Value{}, err
+	}
+	if n < 0 {
+		return Value{}, ProtocolError("invalid map length")
 	}
 
+	v := Value{Type: RespMap, Array: make([]Value, 0)}
+	for range 2 * n {
+		val, err := r.Read()
+		if err != nil {
+			return v, unexpectedEOF(err)
+		}
+
+		v.Array = append(v.Array, val)
+	}
+
+	return v, nil
+}
+
+// $<length>\r\n<data>\r\n, $-1\r\n for a nil bulk string. Verbatim strings
+// (=) share the layout, their data starting with "fmt:".
+func (r *Reader) readBulk(typ RespDataType) (Value, error) {
 	n, err := r.readInt()
 	if err != nil {
-		return v, err
+		return Value{}, err
+	}
+	if n == -1 && typ == RespBulk {
+		return Value{Type: RespNil}, nil
+	}
+	if n < 0 {
+		return Value{}, ProtocolError("invalid bulk length")
 	}
 
-	bulk := make([]byte, n)
-	r.reader.Read(bulk)
+	return r.readBulkData(typ, n)
+}
 
-	v.Str = string(bulk)
+// readBulkData reads the n bytes of a bulk string along with their \r\n,
+// however many reads it takes. The buffer grows as the data arrives rather
+// than being sized up front from the header.
+func (r *Reader) readBulkData(typ RespDataType, n int) (Value, error) {
+	bulk := make([]byte, 0, min(n+2, bulkChunk))
+	for len(bulk) < n+2 {
+		next := min(max(2*len(bulk), bulkChunk), n+2)
+		bulk = slices.Grow(bulk, next-len(bulk))
+		if _, err := io.ReadFull(r.reader, bulk[len(bulk):next]); err != nil {
+			return Value{}, unexpectedEOF(err)
+		}
+		bulk = bulk[:next]
+	}
+	if bulk[n] != '\r' || bulk[n+1] != '\n' {
+		return Value{}, ProtocolError("bulk string must end with \\r\\n")
+	}
 
-	r.readLine()
+	v := Value{Type: typ, Str: string(bulk[:n])}
+	if typ == RespVerbatim {
+		if n < 4 || v.Str[3] != ':' {
+			return Value{}, ProtocolError("invalid verbatim string")
+		}
+		v.Format, v.Str = v.Str[:3], v.Str[4:]
+	}
 
 	return v, nil
 }
 
+// _\r\n
+func (r *Reader) readNull() (Value, error) {
+	line, _, err := r.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+	if len(line) != 0 {
+		return Value{}, ProtocolError("invalid null")
+	}
+
+	return Value{Type: RespNil}, nil
+}
+
+// ,<floating-point-number>\r\n
+func (r *Reader) readDouble() (Value, error) {
+	line, _, err := r.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+	f, err := strconv.ParseFloat(string(line), 64)
+	if err != nil {
+		return Value{}, ProtocolError("invalid double")
+	}
+
+	return Value{Type: RespDouble, Float: f}, nil
+}
+
+// #t\r\n or #f\r\n
+func (r *Reader) readBoolean() (Value, error) {
+	line, _, err := r.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+	if len(line) != 1 || (line[0] != 't' && line[0] != 'f') {
+		return Value{}, ProtocolError("invalid boolean")
+	}
+
+	return Value{Type: RespBoolean, Bool: line[0] == 't'}, nil
+}
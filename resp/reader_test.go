@@ -0,0 +1,141 @@
+package resp
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestRead_AllTypes(t *testing.T) {
+	values := []Value{
+		{Type: RespString, Str: "OK"},
+		{Type: RespError, Str: "ERR oops"},
+		{Type: RespInteger, Int: -42},
+		{Type: RespBulk, Str: "with\r\nnewline"},
+		{Type: RespBulk, Str: strings.Repeat("x", 3*bulkChunk+1)},
+		{Type: RespNil},
+		{Type: RespNil, NullArray: true},
+		{Type: RespDouble, Float: 3.25},
+		{Type: RespBoolean, Bool: true},
+		{Type: RespBigNumber, Str: "-123456789012345678901234567890"},
+		{Type: RespVerbatim, Format: "mkd", Str: "# title"},
+		{Type: RespArray, Array: []Value{{Type: RespInteger, Int: 1}, {Type: RespBulk, Str: "two"}}},
+		{Type: RespMap, Array: []Value{{Type: RespBulk, Str: "k"}, {Type: RespBoolean}}},
+		{Type: RespSet, Array: []Value{{Type: RespBulk, Str: "m"}}},
+		{Type: RespPush, Array: []Value{{Type: RespBulk, Str: "message"}}},
+	}
+
+	var stream []byte
+	for _, v := range values {
+		stream = append(stream, v.Marshal(RESP3)...)
+	}
+	stream = append(stream, "*-1\r\n"...)
+
+	// a reader returning one byte at a time exercises every short read
+	r := NewReader(iotest.OneByteReader(strings.NewReader(string(stream))))
+	for _, want := range values {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("Read(%q) error: %v", want.Marshal(RESP3), err)
+		}
+		if string(got.Marshal(RESP3)) != string(want.Marshal(RESP3)) {
+			t.Errorf("Read = %q; want %q", got.Marshal(RESP3), want.Marshal(RESP3))
+		}
+	}
+	if got, _ := r.Read(); got.Type != RespNil || !got.NullArray {
+		t.Errorf("Read(*-1) = %+v; want a nil array", got)
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("Read at the end = %v; want EOF", err)
+	}
+}
+
+func TestReadCommand_Inline(t *testing.T) {
+	r := NewReader(strings.NewReader("\r\n  SET  k \"a b\\x41\\n\" 'it\\'s' \"\"\r\nPING\n"))
+
+	want := [][]string{{"SET", "k", "a bA\n", "it's", ""}, {"PING"}}
+	for _, args := range want {
+		v, err := r.ReadCommand()
+		if err != nil {
+			t.Fatalf("ReadCommand error: %v", err)
+		}
+		if len(v.Array) != len(args) {
+			t.Fatalf("ReadCommand = %+v; want %q", v.Array, args)
+		}
+		for i, arg := range args {
+			if v.Array[i].Type != RespBulk || v.Array[i].Str != arg {
+				t.Errorf("argument %d = %q; want %q", i, v.Array[i].Str, arg)
+			}
+		}
+	}
+}
+
+func TestReadCommand_ProtocolErrors(t *testing.T) {
+	tests := map[string]string{
+		"*x\r\n":                          "invalid multibulk length",
+		"*1\r\n:1\r\n":                    "expected '$', got ':'",
+		"*1\r\n$-1\r\n":                   "invalid bulk length",
+		"*1\r\n$2\r\nabc\r\n":             "bulk string must end with \\r\\n",
+		"GET \"open\r\n":                  "unbalanced quotes in request",
+		"GET \"a\"b\r\n":                  "unbalanced quotes in request",
+		strings.Repeat("a", 70000) + "\n": "too big inline request",
+	}
+
+	for input, want := range tests {
+		_, err := NewReader(strings.NewReader(input)).ReadCommand()
+		var protoErr ProtocolError
+		if !errors.As(err, &protoErr) || string(protoErr) != want {
+			t.Errorf("ReadCommand(%.20q) error = %v; want %q", input, err, want)
+		}
+	}
+
+	_, err := NewReader(strings.NewReader("*2\r\n$3\r\nGET\r\n$5\r\nab")).ReadCommand()
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadCommand of a truncated command = %v; want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	// a line that never ends must not be buffered forever
+	endless := io.MultiReader(strings.NewReader("+"), repeatReader('a'))
+	_, err = NewReader(endless).Read()
+	if want := ProtocolError("too big line"); err != want {
+		t.Errorf("Read of an endless line = %v; want %v", err, want)
+	}
+}
+
+// repeatReader is an endless stream of the same byte.
+type repeatReader byte
+
+func (b repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(b)
+	}
+	return len(p), nil
+}
+
+func TestReadCommand_Limits(t *testing.T) {
+	limits := Limits{MaxBulkLen: 10, MaxMultiBulkLen: 3, QueryBufferLimit: 15}
+	tests := map[string]string{
+		"*2147483647\r\n":      "invalid multibulk length",
+		"*4\r\n":               "invalid multibulk length",
+		"*1\r\n$999999999\r\n": "invalid bulk length",
+		"*2\r\n$10\r\n0123456789\r\n$8\r\n01234567\r\n": "query buffer limit exceeded",
+	}
+
+	for input, want := range tests {
+		r := NewReader(strings.NewReader(input))
+		r.SetLimits(limits)
+		_, err := r.ReadCommand()
+		var protoErr ProtocolError
+		if !errors.As(err, &protoErr) || string(protoErr) != want {
+			t.Errorf("ReadCommand(%.20q) error = %v; want %q", input, err, want)
+		}
+	}
+
+	r := NewReader(strings.NewReader("*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$10\r\n0123456789\r\n"))
+	r.SetLimits(limits)
+	if v, err := r.ReadCommand(); err != nil || len(v.Array) != 3 {
+		t.Errorf("ReadCommand within the limits = %+v, %v", v, err)
+	}
+}
@@ -1,97 +1,227 @@
 package resp
 
-import "strconv"
+import (
+	"math"
+	"strconv"
+)
 
 type RespDataType byte
 
 const (
-	RespString RespDataType = '+'
-	RespArray  RespDataType = '*'
-	RespBulk   RespDataType = '$'
-	RespError  RespDataType = '-'
-	RespNil    RespDataType = '_'
+	RespString    RespDataType = '+'
+	RespArray     RespDataType = '*'
+	RespBulk      RespDataType = '$'
+	RespError     RespDataType = '-'
+	RespInteger   RespDataType = ':'
+	RespNil       RespDataType = '_'
+	RespDouble    RespDataType = ','
+	RespBoolean   RespDataType = '#'
+	RespMap       RespDataType = '%'
+	RespSet       RespDataType = '~'
+	RespBigNumber RespDataType = '('
+	RespVerbatim  RespDataType = '='
+	RespPush      RespDataType = '>'
+)
+
+// Protocol versions a connection can negotiate with HELLO. RESP3 types are
+// downgraded to their closest RESP2 equivalent when marshaled for RESP2.
+const (
+	RESP2 = 2
+	RESP3 = 3
 )
 
 type Value struct {
 	Type  RespDataType
-	Str   string
-	Array []Value
+	Str   string // also the digits of a big number and the text of a verbatim string
+	Int   int64
+	Float float64 // RespDouble
+	Bool  bool    // RespBoolean
+	Array []Value // elements of arrays, sets and pushes, alternating keys and values of maps
+
+	// Format is the three letter format of a verbatim string, "txt" when empty.
+	Format string
+
+	// NullArray marks a RespNil standing for a missing array, which RESP2
+	// encodes as *-1 rather than $-1.
+	NullArray bool
+
+	// Pairs marks an array of two element arrays, such as members and their
+	// scores, which RESP2 flattens into a single array.
+	Pairs bool
 }
 
-func (v *Value) Marshal() []byte {
+// FormatDouble renders a float the way Redis replies with scores: integral
+// values without a fraction or exponent, everything else in its shortest form.
+func FormatDouble(f float64) string {
+	return string(appendDouble(nil, f))
+}
+
+func appendDouble(dst []byte, f float64) []byte {
+	switch {
+	case math.IsInf(f, 1):
+		return append(dst, "inf"...)
+	case math.IsInf(f, -1):
+		return append(dst, "-inf"...)
+	case math.IsNaN(f):
+		return append(dst, "nan"...)
+	case f == math.Trunc(f) && math.Abs(f) < 1e17:
+		return strconv.AppendFloat(dst, f, 'f', -1, 64)
+	}
+
+	return strconv.AppendFloat(dst, f, 'g', -1, 64)
+}
+
+// Marshal encodes v for a connection speaking the given protocol version.
+func (v *Value) Marshal(proto int) []byte {
+	return v.Append(nil, proto)
+}
+
+// Append encodes v like Marshal, appending to dst and returning the extended
+// buffer. Encoding into a reused buffer does not allocate.
+func (v *Value) Append(dst []byte, proto int) []byte {
+	resp3 := proto >= RESP3
+
 	switch v.Type {
-	case RespString:
-		return v.marshalString()
+	case RespString, RespError:
+		return appendLine(dst, v.Type, v.Str)
 	case RespArray:
-		return v.marshalArray()
+		if v.Pairs && !resp3 {
+			return v.appendFlattened(dst, proto)
+		}
+		return v.appendArray(dst, RespArray, len(v.Array), proto)
 	case RespBulk:
-		return v.marshalBulk()
-	case RespError:
-		return v.marshalError()
+		return appendBulk(dst, RespBulk, "", v.Str)
+	case RespInteger:
+		return appendInteger(dst, v.Int)
 	case RespNil:
-		return v.marshalNil()
+		return v.appendNil(dst, proto)
+	case RespDouble:
+		var scratch [32]byte
+		num := appendDouble(scratch[:0], v.Float)
+		if !resp3 {
+			return appendBulk(dst, RespBulk, "", num)
+		}
+		return appendLine(dst, RespDouble, num)
+	case RespBoolean:
+		if !resp3 {
+			return appendInteger(dst, boolToInt(v.Bool))
+		}
+		return appendBoolean(dst, v.Bool)
+	case RespMap:
+		if !resp3 {
+			return v.appendArray(dst, RespArray, len(v.Array), proto)
+		}
+		return v.appendArray(dst, RespMap, len(v.Array)/2, proto)
+	case RespSet, RespPush:
+		if !resp3 {
+			return v.appendArray(dst, RespArray, len(v.Array), proto)
+		}
+		return v.appendArray(dst, v.Type, len(v.Array), proto)
+	case RespBigNumber:
+		if !resp3 {
+			return appendBulk(dst, RespBulk, "", v.Str)
+		}
+		return appendLine(dst, RespBigNumber, v.Str)
+	case RespVerbatim:
+		if !resp3 {
+			return appendBulk(dst, RespBulk, "", v.Str)
+		}
+		format := v.Format
+		if format == "" {
+			format = "txt"
+		}
+		return appendBulk(dst, RespVerbatim, format, v.Str)
 	default:
-		return []byte{}
+		return dst
 	}
 }
 
-// +OK\r\n
-func (v *Value) marshalString() []byte {
-	var bytes []byte
-
-	bytes = append(bytes, byte(RespString))
-	bytes = append(bytes, v.Str...)
-	bytes = append(bytes, '\r', '\n')
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
 
-	return bytes
+// +OK\r\n, -Error message\r\n, ,<floating-point-number>\r\n or (<big-number>\r\n
+func appendLine[T string | []byte](dst []byte, typ RespDataType, line T) []byte {
+	dst = append(dst, byte(typ))
+	dst = append(dst, line...)
+	return append(dst, '\r', '\n')
 }
 
 // *<number-of-elements>\r\n<element-1>...<element-n>
-func (v *Value) marshalArray() []byte {
-	length := len(v.Array)
-	var bytes []byte
-
-	bytes = append(bytes, byte(RespArray))
-	bytes = append(bytes, strconv.Itoa(length)...)
-	bytes = append(bytes, '\r', '\n')
-
-	for i := range length {
-		bytes = append(bytes, v.Array[i].Marshal()...)
+// The same layout is used by maps (%), sets (~) and pushes (>), a map
+// counting its key value pairs rather than its elements.
+func (v *Value) appendArray(dst []byte, typ RespDataType, length int, proto int) []byte {
+	dst = append(dst, byte(typ))
+	dst = strconv.AppendInt(dst, int64(length), 10)
+	dst = append(dst, '\r', '\n')
+
+	for i := range v.Array {
+		dst = v.Array[i].Append(dst, proto)
 	}
 
-	return bytes
+	return dst
 }
 
-// $<length>\r\n<data>\r\n
-func (v *Value) marshalBulk() []byte {
-	var bytes []byte
+// appendFlattened encodes an array of pairs as the array of their elements.
+func (v *Value) appendFlattened(dst []byte, proto int) []byte {
+	dst = append(dst, byte(RespArray))
+	dst = strconv.AppendInt(dst, int64(len(v.Array)*2), 10)
+	dst = append(dst, '\r', '\n')
 
-	bytes = append(bytes, byte(RespBulk))
-	bytes = append(bytes, strconv.Itoa(len(v.Str))...)
-	bytes = append(bytes, '\r', '\n')
-	bytes = append(bytes, v.Str...)
-	bytes = append(bytes, '\r', '\n')
+	for i := range v.Array {
+		for j := range v.Array[i].Array {
+			dst = v.Array[i].Array[j].Append(dst, proto)
+		}
+	}
 
-	return bytes
+	return dst
 }
 
-// -Error message\r\n
-func (v *Value) marshalError() []byte {
-	var bytes []byte
-
-	bytes = append(bytes, byte(RespError))
-	bytes = append(bytes, v.Str...)
-	bytes = append(bytes, '\r', '\n')
+// $<length>\r\n<data>\r\n
+// Verbatim strings (=) share the layout, their data starting with "fmt:".
+func appendBulk[T string | []byte](dst []byte, typ RespDataType, format string, str T) []byte {
+	length := len(str)
+	if format != "" {
+		length += len(format) + 1
+	}
 
-	return bytes
+	dst = append(dst, byte(typ))
+	dst = strconv.AppendInt(dst, int64(length), 10)
+	dst = append(dst, '\r', '\n')
+	if format != "" {
+		dst = append(dst, format...)
+		dst = append(dst, ':')
+	}
+	dst = append(dst, str...)
+	return append(dst, '\r', '\n')
 }
 
-// _\r\n
-func (v *Value) marshalNil() []byte {
-	var bytes []byte
+// :<number>\r\n
+func appendInteger(dst []byte, n int64) []byte {
+	dst = append(dst, byte(RespInteger))
+	dst = strconv.AppendInt(dst, n, 10)
+	return append(dst, '\r', '\n')
+}
 
-	bytes = append(bytes, byte(RespNil))
-	bytes = append(bytes, '\r', '\n')
+// _\r\n in RESP3, $-1\r\n or *-1\r\n in RESP2
+func (v *Value) appendNil(dst []byte, proto int) []byte {
+	switch {
+	case proto >= RESP3:
+		return append(dst, "_\r\n"...)
+	case v.NullArray:
+		return append(dst, "*-1\r\n"...)
+	default:
+		return append(dst, "$-1\r\n"...)
+	}
+}
 
-	return bytes
+// #t\r\n or #f\r\n
+func appendBoolean(dst []byte, b bool) []byte {
+	if b {
+		return append(dst, "#t\r\n"...)
+	}
+	return append(dst, "#f\r\n"...)
 }
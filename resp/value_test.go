@@ -0,0 +1,55 @@
+package resp
+
+import "testing"
+
+func TestMarshal_PerProtocol(t *testing.T) {
+	tests := []struct {
+		name  string
+		value Value
+		resp2 string
+		resp3 string
+	}{
+		{"nil", Value{Type: RespNil}, "$-1\r\n", "_\r\n"},
+		{"nil array", Value{Type: RespNil, NullArray: true}, "*-1\r\n", "_\r\n"},
+		{"double", Value{Type: RespDouble, Float: 1.5}, "$3\r\n1.5\r\n", ",1.5\r\n"},
+		{"boolean", Value{Type: RespBoolean, Bool: true}, ":1\r\n", "#t\r\n"},
+		{"big number", Value{Type: RespBigNumber, Str: "12345678901234567890"},
+			"$20\r\n12345678901234567890\r\n", "(12345678901234567890\r\n"},
+		{"verbatim", Value{Type: RespVerbatim, Str: "hi"}, "$2\r\nhi\r\n", "=6\r\ntxt:hi\r\n"},
+		{"map", Value{Type: RespMap, Array: []Value{{Type: RespBulk, Str: "k"}, {Type: RespNil}}},
+			"*2\r\n$1\r\nk\r\n$-1\r\n", "%1\r\n$1\r\nk\r\n_\r\n"},
+		{"set", Value{Type: RespSet, Array: []Value{{Type: RespInteger, Int: 1}}}, "*1\r\n:1\r\n", "~1\r\n:1\r\n"},
+		{"push", Value{Type: RespPush, Array: []Value{{Type: RespBulk, Str: "message"}}},
+			"*1\r\n$7\r\nmessage\r\n", ">1\r\n$7\r\nmessage\r\n"},
+		{"pairs", Value{Type: RespArray, Pairs: true, Array: []Value{
+			{Type: RespArray, Array: []Value{{Type: RespBulk, Str: "m"}, {Type: RespDouble, Float: 2}}},
+		}}, "*2\r\n$1\r\nm\r\n$1\r\n2\r\n", "*1\r\n*2\r\n$1\r\nm\r\n,2\r\n"},
+	}
+
+	for _, tt := range tests {
+		if got := string(tt.value.Marshal(RESP2)); got != tt.resp2 {
+			t.Errorf("%s: Marshal(RESP2) = %q; want %q", tt.name, got, tt.resp2)
+		}
+		if got := string(tt.value.Marshal(RESP3)); got != tt.resp3 {
+			t.Errorf("%s: Marshal(RESP3) = %q; want %q", tt.name, got, tt.resp3)
+		}
+	}
+}
+
+func TestAppend_DoesNotAllocate(t *testing.T) {
+	v := Value{Type: RespArray, Array: []Value{
+		{Type: RespBulk, Str: "message"},
+		{Type: RespInteger, Int: 42},
+		{Type: RespDouble, Float: 1.5},
+		{Type: RespNil},
+	}}
+
+	buf := make([]byte, 0, 1024)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = v.Append(buf[:0], RESP2)
+		buf = v.Append(buf[:0], RESP3)
+	})
+	if allocs != 0 {
+		t.Errorf("Append allocated %v times per run; want 0", allocs)
+	}
+}
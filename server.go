@@ -1,10 +1,13 @@
 package main
 
 import (
+	"errors"
 	"io"
 	"log/slog"
 	"net"
+	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/devkarim/goredis/commands"
@@ -17,43 +20,60 @@ const SYNC_TIME = time.Second * 1
 
 type Server struct {
 	core.Config
-	ln  net.Listener
-	aof *storage.Aof
+	ln      net.Listener
+	aof     *storage.Aof
+	rdb     *storage.Rdb
+	done    chan struct{}
+	started time.Time
+
+	// loading is set until the dataset is loaded, clients get a LOADING
+	// error in the meantime.
+	loading      atomic.Bool
+	loadingSince time.Time
+	progress     *storage.LoadProgress
 }
 
 func NewServer(cfg core.Config) *Server {
 	return &Server{
-		Config: cfg,
+		Config:   cfg,
+		done:     make(chan struct{}),
+		started:  time.Now(),
+		progress: &storage.LoadProgress{},
 	}
 }
 
 func (s *Server) Start() error {
-	storage.Setup(s.Policy.NewPolicy(), *s.MaxMemory)
+	storage.Setup(*s.Policy, *s.MaxMemory)
+	storage.MaxStringSize = *s.ProtoMaxBulkLen
+
+	var cipher *storage.Cipher
+	if *s.EncryptionKeyFile != "" {
+		var err error
+		if cipher, err = storage.LoadCipher(*s.EncryptionKeyFile); err != nil {
+			slog.Error("Couldn't read the encryption key", "path", *s.EncryptionKeyFile, "error", err)
+			return err
+		}
+	}
 
-	aof, err := storage.NewAof(*s.AofPath)
+	aofDir, aofName := s.AofPaths()
+	aof, err := storage.NewAof(storage.AofConfig{
+		Dir:     aofDir,
+		Name:    aofName,
+		Legacy:  *s.AofName,
+		Fsync:   *s.AppendFsync,
+		RdbBase: *s.AofRdbBase,
+
+		Timestamps: *s.AofTimestamps,
+		Cipher:     cipher,
+	})
 	if err != nil {
 		slog.Error("Couldn't read aof", "error", err)
 		return err
 	}
 	defer aof.Close()
 
-	aof.Read(func(val resp.Value) {
-		cmd := strings.ToUpper(val.Array[0].Str)
-		command, ok := commands.Registry[cmd]
-		if ok {
-			slog.Debug("Executing from AOF", "command", val)
-			args := val.Array[1:]
-			command.Handler(args)
-		}
-	})
-
-	// Sync AOF every some specific duration to prevent OS deciding when to flush the file to disk
-	go func() {
-		for {
-			aof.Sync()
-			time.Sleep(SYNC_TIME)
-		}
-	}()
+	s.aof = aof
+	s.rdb = storage.NewRdb(*s.RdbPath, cipher)
 
 	ln, err := net.Listen("tcp", *s.ListenAddr)
 	if err != nil {
@@ -63,14 +83,162 @@ func (s *Server) Start() error {
 
 	slog.Info("Server running at", "listenAddr", *s.ListenAddr)
 	s.ln = ln
-	s.aof = aof
 
-	return s.loop()
+	// clients are accepted while loading, to tell them to come back later
+	s.loading.Store(true)
+	s.loadingSince = time.Now()
+	errc := make(chan error, 1)
+	go func() { errc <- s.loop() }()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if err := s.aof.Loaded(); err != nil {
+		slog.Error("Couldn't start a new AOF file", "error", err)
+		return err
+	}
+	s.loading.Store(false)
+
+	go storage.ActiveExpire(s.done)
+	go s.cron()
+	go s.syncLoop()
+	defer close(s.done)
+
+	return <-errc
+}
+
+// load restores the keyspace from the AOF, which holds every write. The
+// snapshot is only loaded when the AOF is empty, the AOF is then rewritten
+// from it so that both agree.
+func (s *Server) load() error {
+	done := make(chan struct{})
+	defer close(done)
+	go s.reportLoading(done)
+
+	if s.aof.Size() > 0 {
+		return s.replay(s.aof)
+	}
+
+	start := time.Now()
+	l := newLoader()
+	err := s.rdb.Read(s.progress, l.loadKey)
+	l.close()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		slog.Error("Couldn't load the snapshot", "path", *s.RdbPath, "error", err)
+		return err
+	}
+	slog.Info("Loaded the snapshot", "keys", l.keys.Load(), "duration", time.Since(start))
+
+	return s.aof.Rewrite()
+}
+
+// replay executes the commands stored in the AOF. An incomplete command at
+// its end, as a crash during a write leaves it, is truncated when
+// aof-load-truncated allows it, any other damage stops the server. The
+// commands and the keys of a snapshot base file are applied in parallel by
+// a loader.
+func (s *Server) replay(aof *storage.Aof) error {
+	start := time.Now()
+	l := newLoader()
+	err := aof.ReadKeys(s.progress, l.loadKey, l.apply)
+	l.close()
+
+	dir, _ := s.AofPaths()
+	var aofErr *storage.AofError
+	if errors.As(err, &aofErr) && aofErr.Err == storage.ErrAofTruncated && *s.AofLoadTruncated {
+		slog.Warn("Truncating the incomplete command at the end of the AOF",
+			"file", aofErr.File, "offset", aofErr.Valid, "lostBytes", aofErr.Size-aofErr.Valid)
+		return aof.Truncate(aofErr.Valid)
+	}
+	if errors.Is(err, storage.ErrWrongKey) || errors.Is(err, storage.ErrNoKey) {
+		slog.Error("Couldn't decrypt the AOF, check encryption-key-file", "dir", dir, "error", err)
+		return err
+	}
+	if err != nil {
+		slog.Error("Couldn't load the AOF, run 'goredis check-aof -fix' to repair it",
+			"dir", dir, "error", err)
+		return err
+	}
+	slog.Info("Loaded the AOF", "bytes", s.progress.Loaded(), "duration", time.Since(start))
+
+	return nil
+}
+
+// CRON_TIME is the period of the housekeeping done by cron.
+const CRON_TIME = time.Millisecond * 100
+
+// cron runs the periodic housekeeping of the server until it stops.
+func (s *Server) cron() {
+	ticker := time.NewTicker(CRON_TIME)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.autoRewrite()
+			s.autoSave()
+		}
+	}
+}
+
+// autoSave starts a background save once a save rule is met.
+func (s *Server) autoSave() {
+	for _, rule := range *s.SaveRules {
+		if !s.rdb.ShouldSave(rule.Seconds, rule.Changes) {
+			continue
+		}
+
+		slog.Info("Starting automatic save", "seconds", rule.Seconds, "changes", rule.Changes)
+		if err := s.rdb.SaveInBackground(); err != nil {
+			slog.Error("Couldn't start automatic save", "error", err)
+		}
+		return
+	}
+}
+
+// syncLoop flushes the AOF to disk every SYNC_TIME under the everysec
+// policy. Under any policy it retries a failed write or fsync, so writes are
+// accepted again once the disk recovers.
+func (s *Server) syncLoop() {
+	ticker := time.NewTicker(SYNC_TIME)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if *s.AppendFsync == storage.FsyncEverySec || s.aof.Err() != nil {
+				s.aof.Sync()
+			}
+		}
+	}
+}
+
+// autoRewrite starts a background AOF rewrite once the file has grown past
+// the auto-aof-rewrite thresholds.
+func (s *Server) autoRewrite() {
+	if !s.aof.ShouldRewrite(*s.AutoAofRewritePct, int64(*s.AutoAofRewriteMinSize)) {
+		return
+	}
+
+	slog.Info("Starting automatic AOF rewrite", "size", s.aof.Size())
+	if err := s.aof.RewriteInBackground(); err != nil {
+		slog.Error("Couldn't start automatic AOF rewrite", "error", err)
+	}
 }
 
 func (s *Server) loop() error {
 	for {
 		conn, err := s.ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return err
+		}
 		if err != nil {
 			slog.Error("Error when accepting client", "error", err)
 			continue
@@ -80,45 +248,156 @@ func (s *Server) loop() error {
 }
 
 func (s *Server) handleConnection(conn net.Conn) {
-	defer conn.Close()
-
-	reader := resp.NewReader(conn)
-	writer := resp.NewWriter(conn)
+	c := newClient(conn, *s.PubSubLimit)
+	c.reader.SetLimits(resp.Limits{
+		MaxBulkLen:       *s.ProtoMaxBulkLen,
+		MaxMultiBulkLen:  *s.MaxMultiBulkLen,
+		QueryBufferLimit: *s.QueryBufferLimit,
+	})
+	defer func() {
+		c.sub.Close()
+		c.resetTransaction()
+		c.close()
+		c.wait()
+		conn.Close()
+	}()
 
 	slog.Info("Connection from", "remoteAddr", conn.RemoteAddr().String())
-	for {
-		message, err := reader.Read()
+	for !c.quit {
+		message, err := c.reader.ReadCommand()
 		if err != nil {
-			if err != io.EOF {
+			var protoErr resp.ProtocolError
+			if errors.As(err, &protoErr) {
+				c.Send(resp.Value{Type: resp.RespError, Str: "ERR " + protoErr.Error()})
+				slog.Warn("Closing client after a protocol error", "remoteAddr", conn.RemoteAddr().String(), "error", err)
+			} else if err != io.EOF {
 				slog.Error("Error while reading from connection", "error", err)
 			}
 			break
 		}
 		slog.Debug("Received", "message", message)
-		if message.Type != resp.RespArray {
-			writer.Write(resp.Value{Type: resp.RespError, Str: "Invalid request, expected array"})
-			continue
-		}
-		if len(message.Array) <= 0 {
-			writer.Write(resp.Value{Type: resp.RespError, Str: "Invalid request, expected array length > 0"})
-			continue
+		s.execute(c, message)
+
+		// answer a pipeline in one write once all of it has been executed
+		if c.reader.Buffered() == 0 {
+			c.flush()
 		}
+	}
+	slog.Info("Disconnected", "remoteAddr", conn.RemoteAddr().String())
+}
 
-		cmd := message.Array[0].Str
-		cmdUpper := strings.ToUpper(cmd)
-		args := message.Array[1:]
+func (s *Server) execute(c *client, message resp.Value) {
+	if message.Type != resp.RespArray {
+		c.Send(resp.Value{Type: resp.RespError, Str: "Invalid request, expected array"})
+		return
+	}
+	if len(message.Array) <= 0 {
+		c.Send(resp.Value{Type: resp.RespError, Str: "Invalid request, expected array length > 0"})
+		return
+	}
 
-		command, ok := commands.Registry[cmdUpper]
-		if !ok {
-			writer.Write(resp.Value{Type: resp.RespError, Str: "ERR unknown command '" + cmd + "'"})
-			continue
+	cmd := message.Array[0].Str
+	cmdUpper := strings.ToUpper(cmd)
+	args := message.Array[1:]
+
+	if c.sub.Count() > 0 && !c.resp3() && !subscriberCommands[cmdUpper] {
+		c.Send(resp.Value{Type: resp.RespError, Str: "ERR Can't execute '" + strings.ToLower(cmd) +
+			"': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context"})
+		return
+	}
+
+	if s.loading.Load() && !loadingCommands[cmdUpper] {
+		c.Send(loadingError)
+		return
+	}
+
+	if c.multi && !transactionCommands[cmdUpper] {
+		s.queue(c, cmd, message)
+		return
+	}
+
+	if handler, ok := clientHandlers[cmdUpper]; ok {
+		handler(s, c, args)
+		return
+	}
+
+	command, ok := commands.Registry[cmdUpper]
+	if !ok {
+		c.Send(resp.Value{Type: resp.RespError, Str: "ERR unknown command '" + cmd + "'"})
+		return
+	}
+	if command.IsWrite {
+		if err := s.aof.Err(); err != nil {
+			c.Send(misconf(err))
+			return
 		}
-		response := command.Handler(args)
-		if command.IsWrite && response.Type != resp.RespError {
-			slog.Debug("Saving into AOF", "message", message)
-			s.aof.Write(message)
+	}
+
+	response := s.call(command, message)
+	if command.IsWrite && response.Type != resp.RespError {
+		if err := s.aof.Commit(); err != nil {
+			response = misconf(err)
 		}
-		writer.Write(response)
 	}
-	slog.Info("Disconnected", "remoteAddr", conn.RemoteAddr().String())
+	c.Send(response)
+}
+
+// misconf is the reply to writes while the AOF cannot be written to disk.
+func misconf(err error) resp.Value {
+	return resp.Value{Type: resp.RespError, Str: "MISCONF Errors writing to the AOF file: " + err.Error()}
+}
+
+// call runs a single command while holding the shards of its keys. Its write
+// is logged but not committed to the AOF yet, which must happen once the
+// shards are released.
+func (s *Server) call(command commands.Command, message resp.Value) resp.Value {
+	args := message.Array[1:]
+	keys := commandKeys(command, args)
+
+	release := storage.Acquire(keys, command.AllShards, false)
+	defer release()
+	if command.IsWrite {
+		storage.BeforeWrite(keys, command.AllShards)
+	}
+
+	response, propagated := s.run(command, message)
+	if command.IsWrite && response.Type != resp.RespError {
+		storage.Touch(keys...)
+		s.aof.Write(propagated...)
+		s.rdb.Changed(1)
+	}
+
+	return response
+}
+
+func commandKeys(command commands.Command, args []resp.Value) []string {
+	if command.Keys == nil {
+		return nil
+	}
+	return command.Keys(args)
+}
+
+// run executes a command and returns its reply along with what a
+// successful write stores in the AOF.
+func (s *Server) run(command commands.Command, message resp.Value) (resp.Value, []resp.Value) {
+	args := message.Array[1:]
+
+	var response resp.Value
+	var values []resp.Value
+	switch {
+	case command.Apply != nil:
+		response, values = command.Apply(args)
+	case command.Propagate != nil:
+		response = command.Handler(args)
+		values = command.Propagate(args, response)
+	default:
+		response = command.Handler(args)
+		values = []resp.Value{message}
+	}
+	if !command.IsWrite || response.Type == resp.RespError {
+		return response, nil
+	}
+
+	slog.Debug("Saving into AOF", "message", values)
+	return response, values
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/devkarim/goredis/commands"
+	"github.com/devkarim/goredis/core"
+	"github.com/devkarim/goredis/eviction"
+	"github.com/devkarim/goredis/resp"
+	"github.com/devkarim/goredis/storage"
+)
+
+// BenchmarkPipeline measures the time per command of a client pipelining
+// batches of SET and GET over TCP.
+func BenchmarkPipeline(b *testing.B) {
+	const batch = 1000
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	storage.Setup(eviction.PolicyLRU, 1<<30)
+	aof, err := storage.NewAof(storage.AofConfig{Dir: b.TempDir(), Name: "bench.aof", Fsync: storage.FsyncEverySec})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer aof.Close()
+
+	s := NewServer(core.LoadDefaultConfig())
+	s.aof = aof
+	s.rdb = storage.NewRdb(filepath.Join(b.TempDir(), "bench.rdb"), nil)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handleConnection(conn)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+
+	var request []byte
+	for i := range batch / 2 {
+		key := "key:" + strconv.Itoa(i)
+		set := commands.NewCommand("SET", key, "value")
+		get := commands.NewCommand("GET", key)
+		request = append(request, set.Marshal(resp.RESP2)...)
+		request = append(request, get.Marshal(resp.RESP2)...)
+	}
+	replies := resp.NewReader(conn)
+
+	b.ResetTimer()
+	for sent := 0; sent < b.N; sent += batch {
+		errc := make(chan error, 1)
+		go func() {
+			_, err := conn.Write(request)
+			errc <- err
+		}()
+
+		for range batch {
+			if _, err := replies.Read(); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := <-errc; err != nil {
+			b.Fatal(err)
+		}
+	}
+}
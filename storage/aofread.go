@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/devkarim/goredis/resp"
+)
+
+// ErrAofTruncated is the cause of an *AofError for a file ending in the
+// middle of a command or transaction, as a crash during a write leaves it.
+var ErrAofTruncated = errors.New("unexpected end of file")
+
+// AofError reports where reading an AOF stopped. Everything before Valid is
+// complete commands, so the file can be repaired by truncating it there.
+type AofError struct {
+	File   string // name of the damaged file, when the AOF has several
+	Valid  int64  // bytes of complete commands and transactions
+	Offset int64  // of the command that could not be read
+	Size   int64  // bytes read
+	Err    error  // ErrAofTruncated, or what is wrong with the command
+}
+
+func (e *AofError) Error() string {
+	what := "AOF"
+	if e.File != "" {
+		what = "AOF file " + e.File
+	}
+	if e.Err == ErrAofTruncated {
+		return fmt.Sprintf("%s is truncated, the last %d bytes are not a complete command", what, e.Size-e.Valid)
+	}
+	return fmt.Sprintf("%s is corrupted at offset %d: %v", what, e.Offset, e.Err)
+}
+
+func (e *AofError) Unwrap() error {
+	return e.Err
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ReadAof calls callback with every command read from r. The commands of a
+// MULTI ... EXEC block are only passed on once its EXEC has been read, so a
+// transaction cut short by a crash is dropped as a whole. Anything but a
+// complete sequence of commands makes it return an *AofError.
+func ReadAof(r io.Reader, callback func(val resp.Value)) error {
+	_, err := ReadAofUntil(r, AofLimit{}, callback)
+	return err
+}
+
+// AofLimit ends the reading of an AOF early, a zero field is no limit.
+type AofLimit struct {
+	Timestamp int64 // unix seconds, commands annotated with a later time are not read
+	Offset    int64 // commands and transactions ending after it are not read
+}
+
+// ReadAofUntil is ReadAof stopping at limit. It returns the offset it
+// stopped at, the end of the last command read, so that truncating the file
+// there drops exactly the commands it skipped.
+func ReadAofUntil(r io.Reader, limit AofLimit, callback func(val resp.Value)) (int64, error) {
+	counter := &countingReader{r: r}
+	rd := resp.NewReader(counter)
+	offset := func() int64 {
+		return counter.n - int64(rd.Buffered())
+	}
+
+	var tx []resp.Value
+	inTx := false
+	valid := int64(0)
+	fail := func(at int64, err error) (int64, error) {
+		return valid, &AofError{Valid: valid, Offset: at, Size: counter.n, Err: err}
+	}
+	pastOffset := func() bool {
+		return limit.Offset > 0 && offset() > limit.Offset
+	}
+
+	for {
+		start := offset()
+		if next, err := rd.Peek(1); err == io.EOF {
+			break
+		} else if err == nil && next[0] == '#' {
+			line, err := rd.ReadLine()
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return fail(start, ErrAofTruncated)
+			}
+			if err != nil {
+				return fail(start, err)
+			}
+			if ts, ok := parseTimestamp(line); ok && limit.Timestamp > 0 && ts > limit.Timestamp {
+				return valid, nil
+			}
+			if !inTx {
+				valid = offset()
+			}
+			continue
+		}
+
+		val, err := rd.Read()
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return fail(start, ErrAofTruncated)
+		}
+		if err != nil {
+			return fail(start, err)
+		}
+		if !isCommand(val) {
+			return fail(start, errors.New("not a command"))
+		}
+
+		switch cmd := strings.ToUpper(val.Array[0].Str); {
+		case cmd == "MULTI":
+			if inTx {
+				return fail(start, errors.New("MULTI inside a transaction"))
+			}
+			inTx, tx = true, nil
+		case cmd == "EXEC":
+			if !inTx {
+				return fail(start, errors.New("EXEC without MULTI"))
+			}
+			if pastOffset() {
+				return valid, nil
+			}
+			for _, v := range tx {
+				callback(v)
+			}
+			inTx, tx = false, nil
+			valid = offset()
+		case inTx:
+			tx = append(tx, val)
+		default:
+			if pastOffset() {
+				return valid, nil
+			}
+			callback(val)
+			valid = offset()
+		}
+	}
+
+	if inTx {
+		return fail(valid, ErrAofTruncated)
+	}
+	return valid, nil
+}
+
+// ReadAofFile is ReadAofUntil for the file read from r, which is decrypted
+// with c when it is encrypted. The offsets it returns, and those of an
+// *AofError, are offsets in the file, while limit.Offset is one in its
+// plaintext.
+func ReadAofFile(r io.Reader, c *Cipher, limit AofLimit, callback func(val resp.Value)) (int64, error) {
+	plain, d, err := openPlaintext(r, c)
+	if err != nil {
+		return 0, err
+	}
+
+	valid, err := ReadAofUntil(plain, limit, callback)
+	if d == nil {
+		return valid, err
+	}
+
+	var aofErr *AofError
+	if errors.As(err, &aofErr) {
+		aofErr.Valid = d.fileOffset(aofErr.Valid)
+		aofErr.Offset = d.fileOffset(aofErr.Offset)
+		aofErr.Size = d.read
+	}
+	return d.fileOffset(valid), err
+}
+
+// appendTimestamp appends the annotation of the time of the writes
+// following it, in unix seconds.
+func appendTimestamp(buf []byte, ts int64) []byte {
+	buf = append(buf, "#TS:"...)
+	buf = strconv.AppendInt(buf, ts, 10)
+	return append(buf, "\r\n"...)
+}
+
+// parseTimestamp parses an annotation line written by appendTimestamp.
+func parseTimestamp(line []byte) (int64, bool) {
+	value, ok := strings.CutPrefix(string(line), "#TS:")
+	if !ok {
+		return 0, false
+	}
+	ts, err := strconv.ParseInt(value, 10, 64)
+	return ts, err == nil
+}
+
+func isCommand(val resp.Value) bool {
+	if val.Type != resp.RespArray || len(val.Array) == 0 {
+		return false
+	}
+	for _, arg := range val.Array {
+		if arg.Type != resp.RespBulk {
+			return false
+		}
+	}
+	return true
+}
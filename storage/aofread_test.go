@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/devkarim/goredis/resp"
+)
+
+func TestReadAof_DamagedFiles(t *testing.T) {
+	marshal := func(v resp.Value) string { return string(v.Marshal(resp.RESP2)) }
+	set := marshal(command("SET", "k", "v"))
+	multi := marshal(command("MULTI"))
+	exec := marshal(command("EXEC"))
+
+	tests := []struct {
+		name      string
+		file      string
+		commands  int
+		valid     int  // -1 when the file is valid
+		truncated bool // whether the error is ErrAofTruncated
+	}{
+		{"valid", set + multi + set + exec + set, 3, -1, false},
+		{"command cut short", set + set[:7], 1, len(set), true},
+		{"transaction without exec", set + multi + set, 1, len(set), true},
+		{"garbage in the middle", set + "garbage\r\n" + set, 1, len(set), false},
+		{"exec without multi", set + exec + set, 1, len(set), false},
+	}
+
+	for _, tt := range tests {
+		commands := 0
+		err := ReadAof(strings.NewReader(tt.file), func(resp.Value) { commands++ })
+		if commands != tt.commands {
+			t.Errorf("%s: read %d commands; want %d", tt.name, commands, tt.commands)
+		}
+
+		if tt.valid < 0 {
+			if err != nil {
+				t.Errorf("%s: ReadAof() error = %v; want nil", tt.name, err)
+			}
+			continue
+		}
+		var aofErr *AofError
+		if !errors.As(err, &aofErr) {
+			t.Errorf("%s: ReadAof() error = %v; want an *AofError", tt.name, err)
+			continue
+		}
+		if aofErr.Valid != int64(tt.valid) || aofErr.Size != int64(len(tt.file)) {
+			t.Errorf("%s: Valid, Size = %d, %d; want %d, %d", tt.name, aofErr.Valid, aofErr.Size, tt.valid, len(tt.file))
+		}
+		if got := errors.Is(err, ErrAofTruncated); got != tt.truncated {
+			t.Errorf("%s: errors.Is(err, ErrAofTruncated) = %v; want %v", tt.name, got, tt.truncated)
+		}
+	}
+}
+
+func TestReadAofUntil_Limits(t *testing.T) {
+	marshal := func(v resp.Value) string { return string(v.Marshal(resp.RESP2)) }
+	set := marshal(command("SET", "k", "v"))
+	multi := marshal(command("MULTI"))
+	exec := marshal(command("EXEC"))
+	ts := func(ts int64) string { return string(appendTimestamp(nil, ts)) }
+
+	file := ts(100) + set + set + ts(101) + multi + set + exec + ts(105) + set
+	atTx := len(ts(100) + set + set)
+
+	tests := []struct {
+		name     string
+		limit    AofLimit
+		commands int
+		valid    int
+	}{
+		{"no limit", AofLimit{}, 4, len(file)},
+		{"timestamp before everything", AofLimit{Timestamp: 99}, 0, 0},
+		{"timestamp in the middle", AofLimit{Timestamp: 104}, 3, atTx + len(ts(101)+multi+set+exec)},
+		{"offset in a command", AofLimit{Offset: int64(atTx - 1)}, 1, len(ts(100) + set)},
+		{"offset in a transaction", AofLimit{Offset: int64(atTx + 10)}, 2, atTx + len(ts(101))},
+		{"offset at the end", AofLimit{Offset: int64(len(file))}, 4, len(file)},
+	}
+
+	for _, tt := range tests {
+		commands := 0
+		valid, err := ReadAofUntil(strings.NewReader(file), tt.limit, func(resp.Value) { commands++ })
+		if err != nil {
+			t.Errorf("%s: ReadAofUntil() error = %v", tt.name, err)
+			continue
+		}
+		if commands != tt.commands || valid != int64(tt.valid) {
+			t.Errorf("%s: read %d commands up to %d; want %d up to %d", tt.name, commands, valid, tt.commands, tt.valid)
+		}
+	}
+}
@@ -4,29 +4,57 @@ import (
 	"errors"
 	"hash/fnv"
 	"log/slog"
+	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
 
 	"github.com/devkarim/goredis/eviction"
 )
 
-var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+var (
+	ErrWrongType       = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	ErrNoSuchKey       = errors.New("ERR no such key")
+	ErrIndexOutOfRange = errors.New("ERR index out of range")
+)
 
 type RedisObjectType string
 
 const (
 	RedisObjectString RedisObjectType = "string"
 	RedisObjectHash   RedisObjectType = "hash"
+	RedisObjectList   RedisObjectType = "list"
+	RedisObjectSet    RedisObjectType = "set"
+	RedisObjectZSet   RedisObjectType = "zset"
 )
 
 type RedisObject struct {
 	Type RedisObjectType
 	Str  string
 	Hash map[string]string
+	// HashExpires holds the deadlines of hash fields in unix milliseconds,
+	// nil when no field of the hash has one.
+	HashExpires    map[string]int64
+	fieldDeadlines fieldDeadlines // heap of HashExpires, see nextFieldExpire
+	List           *Deque
+	Set            map[string]struct{}
+	ZSet           *ZSet
 }
 
 func (r *RedisObject) Size() int {
-	if r.Type == RedisObjectString {
+	switch r.Type {
+	case RedisObjectString:
 		return len(r.Str)
+	case RedisObjectList:
+		return r.List.Bytes()
+	case RedisObjectSet:
+		size := 0
+		for member := range r.Set {
+			size += len(member)
+		}
+		return size
+	case RedisObjectZSet:
+		return r.ZSet.Bytes()
 	}
 
 	size := 0
@@ -36,29 +64,76 @@ func (r *RedisObject) Size() int {
 	return size
 }
 
+// Clone returns a deep copy of the object, used by COPY.
+func (r *RedisObject) Clone() *RedisObject {
+	clone := &RedisObject{Type: r.Type, Str: r.Str}
+	switch r.Type {
+	case RedisObjectHash:
+		clone.Hash = maps.Clone(r.Hash)
+		clone.HashExpires = maps.Clone(r.HashExpires)
+		clone.fieldDeadlines = slices.Clone(r.fieldDeadlines)
+	case RedisObjectList:
+		clone.List = r.List.Clone()
+	case RedisObjectSet:
+		clone.Set = maps.Clone(r.Set)
+	case RedisObjectZSet:
+		clone.ZSet = r.ZSet.Clone()
+	}
+	return clone
+}
+
 type Shard struct {
 	Id            int
 	Mu            sync.RWMutex
 	Store         map[string]*RedisObject
+	Expires       map[string]int64 // unix time in milliseconds
 	Policy        eviction.Policy
 	CurrentMemory int // in bytes
 	MaxMemory     int // in bytes
+
+	gate     sync.RWMutex                // see Acquire
+	watchers map[string]int              // number of clients watching each key
+	versions map[string]uint64           // modification counters of watched keys
+	buckets  []map[string]struct{}       // keys grouped by scan bucket, see Scan
+	frozen   atomic.Pointer[frozenShard] // shard of a snapshot not copied yet
+
+	expiringHashes map[string]struct{} // hashes with at least one field deadline
 }
 
+// ShardCount is the number of shards the keyspace is split into.
+const ShardCount = 8
+
 var shards []*Shard
 
-func Setup(policy eviction.Policy, maxMemory int) {
-	shards = make([]*Shard, 8)
+func NewShard(id int, policy eviction.Policy, maxMemory int) *Shard {
+	return &Shard{
+		Id:        id,
+		MaxMemory: maxMemory,
+		Policy:    policy,
+		Mu:        sync.RWMutex{},
+		Store:     map[string]*RedisObject{},
+		Expires:   map[string]int64{},
+	}
+}
+
+// Setup creates the shards, each with its own instance of the eviction
+// policy since a policy only tracks the keys of a single shard.
+func Setup(policy eviction.PolicyType, maxMemory int) {
+	shards = make([]*Shard, ShardCount)
 
 	for i := 0; i < len(shards); i++ {
-		shards[i] = &Shard{Id: i, MaxMemory: maxMemory, Policy: policy, Mu: sync.RWMutex{}, Store: map[string]*RedisObject{}}
+		shards[i] = NewShard(i, policy.NewPolicy(), maxMemory)
 	}
 }
 
-func GetShard(key string) *Shard {
+func hashKey(key string) uint32 {
 	h := fnv.New32a()
 	h.Write([]byte(key))
-	return shards[h.Sum32()%uint32(len(shards))]
+	return h.Sum32()
+}
+
+func GetShard(key string) *Shard {
+	return shards[hashKey(key)%ShardCount]
 }
 
 func (s *Shard) evict(neededSize int) {
@@ -67,11 +142,7 @@ func (s *Shard) evict(neededSize int) {
 		victim, ok := s.Policy.SelectVictim()
 		if ok {
 			slog.Info("Evicting policy", "evicted", victim)
-			victimVal := s.Store[victim]
-			delete(s.Store, victim)
-			if victimVal != nil {
-				s.CurrentMemory -= victimVal.Size()
-			}
+			s.remove(victim)
 		}
 		if !ok {
 			break
@@ -79,123 +150,186 @@ func (s *Shard) evict(neededSize int) {
 	}
 }
 
-func (s *Shard) SetString(key string, val string) error {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
+// remove deletes key along with its deadline and releases its memory.
+// Caller must hold the write lock.
+func (s *Shard) remove(key string) {
+	obj, ok := s.Store[key]
+	if !ok {
+		return
+	}
 
-	oldVal, ok := s.Store[key]
+	delete(s.Store, key)
+	delete(s.Expires, key)
+	delete(s.expiringHashes, key)
+	s.unindex(key)
+	s.CurrentMemory -= obj.Size()
+	s.Policy.Remove(key)
+	s.touch(key)
+}
 
-	if ok && s.Store[key].Type != RedisObjectString {
-		return ErrWrongType
+// put stores obj at key, indexing the key for SCAN.
+// Caller must hold the write lock.
+func (s *Shard) put(key string, obj *RedisObject) {
+	s.Store[key] = obj
+	s.index(key)
+}
+
+// lockShards write-locks the distinct shards owning keys in ascending id
+// order, so that concurrent multi-key commands can never deadlock.
+func lockShards(keys ...string) func() {
+	owners := shardsOf(keys)
+	for _, shard := range owners {
+		shard.Mu.Lock()
 	}
-	if ok {
-		s.CurrentMemory -= oldVal.Size()
-		s.Policy.Remove(key)
+
+	return func() {
+		for i := len(owners) - 1; i >= 0; i-- {
+			owners[i].Mu.Unlock()
+		}
 	}
+}
 
-	newObj := &RedisObject{Type: RedisObjectString, Str: val}
+// lookup returns the object stored at key, hiding it if its deadline has passed.
+func (s *Shard) lookup(key string) (*RedisObject, bool) {
+	obj, ok := s.Store[key]
+	if !ok || s.isExpired(key) {
+		return nil, false
+	}
+	return obj, true
+}
 
-	s.evict(newObj.Size())
-	s.Policy.Access(key)
+// lookupType returns the live object at key, failing when it holds another type.
+func (s *Shard) lookupType(key string, typ RedisObjectType) (*RedisObject, bool, error) {
+	obj, ok := s.lookup(key)
+	if !ok {
+		return nil, false, nil
+	}
+	if obj.Type != typ {
+		return nil, false, ErrWrongType
+	}
 
-	s.Store[key] = newObj
-	s.CurrentMemory += newObj.Size()
+	s.Policy.Access(key)
 
-	return nil
+	return obj, true, nil
 }
 
-func (s *Shard) GetString(key string) (string, bool, error) {
-	s.Mu.RLock()
-	defer s.Mu.RUnlock()
+// prepareWrite makes room for neededSize more bytes and returns the object at
+// key, creating it with create when missing. The type check happens before
+// evicting so that a failed write has no side effects, and the lookup is
+// repeated afterwards since the key itself may have been evicted.
+// Caller must hold the write lock.
+func (s *Shard) prepareWrite(key string, typ RedisObjectType, neededSize int, create func() *RedisObject) (*RedisObject, error) {
+	s.expireIfNeeded(key)
+	if obj, ok := s.Store[key]; ok && obj.Type != typ {
+		return nil, ErrWrongType
+	}
+
+	s.evict(neededSize)
 
 	obj, ok := s.Store[key]
 	if !ok {
-		return "", false, nil
-	}
-	if obj.Type != RedisObjectString {
-		return "", false, ErrWrongType
+		obj = create()
+		s.put(key, obj)
+		s.CurrentMemory += obj.Size()
 	}
-
 	s.Policy.Access(key)
 
-	return obj.Str, true, nil
+	return obj, nil
 }
 
-func (s *Shard) HSet(hash, key, val string) error {
+type SetCondition int
+
+const (
+	SetAlways SetCondition = iota
+	SetNX                  // only set the key if it does not exist
+	SetXX                  // only set the key if it already exists
+)
+
+type SetOptions struct {
+	Condition SetCondition
+	ExpireAt  int64 // unix time in milliseconds, 0 for no expiry
+	KeepTTL   bool
+}
+
+// SetResult describes the value replaced by Set and whether the write happened.
+type SetResult struct {
+	Old      string
+	OldFound bool
+	Applied  bool
+}
+
+func (s *Shard) SetString(key string, val string) error {
+	_, err := s.Set(key, val, SetOptions{})
+	return err
+}
+
+// Set stores val at key, checking the NX/XX condition under the same lock
+// as the write itself.
+func (s *Shard) Set(key string, val string, opts SetOptions) (SetResult, error) {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
 
-	obj, ok := s.Store[hash]
+	return s.set(key, val, opts)
+}
 
-	if ok && s.Store[hash].Type != RedisObjectHash {
-		return ErrWrongType
-	}
-	if ok {
-		s.CurrentMemory -= obj.Size()
+// set must be called with the write lock held.
+func (s *Shard) set(key string, val string, opts SetOptions) (SetResult, error) {
+	s.expireIfNeeded(key)
+	oldVal, ok := s.Store[key]
+
+	if ok && s.Store[key].Type != RedisObjectString {
+		return SetResult{}, ErrWrongType
 	}
 
-	neededMemory := len(key) + len(val)
+	result := SetResult{OldFound: ok}
 	if ok {
-		neededMemory += obj.Size()
+		result.Old = oldVal.Str
 	}
 
-	s.Policy.Access(hash)
-	s.evict(neededMemory)
-
-	if !ok {
-		obj = &RedisObject{Type: RedisObjectHash, Hash: map[string]string{}}
-		s.Store[hash] = obj
+	if (opts.Condition == SetNX && ok) || (opts.Condition == SetXX && !ok) {
+		return result, nil
 	}
+	result.Applied = true
 
-	obj.Hash[key] = val
-	s.CurrentMemory += obj.Size()
-
-	return nil
-}
+	oldExpire, hadExpire := s.Expires[key]
+	if ok {
+		s.CurrentMemory -= oldVal.Size()
+		s.Policy.Remove(key)
+		delete(s.Expires, key)
+	}
 
-func (s *Shard) HGet(hash, key string) (string, bool, error) {
-	s.Mu.RLock()
-	defer s.Mu.RUnlock()
+	newObj := &RedisObject{Type: RedisObjectString, Str: val}
 
-	obj, ok := s.Store[hash]
-	if !ok {
-		return "", false, nil
-	}
-	if obj.Type != RedisObjectHash {
-		return "", false, ErrWrongType
-	}
+	s.evict(newObj.Size())
+	s.Policy.Access(key)
 
-	s.Policy.Access(hash)
+	s.put(key, newObj)
+	s.CurrentMemory += newObj.Size()
 
-	val, ok := obj.Hash[key]
-	if !ok {
-		return "", false, nil
+	switch {
+	case opts.ExpireAt > 0:
+		s.Expires[key] = opts.ExpireAt
+		s.expireIfNeeded(key)
+	case opts.KeepTTL && hadExpire:
+		s.Expires[key] = oldExpire
 	}
 
-	return val, true, nil
+	return result, nil
 }
 
-func (s *Shard) HGetAll(hash string) ([]string, bool, error) {
-	s.Mu.RLock()
+func (s *Shard) GetString(key string) (string, bool, error) {
+	s.rlockKey(key)
 	defer s.Mu.RUnlock()
 
-	obj, ok := s.Store[hash]
+	obj, ok := s.lookup(key)
 	if !ok {
-		return []string{}, false, nil
+		return "", false, nil
 	}
-	if obj.Type != RedisObjectHash {
-		return []string{}, false, ErrWrongType
+	if obj.Type != RedisObjectString {
+		return "", false, ErrWrongType
 	}
 
-	s.Policy.Access(hash)
-
-	arr := make([]string, len(obj.Hash)*2)
-	idx := 0
-	for key, value := range obj.Hash {
-		arr[idx] = key
-		arr[idx+1] = value
-		idx += 2
-	}
+	s.Policy.Access(key)
 
-	return arr, true, nil
+	return obj.Str, true, nil
 }
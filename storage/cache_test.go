@@ -125,3 +125,41 @@ func TestEviction_FIFO_UpdateTriggersEviction(t *testing.T) {
 		t.Errorf("CurrentMemory = %d; got %d", expected, shard.CurrentMemory)
 	}
 }
+
+func TestSet_Conditions(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 100)
+
+	if res, _ := shard.Set("a", "1", SetOptions{Condition: SetXX}); res.Applied {
+		t.Errorf("XX should not set a missing key")
+	}
+	if res, _ := shard.Set("a", "1", SetOptions{Condition: SetNX}); !res.Applied {
+		t.Errorf("NX should set a missing key")
+	}
+
+	res, _ := shard.Set("a", "2", SetOptions{Condition: SetNX})
+	if res.Applied || !res.OldFound || res.Old != "1" {
+		t.Errorf("NX should keep the existing value, got %+v", res)
+	}
+
+	if val, _, _ := shard.GetString("a"); val != "1" {
+		t.Errorf("expected '1', got %q", val)
+	}
+}
+
+func TestSet_KeepTTL(t *testing.T) {
+	withClock(t, 1000)
+	shard := NewShard(0, eviction.NewLRU(), 100)
+
+	shard.Set("a", "1", SetOptions{ExpireAt: 5000})
+	shard.Set("a", "2", SetOptions{KeepTTL: true})
+
+	if got := shard.TTL("a"); got != 4000 {
+		t.Errorf("TTL = %d; want 4000", got)
+	}
+
+	shard.Set("a", "3", SetOptions{})
+
+	if got := shard.TTL("a"); got != TTLNoExpire {
+		t.Errorf("TTL = %d; want %d", got, TTLNoExpire)
+	}
+}
@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	ErrInvalidKey = errors.New("encryption key must be 16, 24 or 32 bytes, raw or hex encoded")
+	ErrWrongKey   = errors.New("the file was encrypted with another key")
+	ErrNoKey      = errors.New("the file is encrypted and no encryption key is configured")
+
+	errBadHeader = errors.New("not an encrypted file")
+	errBadRecord = errors.New("encrypted record failed authentication")
+)
+
+// An encrypted file starts with a header made of cryptMagic, which no
+// plaintext AOF or snapshot starts with, and keyCheck sealed with the key,
+// which tells a wrong key apart from a damaged file. The plaintext follows
+// as records, each sealed on its own so that the AOF can still be appended
+// to:
+//
+//	length uint32 | nonce | ciphertext and tag of length bytes
+//
+// The header starts with a random id, which derives the key of the file
+// from the configured one. The nonce of a record is its position in the
+// file, so nonces never repeat under a key, and records moved within a file
+// or between files fail to open like damaged ones. A record cut short by a
+// crash is detected like an incomplete command.
+const (
+	cryptMagic = "\x00GOREDIS-AES"
+	keyCheck   = "goredis key check"
+
+	fileKeyInfo = "goredis file key"
+
+	idSize      = 16
+	nonceSize   = 12
+	tagSize     = 16
+	headerSize  = len(cryptMagic) + idSize + len(keyCheck) + tagSize
+	maxRecord   = 1 << 31
+	recordLimit = 64 * 1024 // plaintext of the records written by cryptWriter
+)
+
+// headerNonce seals keyCheck in the header, records count up from zero.
+var headerNonce = [nonceSize]byte{0: 0xff, 1: 0xff, 2: 0xff, 3: 0xff}
+
+// Cipher encrypts the AOF and snapshot files with AES-GCM. A nil *Cipher
+// leaves them in plaintext.
+type Cipher struct {
+	key []byte
+}
+
+// NewCipher returns a Cipher using key, which selects AES-128, AES-192 or
+// AES-256 by its length.
+func NewCipher(key []byte) (*Cipher, error) {
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, ErrInvalidKey
+	}
+	return &Cipher{key: bytes.Clone(key)}, nil
+}
+
+// fileKey returns the AEAD of the file whose header holds id, keyed with
+// a key derived from c and id.
+func (c *Cipher) fileKey(id []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, c.key, id, fileKeyInfo, len(c.key))
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// recordNonce is the nonce of the record at seq. The header uses headerNonce,
+// which no record has.
+func recordNonce(seq uint64) [nonceSize]byte {
+	var nonce [nonceSize]byte
+	binary.BigEndian.PutUint64(nonce[nonceSize-8:], seq)
+	return nonce
+}
+
+// LoadCipher reads the key of a Cipher from the file at path, either its
+// hex encoding or the raw key.
+func LoadCipher(path string) (*Cipher, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := hex.DecodeString(strings.TrimSpace(string(data))); err == nil {
+		return NewCipher(key)
+	}
+	return NewCipher(data)
+}
+
+// newFile returns the header of a new encrypted file and the sealer of its
+// records.
+func (c *Cipher) newFile() ([]byte, *sealer, error) {
+	id := make([]byte, idSize)
+	if _, err := rand.Read(id); err != nil {
+		return nil, nil, err
+	}
+	aead, err := c.fileKey(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	buf := append([]byte(cryptMagic), id...)
+	return aead.Seal(buf, headerNonce[:], []byte(keyCheck), nil), &sealer{aead: aead}, nil
+}
+
+// sealer seals the records of a file, in order.
+type sealer struct {
+	aead cipher.AEAD // of the file, see fileKey
+	seq  uint64      // of the next record
+}
+
+// seal appends the record holding plain to buf.
+func (s *sealer) seal(buf, plain []byte) []byte {
+	nonce := recordNonce(s.seq)
+	s.seq++
+
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(plain)+tagSize))
+	buf = append(buf, nonce[:]...)
+	return s.aead.Seal(buf, nonce[:], plain, nil)
+}
+
+// writer returns a writer encrypting what is written to it into w, which
+// must be closed to write its last record. A nil c writes plaintext.
+func (c *Cipher) writer(w io.Writer) (io.WriteCloser, error) {
+	if c == nil {
+		return nopCloser{w}, nil
+	}
+	header, s, err := c.newFile()
+	if err != nil {
+		return nil, err
+	}
+	return &cryptWriter{w: w, s: s, buf: header}, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// cryptWriter batches what is written to it into records of recordLimit
+// bytes.
+type cryptWriter struct {
+	w     io.Writer
+	s     *sealer
+	plain []byte
+	buf   []byte // records not written yet
+}
+
+func (cw *cryptWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		chunk := min(len(p), recordLimit-len(cw.plain))
+		cw.plain = append(cw.plain, p[:chunk]...)
+		p = p[chunk:]
+		if len(cw.plain) == recordLimit {
+			if err := cw.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (cw *cryptWriter) flush() error {
+	if len(cw.plain) > 0 {
+		cw.buf = cw.s.seal(cw.buf, cw.plain)
+		cw.plain = cw.plain[:0]
+	}
+	_, err := cw.w.Write(cw.buf)
+	cw.buf = cw.buf[:0]
+	return err
+}
+
+func (cw *cryptWriter) Close() error {
+	return cw.flush()
+}
+
+// isEncrypted reports whether the file at path is an encrypted one.
+func isEncrypted(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	var first [1]byte
+	if _, err := file.Read(first[:]); err == io.EOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return first[0] == cryptMagic[0], nil
+}
+
+// appendTo returns the sealer of the records appended to the encrypted file
+// at path, following the complete ones already in it. It is nil when the
+// file is too short to hold a header.
+func (c *Cipher) appendTo(path string) (*sealer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReaderSize(file, 64*1024)
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	aead, err := c.fileKey(header[len(cryptMagic) : len(cryptMagic)+idSize])
+	if err != nil {
+		return nil, err
+	}
+	s := &sealer{aead: aead}
+	for {
+		var length [4]byte
+		if _, err := io.ReadFull(r, length[:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return s, nil
+		} else if err != nil {
+			return nil, err
+		}
+		size := nonceSize + int(binary.BigEndian.Uint32(length[:]))
+		if n, err := r.Discard(size); n < size {
+			if err == io.EOF {
+				return s, nil
+			}
+			return nil, err
+		}
+		s.seq++
+	}
+}
+
+// decrypter reads the plaintext of an encrypted file. It remembers where
+// the recent records end, so that an offset in the plaintext can be mapped
+// back to the file, see fileOffset.
+type decrypter struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD // of the file, see fileKey
+	seq   uint64      // of the next record
+	plain []byte      // decrypted and not read yet
+	err   error       // returned once plain is drained
+
+	read   int64 // bytes of the file read
+	bounds []recordBound
+}
+
+// recordBound is where a record ends, in the plaintext and in the file.
+type recordBound struct {
+	plain, file int64
+}
+
+// boundsWindow is how far behind the last record decrypted the bounds are
+// kept, far more than the readers of the plaintext buffer.
+const boundsWindow = 4 << 20
+
+// openPlaintext returns a reader of the plaintext of the file read from r,
+// which is decrypted with c when it is encrypted. The *decrypter is nil
+// for a plaintext file. A file whose header is cut short reads as empty
+// with an io.ErrUnexpectedEOF.
+func openPlaintext(r io.Reader, c *Cipher) (io.Reader, *decrypter, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	if first, err := br.Peek(1); err != nil || first[0] != cryptMagic[0] {
+		return br, nil, nil
+	}
+	if c == nil {
+		return nil, nil, ErrNoKey
+	}
+
+	d := &decrypter{r: br, bounds: []recordBound{{0, int64(headerSize)}}}
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(br, header)
+	d.read = int64(n)
+	if err != nil {
+		d.bounds[0].file = 0
+		d.err = io.ErrUnexpectedEOF
+		return d, d, nil
+	}
+	if string(header[:len(cryptMagic)]) != cryptMagic {
+		return nil, nil, errBadHeader
+	}
+	d.aead, err = c.fileKey(header[len(cryptMagic) : len(cryptMagic)+idSize])
+	if err != nil {
+		return nil, nil, err
+	}
+	check, err := d.aead.Open(nil, headerNonce[:], header[len(cryptMagic)+idSize:], nil)
+	if err != nil || string(check) != keyCheck {
+		return nil, nil, ErrWrongKey
+	}
+
+	return d, d, nil
+}
+
+func (d *decrypter) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.next()
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// next decrypts the following record.
+func (d *decrypter) next() error {
+	var length [4]byte
+	n, err := io.ReadFull(d.r, length[:])
+	d.read += int64(n)
+	if err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(length[:])
+	if size < tagSize || size > maxRecord {
+		return errBadRecord
+	}
+
+	// a damaged length must not allocate more than the file holds
+	record, err := io.ReadAll(io.LimitReader(d.r, nonceSize+int64(size)))
+	d.read += int64(len(record))
+	if err != nil {
+		return err
+	}
+	if len(record) < nonceSize+int(size) {
+		return io.ErrUnexpectedEOF
+	}
+	// a record moved from another position does not open with its nonce
+	nonce := recordNonce(d.seq)
+	plain, err := d.aead.Open(record[nonceSize:nonceSize], nonce[:], record[nonceSize:], nil)
+	if err != nil {
+		return errBadRecord
+	}
+	d.seq++
+
+	last := d.bounds[len(d.bounds)-1]
+	d.bounds = append(d.bounds, recordBound{last.plain + int64(len(plain)), d.read})
+	for len(d.bounds) > 2 && d.bounds[1].plain <= last.plain-boundsWindow {
+		d.bounds = d.bounds[1:]
+	}
+	d.plain = plain
+	return nil
+}
+
+// fileOffset maps an offset of the plaintext to the file. An offset in the
+// middle of a record maps to its start, the AOF only writes whole commands
+// in a record.
+func (d *decrypter) fileOffset(plain int64) int64 {
+	file := d.bounds[0].file
+	for _, b := range d.bounds {
+		if b.plain > plain {
+			break
+		}
+		file = b.file
+	}
+	return file
+}
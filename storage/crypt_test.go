@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/devkarim/goredis/eviction"
+	"github.com/devkarim/goredis/resp"
+)
+
+func testCipher(t *testing.T, key string) *Cipher {
+	t.Helper()
+	c, err := NewCipher([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestAof_Encrypted(t *testing.T) {
+	dir := t.TempDir()
+	cfg := AofConfig{Dir: dir, Name: "test.aof", Fsync: FsyncAlways, Cipher: testCipher(t, "0123456789abcdef")}
+	aof, err := NewAof(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aof.Write(command("SET", "secret", "value"))
+	aof.Write(command("SET", "k", "v"))
+	path := filepath.Join(dir, aof.manifest.lastIncr().name)
+	aof.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret")) {
+		t.Error("the AOF holds the plaintext of the writes")
+	}
+
+	// the last record is cut short by a crash
+	if err := os.WriteFile(path, data[:len(data)-5], 0644); err != nil {
+		t.Fatal(err)
+	}
+	aof, err = NewAof(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aof.Close()
+
+	var got []resp.Value
+	err = aof.Read(nil, func(v resp.Value) { got = append(got, v) })
+	var aofErr *AofError
+	if !errors.As(err, &aofErr) || aofErr.Err != ErrAofTruncated {
+		t.Fatalf("Read() error = %v; want a truncated AOF", err)
+	}
+	if len(got) != 1 || got[0].Array[1].Str != "secret" {
+		t.Errorf("Read() = %v; want the first SET", got)
+	}
+
+	if err := aof.Truncate(aofErr.Valid); err != nil {
+		t.Fatal(err)
+	}
+	aof.Write(command("SET", "k", "again"))
+	got = nil
+	if err := aof.Read(nil, func(v resp.Value) { got = append(got, v) }); err != nil {
+		t.Fatalf("Read() after Truncate error = %v", err)
+	}
+	if len(got) != 2 || got[1].Array[2].Str != "again" {
+		t.Errorf("Read() after Truncate = %v; want both SETs", got)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		cipher *Cipher
+		want   error
+	}{
+		{"wrong key", testCipher(t, "fedcba9876543210"), ErrWrongKey},
+		{"no key", nil, ErrNoKey},
+	} {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ReadAofFile(file, tt.cipher, AofLimit{}, func(resp.Value) {})
+		file.Close()
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: ReadAofFile() error = %v; want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestRdb_Encrypted(t *testing.T) {
+	Setup(eviction.PolicyLRU, 1<<20)
+	GetShard("secret").SetString("secret", "value")
+
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	if err := NewRdb(path, testCipher(t, "0123456789abcdef")).Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if data, _ := os.ReadFile(path); bytes.Contains(data, []byte("secret")) {
+		t.Error("the snapshot holds the plaintext of the keys")
+	}
+
+	Setup(eviction.PolicyLRU, 1<<20)
+	if _, err := loadRdb(NewRdb(path, testCipher(t, "fedcba9876543210"))); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Read() with another key error = %v; want ErrWrongKey", err)
+	}
+	if loaded, err := loadRdb(NewRdb(path, testCipher(t, "0123456789abcdef"))); err != nil || loaded != 1 {
+		t.Errorf("Read() = %d, %v; want 1 key", loaded, err)
+	}
+}
+
+func TestAof_EncryptionTurnedOn(t *testing.T) {
+	dir := t.TempDir()
+	cfg := AofConfig{Dir: dir, Name: "test.aof", Fsync: FsyncAlways}
+	aof, err := NewAof(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aof.Write(command("SET", "k", "plain"))
+	aof.Close()
+
+	// a start failing to load leaves the manifest alone
+	cfg.Cipher = testCipher(t, "0123456789abcdef")
+	aof, err = NewAof(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aof.Close()
+	if m, err := readManifest(dir, cfg.Name); err != nil || len(m.incrs) != 1 {
+		t.Fatalf("manifest after a failed start = %+v, %v; want a single incremental file", m, err)
+	}
+
+	aof, err = NewAof(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aof.Close()
+	if err := aof.Loaded(); err != nil {
+		t.Fatalf("Loaded: %v", err)
+	}
+	aof.Write(command("SET", "k", "secret"))
+
+	if data, _ := os.ReadFile(filepath.Join(dir, aof.manifest.lastIncr().name)); bytes.Contains(data, []byte("secret")) {
+		t.Error("the writes after turning encryption on are in plaintext")
+	}
+	var got []string
+	if err := aof.Read(nil, func(v resp.Value) { got = append(got, v.Array[2].Str) }); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(got) != 2 || got[0] != "plain" || got[1] != "secret" {
+		t.Errorf("Read() = %q; want both SETs", got)
+	}
+}
+
+func TestAof_EncryptedRecordsCannotBeMoved(t *testing.T) {
+	dir := t.TempDir()
+	cfg := AofConfig{Dir: dir, Name: "test.aof", Fsync: FsyncAlways, Cipher: testCipher(t, "0123456789abcdef")}
+	aof, err := NewAof(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aof.Write(command("SET", "a", "1"))
+	aof.Write(command("SET", "b", "2"))
+	path := filepath.Join(dir, aof.manifest.lastIncr().name)
+	aof.Close()
+
+	// the appends after a restart follow the records already written
+	aof, err = NewAof(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aof.Write(command("SET", "c", "3"))
+	aof.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	if _, err := ReadAofFile(bytes.NewReader(data), cfg.Cipher, AofLimit{}, func(v resp.Value) {
+		got = append(got, v.Array[1].Str)
+	}); err != nil || len(got) != 3 {
+		t.Fatalf("ReadAofFile() = %q, %v; want the 3 SETs", got, err)
+	}
+
+	// the records have the same size, swap the first two
+	size := (len(data) - headerSize) / 3
+	first, second := headerSize, headerSize+size
+	swapped := slices.Concat(data[:first], data[second:second+size], data[first:second], data[second+size:])
+	if _, err := ReadAofFile(bytes.NewReader(swapped), cfg.Cipher, AofLimit{}, func(resp.Value) {}); !errors.Is(err, errBadRecord) {
+		t.Errorf("ReadAofFile() of reordered records error = %v; want %v", err, errBadRecord)
+	}
+}
+
+func TestAof_EncryptedNoncesDoNotRepeat(t *testing.T) {
+	dir := t.TempDir()
+	cfg := AofConfig{Dir: dir, Name: "test.aof", Fsync: FsyncAlways, Cipher: testCipher(t, "0123456789abcdef")}
+	for range 2 {
+		aof, err := NewAof(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range 100 {
+			aof.Write(command("SET", "k", "v"))
+		}
+		aof.Close()
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, incrFileName(cfg.Name, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for rest := data[headerSize:]; len(rest) > 0; {
+		size := int(binary.BigEndian.Uint32(rest))
+		nonce := string(rest[4 : 4+nonceSize])
+		if seen[nonce] {
+			t.Fatalf("record %d reuses the nonce %x", len(seen), nonce)
+		}
+		seen[nonce] = true
+		rest = rest[4+nonceSize+size:]
+	}
+	if len(seen) != 200 {
+		t.Errorf("read %d records; want 200", len(seen))
+	}
+}
@@ -0,0 +1,158 @@
+package storage
+
+const minDequeCapacity = 8
+
+// Deque is a growable ring buffer of strings with O(1) pushes and pops at
+// both ends and O(1) random access, used as the list representation.
+type Deque struct {
+	buf   []string
+	head  int
+	len   int
+	bytes int // total length of the stored strings
+}
+
+func NewDeque() *Deque {
+	return &Deque{buf: make([]string, minDequeCapacity)}
+}
+
+func (d *Deque) Len() int {
+	return d.len
+}
+
+func (d *Deque) Bytes() int {
+	return d.bytes
+}
+
+func (d *Deque) index(i int) int {
+	return (d.head + i) % len(d.buf)
+}
+
+func (d *Deque) resize(capacity int) {
+	buf := make([]string, max(capacity, minDequeCapacity))
+	for i := range d.len {
+		buf[i] = d.buf[d.index(i)]
+	}
+	d.buf = buf
+	d.head = 0
+}
+
+func (d *Deque) grow() {
+	if d.len == len(d.buf) {
+		d.resize(len(d.buf) * 2)
+	}
+}
+
+func (d *Deque) shrink() {
+	if len(d.buf) > minDequeCapacity && d.len <= len(d.buf)/4 {
+		d.resize(len(d.buf) / 2)
+	}
+}
+
+func (d *Deque) PushFront(v string) {
+	d.grow()
+	d.head = (d.head - 1 + len(d.buf)) % len(d.buf)
+	d.buf[d.head] = v
+	d.len++
+	d.bytes += len(v)
+}
+
+func (d *Deque) PushBack(v string) {
+	d.grow()
+	d.buf[d.index(d.len)] = v
+	d.len++
+	d.bytes += len(v)
+}
+
+func (d *Deque) PopFront() (string, bool) {
+	if d.len == 0 {
+		return "", false
+	}
+
+	v := d.buf[d.head]
+	d.buf[d.head] = ""
+	d.head = (d.head + 1) % len(d.buf)
+	d.len--
+	d.bytes -= len(v)
+	d.shrink()
+
+	return v, true
+}
+
+func (d *Deque) PopBack() (string, bool) {
+	if d.len == 0 {
+		return "", false
+	}
+
+	idx := d.index(d.len - 1)
+	v := d.buf[idx]
+	d.buf[idx] = ""
+	d.len--
+	d.bytes -= len(v)
+	d.shrink()
+
+	return v, true
+}
+
+// At returns the element at position i, which must be in [0, Len()).
+func (d *Deque) At(i int) string {
+	return d.buf[d.index(i)]
+}
+
+// Set replaces the element at position i, which must be in [0, Len()).
+func (d *Deque) Set(i int, v string) {
+	idx := d.index(i)
+	d.bytes += len(v) - len(d.buf[idx])
+	d.buf[idx] = v
+}
+
+// Range returns a copy of the elements in [start, stop], both already
+// clamped to the bounds of the deque.
+func (d *Deque) Range(start, stop int) []string {
+	if start > stop {
+		return []string{}
+	}
+
+	arr := make([]string, 0, stop-start+1)
+	for i := start; i <= stop; i++ {
+		arr = append(arr, d.At(i))
+	}
+	return arr
+}
+
+// Clone returns an independent copy of the deque.
+func (d *Deque) Clone() *Deque {
+	clone := &Deque{buf: make([]string, len(d.buf)), len: d.len, bytes: d.bytes}
+	for i := range d.len {
+		clone.buf[i] = d.At(i)
+	}
+	return clone
+}
+
+// Insert places v at position i, shifting the following elements back.
+func (d *Deque) Insert(i int, v string) {
+	d.PushBack(v)
+	for j := d.len - 1; j > i; j-- {
+		d.buf[d.index(j)] = d.buf[d.index(j-1)]
+	}
+	d.buf[d.index(i)] = v
+}
+
+// Filter keeps only the elements for which keep returns true, preserving
+// their order.
+func (d *Deque) Filter(keep func(i int, v string) bool) {
+	n := 0
+	for i := range d.len {
+		v := d.At(i)
+		if keep(i, v) {
+			d.buf[d.index(n)] = v
+			n++
+		} else {
+			d.bytes -= len(v)
+		}
+	}
+	for i := n; i < d.len; i++ {
+		d.buf[d.index(i)] = ""
+	}
+	d.len = n
+	d.shrink()
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"log/slog"
+	"time"
+)
+
+const (
+	activeExpireInterval   = 100 * time.Millisecond
+	activeExpireSampleSize = 20
+	activeExpireTimeLimit  = 25 * time.Millisecond
+)
+
+const (
+	TTLKeyNotFound = -2
+	TTLNoExpire    = -1
+)
+
+type ExpireCondition int
+
+const (
+	ExpireAlways ExpireCondition = iota
+	ExpireNX                     // only when the key has no expiry
+	ExpireXX                     // only when the key already has an expiry
+	ExpireGT                     // only when the new expiry is greater than the current one
+	ExpireLT                     // only when the new expiry is less than the current one
+)
+
+// now returns the current unix time in milliseconds, overridden in tests.
+var now = func() int64 {
+	return time.Now().UnixMilli()
+}
+
+func (s *Shard) isExpired(key string) bool {
+	when, ok := s.Expires[key]
+	return ok && when <= now()
+}
+
+// expireIfNeeded deletes key if its deadline has passed, along with the
+// expired fields of a hash, and reports whether the key was deleted.
+// Caller must hold the write lock.
+func (s *Shard) expireIfNeeded(key string) bool {
+	if !s.isExpired(key) {
+		_, deleted := s.expireFields(key)
+		return deleted
+	}
+
+	slog.Debug("Expired key", "shard", s.Id, "key", key)
+	s.remove(key)
+	return true
+}
+
+// rlockKey read-locks the shard, deleting key or its expired hash fields
+// first if their deadline has already passed.
+func (s *Shard) rlockKey(key string) {
+	s.Mu.RLock()
+	if !s.isExpired(key) && !s.hasExpiredFields(key) {
+		return
+	}
+	s.Mu.RUnlock()
+
+	s.Mu.Lock()
+	s.expireIfNeeded(key)
+	s.Mu.Unlock()
+
+	s.Mu.RLock()
+}
+
+// ExpireAt sets the deadline of key to the unix time at (in milliseconds).
+// A deadline in the past deletes the key right away.
+func (s *Shard) ExpireAt(key string, at int64, cond ExpireCondition) bool {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	if _, ok := s.Store[key]; !ok {
+		return false
+	}
+
+	current, hasExpiry := s.Expires[key]
+	if !expireConditionMet(cond, current, hasExpiry, at) {
+		return false
+	}
+
+	if at <= now() {
+		s.remove(key)
+		return true
+	}
+
+	s.Expires[key] = at
+	return true
+}
+
+// expireConditionMet reports whether a deadline currently set to current, if
+// hasExpiry, may be replaced by at under cond. No deadline counts as infinite.
+func expireConditionMet(cond ExpireCondition, current int64, hasExpiry bool, at int64) bool {
+	switch cond {
+	case ExpireNX:
+		return !hasExpiry
+	case ExpireXX:
+		return hasExpiry
+	case ExpireGT:
+		return hasExpiry && at > current
+	case ExpireLT:
+		return !hasExpiry || at < current
+	}
+	return true
+}
+
+// TTL returns the remaining time to live of key in milliseconds,
+// or TTLKeyNotFound/TTLNoExpire.
+func (s *Shard) TTL(key string) int64 {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	if _, ok := s.lookup(key); !ok {
+		return TTLKeyNotFound
+	}
+
+	when, ok := s.Expires[key]
+	if !ok {
+		return TTLNoExpire
+	}
+
+	return max(when-now(), 0)
+}
+
+func (s *Shard) Persist(key string) bool {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	if _, ok := s.Expires[key]; !ok {
+		return false
+	}
+
+	delete(s.Expires, key)
+	return true
+}
+
+// activeExpireCycle samples keys with a deadline and hashes with field
+// deadlines, deleting what expired, and repeats while more than a quarter of
+// the sample was expired.
+func (s *Shard) activeExpireCycle() int {
+	start := time.Now()
+	total := 0
+
+	for time.Since(start) < activeExpireTimeLimit {
+		s.Mu.Lock()
+		sampledKeys, sampledHashes, expired := 0, 0, 0
+		ts := now()
+		for key, when := range s.Expires {
+			if sampledKeys >= activeExpireSampleSize {
+				break
+			}
+			sampledKeys++
+			if when <= ts {
+				s.remove(key)
+				expired++
+			}
+		}
+		for key := range s.expiringHashes {
+			if sampledHashes >= activeExpireSampleSize {
+				break
+			}
+			sampledHashes++
+			if fields, _ := s.expireFields(key); fields > 0 {
+				expired++
+			}
+		}
+		s.Mu.Unlock()
+
+		total += expired
+		if expired <= (sampledKeys+sampledHashes)/4 {
+			break
+		}
+	}
+
+	return total
+}
+
+// ActiveExpire periodically reclaims expired keys that are never accessed
+// again, until done is closed.
+func ActiveExpire(done <-chan struct{}) {
+	ticker := time.NewTicker(activeExpireInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			for _, s := range shards {
+				if expired := s.activeExpireCycle(); expired > 0 {
+					slog.Debug("Active expire", "shard", s.Id, "expired", expired)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/devkarim/goredis/eviction"
+)
+
+func withClock(t *testing.T, ms int64) *int64 {
+	t.Helper()
+	clock := ms
+	original := now
+	now = func() int64 { return clock }
+	t.Cleanup(func() { now = original })
+	return &clock
+}
+
+func TestExpire_LazyOnGet(t *testing.T) {
+	clock := withClock(t, 1000)
+	shard := NewShard(0, eviction.NewLRU(), 100)
+
+	shard.SetString("a", "12345")
+	shard.ExpireAt("a", 2000, ExpireAlways)
+
+	if _, found, _ := shard.GetString("a"); !found {
+		t.Errorf("'a' should exist before its deadline")
+	}
+
+	*clock = 2000
+
+	if _, found, _ := shard.GetString("a"); found {
+		t.Errorf("'a' should have expired")
+	}
+	if _, ok := shard.Store["a"]; ok {
+		t.Errorf("'a' should have been deleted on access")
+	}
+	if shard.CurrentMemory != 0 {
+		t.Errorf("CurrentMemory = %d; want 0", shard.CurrentMemory)
+	}
+}
+
+func TestExpire_SetClearsDeadline(t *testing.T) {
+	withClock(t, 1000)
+	shard := NewShard(0, eviction.NewLRU(), 100)
+
+	shard.SetString("a", "1")
+	shard.ExpireAt("a", 5000, ExpireAlways)
+	shard.SetString("a", "2")
+
+	if got := shard.TTL("a"); got != TTLNoExpire {
+		t.Errorf("TTL = %d; want %d", got, TTLNoExpire)
+	}
+}
+
+func TestExpire_Conditions(t *testing.T) {
+	withClock(t, 1000)
+	shard := NewShard(0, eviction.NewLRU(), 100)
+	shard.SetString("a", "1")
+
+	if shard.ExpireAt("a", 5000, ExpireXX) {
+		t.Errorf("XX should fail on a key without expiry")
+	}
+	if !shard.ExpireAt("a", 5000, ExpireNX) {
+		t.Errorf("NX should succeed on a key without expiry")
+	}
+	if shard.ExpireAt("a", 4000, ExpireGT) {
+		t.Errorf("GT should fail with an earlier deadline")
+	}
+	if !shard.ExpireAt("a", 3000, ExpireLT) {
+		t.Errorf("LT should succeed with an earlier deadline")
+	}
+
+	if got := shard.TTL("a"); got != 2000 {
+		t.Errorf("TTL = %d; want 2000", got)
+	}
+}
+
+func TestExpire_PastDeadlineDeletes(t *testing.T) {
+	withClock(t, 1000)
+	shard := NewShard(0, eviction.NewLRU(), 100)
+	shard.SetString("a", "1")
+
+	if !shard.ExpireAt("a", 500, ExpireAlways) {
+		t.Errorf("ExpireAt should report the key as expired")
+	}
+	if got := shard.TTL("a"); got != TTLKeyNotFound {
+		t.Errorf("TTL = %d; want %d", got, TTLKeyNotFound)
+	}
+}
+
+func TestExpire_Persist(t *testing.T) {
+	withClock(t, 1000)
+	shard := NewShard(0, eviction.NewLRU(), 100)
+	shard.HSet("h", []HashField{{Field: "f", Value: "v"}})
+	shard.ExpireAt("h", 5000, ExpireAlways)
+
+	if !shard.Persist("h") {
+		t.Errorf("Persist should remove the deadline")
+	}
+	if shard.Persist("h") {
+		t.Errorf("Persist should be a no-op without a deadline")
+	}
+}
+
+func TestExpire_ActiveCycle(t *testing.T) {
+	clock := withClock(t, 1000)
+	shard := NewShard(0, eviction.NewLRU(), 1000)
+
+	for _, key := range []string{"a", "b", "c"} {
+		shard.SetString(key, "12345")
+		shard.ExpireAt(key, 2000, ExpireAlways)
+	}
+	shard.SetString("d", "12345")
+
+	*clock = 3000
+	shard.activeExpireCycle()
+
+	if len(shard.Store) != 1 || len(shard.Expires) != 0 {
+		t.Errorf("expected only 'd' to remain, got %d keys and %d deadlines", len(shard.Store), len(shard.Expires))
+	}
+	if shard.CurrentMemory != 5 {
+		t.Errorf("CurrentMemory = %d; want 5", shard.CurrentMemory)
+	}
+}
@@ -0,0 +1,252 @@
+package storage
+
+import "container/heap"
+
+// Replies of HExpireAt and HPersist for each field, matching Redis.
+const (
+	FieldNotFound        = -2
+	FieldNoExpire        = -1 // HPersist: the field has no deadline
+	FieldConditionNotMet = 0  // HExpireAt: the NX/XX/GT/LT condition was not met
+	FieldUpdated         = 1  // the deadline was set or removed
+	FieldDeleted         = 2  // HExpireAt: the deadline was in the past
+)
+
+// trackHashExpires registers key for the active expiry of hash fields.
+// Caller must hold the write lock.
+func (s *Shard) trackHashExpires(key string) {
+	if s.expiringHashes == nil {
+		s.expiringHashes = map[string]struct{}{}
+	}
+	s.expiringHashes[key] = struct{}{}
+}
+
+// fieldDeadline is a deadline of a hash field.
+type fieldDeadline struct {
+	at    int64
+	field string
+}
+
+// fieldDeadlines is a min-heap of the deadlines of the fields of a hash,
+// which tells when the next field expires without walking them all. An
+// entry is left in place when its deadline changes or is cleared, and
+// skipped once it no longer matches HashExpires.
+type fieldDeadlines []fieldDeadline
+
+func (h fieldDeadlines) Len() int           { return len(h) }
+func (h fieldDeadlines) Less(i, j int) bool { return h[i].at < h[j].at }
+func (h fieldDeadlines) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *fieldDeadlines) Push(x any)        { *h = append(*h, x.(fieldDeadline)) }
+
+func (h *fieldDeadlines) Pop() any {
+	old := *h
+	d := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return d
+}
+
+// setFieldExpire sets the deadline of field to at.
+func (r *RedisObject) setFieldExpire(field string, at int64) {
+	if r.HashExpires == nil {
+		r.HashExpires = map[string]int64{}
+	}
+	r.HashExpires[field] = at
+	heap.Push(&r.fieldDeadlines, fieldDeadline{at, field})
+
+	// stale entries are dropped once they outnumber the others
+	if len(r.fieldDeadlines) > 2*len(r.HashExpires) {
+		r.fieldDeadlines = r.fieldDeadlines[:0]
+		for field, at := range r.HashExpires {
+			r.fieldDeadlines = append(r.fieldDeadlines, fieldDeadline{at, field})
+		}
+		heap.Init(&r.fieldDeadlines)
+	}
+}
+
+// nextFieldExpire returns the earliest deadline of a field of the hash, or
+// one that is earlier than it and stale, false when there is none.
+func (r *RedisObject) nextFieldExpire() (int64, bool) {
+	if len(r.fieldDeadlines) == 0 {
+		return 0, false
+	}
+	return r.fieldDeadlines[0].at, true
+}
+
+// clearFieldExpire drops the deadline of field, if any.
+// Caller must hold the write lock.
+func (s *Shard) clearFieldExpire(key string, obj *RedisObject, field string) {
+	if obj.HashExpires == nil {
+		return
+	}
+
+	delete(obj.HashExpires, field)
+	if len(obj.HashExpires) == 0 {
+		obj.HashExpires = nil
+		obj.fieldDeadlines = nil
+		delete(s.expiringHashes, key)
+	}
+}
+
+func (s *Shard) hasExpiredFields(key string) bool {
+	if _, ok := s.expiringHashes[key]; !ok {
+		return false
+	}
+
+	at, ok := s.Store[key].nextFieldExpire()
+	return ok && at <= now()
+}
+
+// expireFields deletes the fields of the hash at key whose deadline has
+// passed, then the key itself once the hash is empty. It returns the number
+// of fields deleted and whether the key was deleted.
+// Caller must hold the write lock.
+func (s *Shard) expireFields(key string) (int, bool) {
+	if _, ok := s.expiringHashes[key]; !ok {
+		return 0, false
+	}
+
+	obj := s.Store[key]
+	ts := now()
+	expired := 0
+	for {
+		at, ok := obj.nextFieldExpire()
+		if !ok || at > ts {
+			break
+		}
+		d := heap.Pop(&obj.fieldDeadlines).(fieldDeadline)
+		if when, ok := obj.HashExpires[d.field]; !ok || when != d.at {
+			continue
+		}
+		s.CurrentMemory -= len(d.field) + len(obj.Hash[d.field])
+		delete(obj.Hash, d.field)
+		s.clearFieldExpire(key, obj, d.field)
+		expired++
+	}
+
+	if len(obj.Hash) == 0 {
+		s.remove(key)
+		return expired, true
+	}
+	if expired > 0 {
+		s.touch(key)
+	}
+	return expired, false
+}
+
+// HExpireAt sets the deadline of fields of the hash at key to the unix time
+// at (in milliseconds) and returns the outcome for each field. A deadline in
+// the past deletes the field right away.
+func (s *Shard) HExpireAt(key string, fields []string, at int64, cond ExpireCondition) ([]int, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	results := make([]int, len(fields))
+
+	obj, ok, err := s.lookupType(key, RedisObjectHash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		for i := range results {
+			results[i] = FieldNotFound
+		}
+		return results, nil
+	}
+
+	for i, field := range fields {
+		if _, ok := obj.Hash[field]; !ok {
+			results[i] = FieldNotFound
+			continue
+		}
+
+		current, hasExpiry := obj.HashExpires[field]
+		if !expireConditionMet(cond, current, hasExpiry, at) {
+			results[i] = FieldConditionNotMet
+			continue
+		}
+
+		if at <= now() {
+			s.CurrentMemory -= len(field) + len(obj.Hash[field])
+			delete(obj.Hash, field)
+			s.clearFieldExpire(key, obj, field)
+			results[i] = FieldDeleted
+			continue
+		}
+
+		if obj.HashExpires == nil {
+			s.trackHashExpires(key)
+		}
+		obj.setFieldExpire(field, at)
+		results[i] = FieldUpdated
+	}
+
+	if len(obj.Hash) == 0 {
+		s.remove(key)
+	}
+
+	return results, nil
+}
+
+// HTTL returns the remaining time to live of fields in milliseconds, or
+// TTLKeyNotFound/TTLNoExpire for each of them.
+func (s *Shard) HTTL(key string, fields []string) ([]int64, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectHash)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]int64, len(fields))
+	for i, field := range fields {
+		if !ok {
+			results[i] = TTLKeyNotFound
+			continue
+		}
+		if _, exists := obj.Hash[field]; !exists {
+			results[i] = TTLKeyNotFound
+			continue
+		}
+		when, hasExpiry := obj.HashExpires[field]
+		if !hasExpiry {
+			results[i] = TTLNoExpire
+			continue
+		}
+		results[i] = max(when-now(), 0)
+	}
+
+	return results, nil
+}
+
+// HPersist removes the deadline of fields and returns the outcome for each.
+func (s *Shard) HPersist(key string, fields []string) ([]int, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	obj, ok, err := s.lookupType(key, RedisObjectHash)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]int, len(fields))
+	for i, field := range fields {
+		if !ok {
+			results[i] = FieldNotFound
+			continue
+		}
+		if _, exists := obj.Hash[field]; !exists {
+			results[i] = FieldNotFound
+			continue
+		}
+		if _, hasExpiry := obj.HashExpires[field]; !hasExpiry {
+			results[i] = FieldNoExpire
+			continue
+		}
+		s.clearFieldExpire(key, obj, field)
+		results[i] = FieldUpdated
+	}
+
+	return results, nil
+}
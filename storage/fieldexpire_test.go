@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/devkarim/goredis/eviction"
+)
+
+func TestFieldExpire_Lazy(t *testing.T) {
+	clock := withClock(t, 1000)
+	shard := NewShard(0, eviction.NewLRU(), 100)
+
+	shard.HSet("h", []HashField{{"a", "1"}, {"b", "2"}})
+	results, _ := shard.HExpireAt("h", []string{"a", "zz"}, 2000, ExpireAlways)
+	if !slices.Equal(results, []int{FieldUpdated, FieldNotFound}) {
+		t.Errorf("HExpireAt = %v; want [1 -2]", results)
+	}
+
+	*clock = 2000
+
+	if _, found, _ := shard.HGet("h", "a"); found {
+		t.Errorf("field 'a' should have expired")
+	}
+	if n, _ := shard.HLen("h"); n != 1 {
+		t.Errorf("HLen = %d; want 1", n)
+	}
+	if shard.CurrentMemory != len("b2") {
+		t.Errorf("CurrentMemory = %d; want %d", shard.CurrentMemory, len("b2"))
+	}
+
+	shard.HExpireAt("h", []string{"b"}, 1000, ExpireAlways)
+	if _, ok := shard.Store["h"]; ok {
+		t.Errorf("a hash whose last field expired should be deleted")
+	}
+	if len(shard.expiringHashes) != 0 {
+		t.Errorf("deleted hash is still tracked for active expiry")
+	}
+}
+
+func TestFieldExpire_ActiveCycle(t *testing.T) {
+	clock := withClock(t, 1000)
+	shard := NewShard(0, eviction.NewLRU(), 100)
+
+	shard.HSet("h", []HashField{{"a", "1"}, {"b", "2"}})
+	shard.HExpireAt("h", []string{"a"}, 2000, ExpireAlways)
+
+	*clock = 3000
+	shard.activeExpireCycle()
+
+	if _, ok := shard.Store["h"].Hash["a"]; ok {
+		t.Errorf("field 'a' should have been reclaimed")
+	}
+	if shard.CurrentMemory != len("b2") {
+		t.Errorf("CurrentMemory = %d; want %d", shard.CurrentMemory, len("b2"))
+	}
+}
+
+func TestFieldExpire_HSetClearsDeadline(t *testing.T) {
+	withClock(t, 1000)
+	shard := NewShard(0, eviction.NewLRU(), 100)
+
+	shard.HSet("h", []HashField{{"a", "1"}})
+	shard.HExpireAt("h", []string{"a"}, 5000, ExpireAlways)
+	shard.HIncrBy("h", "a", 1)
+
+	if ttls, _ := shard.HTTL("h", []string{"a"}); ttls[0] != 4000 {
+		t.Errorf("HTTL after HINCRBY = %d; want 4000", ttls[0])
+	}
+
+	shard.HSet("h", []HashField{{"a", "1"}})
+
+	if ttls, _ := shard.HTTL("h", []string{"a"}); ttls[0] != TTLNoExpire {
+		t.Errorf("HTTL after HSET = %d; want %d", ttls[0], TTLNoExpire)
+	}
+}
+
+func TestFieldExpire_Rename(t *testing.T) {
+	withClock(t, 1000)
+	Setup(eviction.PolicyLRU, 1000)
+	src := "a"
+	dst := keyOnOtherShard(src)
+
+	GetShard(src).HSet(src, []HashField{{"f", "v"}})
+	GetShard(src).HExpireAt(src, []string{"f"}, 2000, ExpireAlways)
+	Rename(src, dst, false)
+
+	if _, ok := GetShard(dst).expiringHashes[dst]; !ok {
+		t.Errorf("renamed hash should be tracked for active expiry")
+	}
+	if ttls, _ := GetShard(dst).HTTL(dst, []string{"f"}); ttls[0] != 1000 {
+		t.Errorf("HTTL = %d; want 1000", ttls[0])
+	}
+}
+
+func TestFieldExpire_ChangedDeadlines(t *testing.T) {
+	clock := withClock(t, 1000)
+	shard := NewShard(0, eviction.NewLRU(), 1<<20)
+
+	shard.HSet("h", []HashField{{"a", "1"}, {"b", "2"}, {"c", "3"}})
+	shard.HExpireAt("h", []string{"a", "b", "c"}, 2000, ExpireAlways)
+	shard.HExpireAt("h", []string{"a"}, 5000, ExpireAlways)
+	shard.HPersist("h", []string{"b"})
+	for at := range int64(100) {
+		shard.HExpireAt("h", []string{"c"}, 4000+at, ExpireAlways)
+	}
+
+	*clock = 3000
+	if n, _ := shard.HLen("h"); n != 3 {
+		t.Errorf("HLen = %d; want 3, the earlier deadlines were replaced", n)
+	}
+	if got := len(shard.Store["h"].fieldDeadlines); got > 2*2 {
+		t.Errorf("%d deadlines kept for 2 fields with one", got)
+	}
+
+	*clock = 4200
+	if _, found, _ := shard.HGet("h", "c"); found {
+		t.Errorf("field 'c' should have expired at its last deadline")
+	}
+	if _, found, _ := shard.HGet("h", "a"); !found {
+		t.Errorf("field 'a' expired before its deadline")
+	}
+}
@@ -0,0 +1,345 @@
+package storage
+
+import (
+	"errors"
+	"math/rand/v2"
+	"strconv"
+)
+
+var (
+	ErrHashNotInteger = errors.New("ERR hash value is not an integer")
+	ErrHashNotFloat   = errors.New("ERR hash value is not a float")
+)
+
+type HashField struct {
+	Field string
+	Value string
+}
+
+func newHashObject() *RedisObject {
+	return &RedisObject{Type: RedisObjectHash, Hash: map[string]string{}}
+}
+
+// HSet sets fields of the hash at key, creating it when missing, and returns
+// the number of fields that were added rather than updated. Setting a field
+// drops its deadline.
+func (s *Shard) HSet(key string, fields []HashField) (int, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	obj, _, err := s.lookupType(key, RedisObjectHash)
+	if err != nil {
+		return 0, err
+	}
+
+	neededSize := 0
+	for _, f := range fields {
+		neededSize += len(f.Field) + len(f.Value)
+		if obj != nil {
+			if old, ok := obj.Hash[f.Field]; ok {
+				neededSize -= len(f.Field) + len(old)
+			}
+		}
+	}
+
+	obj, err = s.prepareWrite(key, RedisObjectHash, neededSize, newHashObject)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, f := range fields {
+		if old, ok := obj.Hash[f.Field]; ok {
+			s.CurrentMemory -= len(f.Field) + len(old)
+		} else {
+			added++
+		}
+		obj.Hash[f.Field] = f.Value
+		s.clearFieldExpire(key, obj, f.Field)
+		s.CurrentMemory += len(f.Field) + len(f.Value)
+	}
+
+	return added, nil
+}
+
+// HSetNX sets field only if it does not exist yet.
+func (s *Shard) HSetNX(key, field, val string) (bool, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	obj, ok, err := s.lookupType(key, RedisObjectHash)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		if _, exists := obj.Hash[field]; exists {
+			return false, nil
+		}
+	}
+
+	obj, err = s.prepareWrite(key, RedisObjectHash, len(field)+len(val), newHashObject)
+	if err != nil {
+		return false, err
+	}
+	obj.Hash[field] = val
+	s.CurrentMemory += len(field) + len(val)
+
+	return true, nil
+}
+
+// HDel removes fields from the hash at key, deleting the key once the hash
+// is empty, and returns the number of fields removed.
+func (s *Shard) HDel(key string, fields []string) (int, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	obj, ok, err := s.lookupType(key, RedisObjectHash)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	removed := 0
+	for _, field := range fields {
+		if val, ok := obj.Hash[field]; ok {
+			delete(obj.Hash, field)
+			s.clearFieldExpire(key, obj, field)
+			s.CurrentMemory -= len(field) + len(val)
+			removed++
+		}
+	}
+
+	if len(obj.Hash) == 0 {
+		s.remove(key)
+	}
+
+	return removed, nil
+}
+
+// updateHashField replaces the value of field in the hash at key with the
+// result of update, creating the hash and the field when missing.
+func (s *Shard) updateHashField(key, field string, update func(old string, found bool) (string, error)) (string, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	obj, ok, err := s.lookupType(key, RedisObjectHash)
+	if err != nil {
+		return "", err
+	}
+
+	old, found := "", false
+	if ok {
+		old, found = obj.Hash[field]
+	}
+	val, err := update(old, found)
+	if err != nil {
+		return "", err
+	}
+
+	neededSize := len(val) - len(old)
+	if !found {
+		neededSize += len(field)
+	}
+
+	obj, err = s.prepareWrite(key, RedisObjectHash, neededSize, newHashObject)
+	if err != nil {
+		return "", err
+	}
+	// the hash may have been evicted and recreated empty
+	if current, ok := obj.Hash[field]; ok {
+		s.CurrentMemory -= len(field) + len(current)
+	}
+	obj.Hash[field] = val
+	s.CurrentMemory += len(field) + len(val)
+
+	return val, nil
+}
+
+// HIncrBy adds delta to the integer stored in field of the hash at key.
+func (s *Shard) HIncrBy(key, field string, delta int64) (int64, error) {
+	var result int64
+	_, err := s.updateHashField(key, field, func(old string, found bool) (string, error) {
+		n := int64(0)
+		if found {
+			var ok bool
+			if n, ok = parseInt(old); !ok {
+				return "", ErrHashNotInteger
+			}
+		}
+
+		var err error
+		result, err = addInt(n, delta)
+		return strconv.FormatInt(result, 10), err
+	})
+
+	return result, err
+}
+
+// HIncrByFloat adds delta to the number stored in field of the hash at key
+// and returns the new value as stored.
+func (s *Shard) HIncrByFloat(key, field string, delta float64) (string, error) {
+	return s.updateHashField(key, field, func(old string, found bool) (string, error) {
+		f := 0.0
+		if found {
+			var ok bool
+			if f, ok = parseFloat(old); !ok {
+				return "", ErrHashNotFloat
+			}
+		}
+
+		sum, err := addFloat(f, delta)
+		return formatFloat(sum), err
+	})
+}
+
+func (s *Shard) HGet(hash, key string) (string, bool, error) {
+	s.rlockKey(hash)
+	defer s.Mu.RUnlock()
+
+	obj, ok := s.lookup(hash)
+	if !ok {
+		return "", false, nil
+	}
+	if obj.Type != RedisObjectHash {
+		return "", false, ErrWrongType
+	}
+
+	s.Policy.Access(hash)
+
+	val, ok := obj.Hash[key]
+	if !ok {
+		return "", false, nil
+	}
+
+	return val, true, nil
+}
+
+func (s *Shard) HGetAll(hash string) ([]string, bool, error) {
+	s.rlockKey(hash)
+	defer s.Mu.RUnlock()
+
+	obj, ok := s.lookup(hash)
+	if !ok {
+		return []string{}, false, nil
+	}
+	if obj.Type != RedisObjectHash {
+		return []string{}, false, ErrWrongType
+	}
+
+	s.Policy.Access(hash)
+
+	arr := make([]string, len(obj.Hash)*2)
+	idx := 0
+	for key, value := range obj.Hash {
+		arr[idx] = key
+		arr[idx+1] = value
+		idx += 2
+	}
+
+	return arr, true, nil
+}
+
+// lookupHash read-locks the shard and returns the hash at key, or nil when
+// missing. The caller must release the read lock.
+func (s *Shard) lookupHash(key string) (map[string]string, error) {
+	s.rlockKey(key)
+
+	obj, ok, err := s.lookupType(key, RedisObjectHash)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return obj.Hash, nil
+}
+
+func (s *Shard) HExists(key, field string) (bool, error) {
+	hash, err := s.lookupHash(key)
+	defer s.Mu.RUnlock()
+
+	_, ok := hash[field]
+	return ok, err
+}
+
+func (s *Shard) HLen(key string) (int, error) {
+	hash, err := s.lookupHash(key)
+	defer s.Mu.RUnlock()
+
+	return len(hash), err
+}
+
+func (s *Shard) HStrLen(key, field string) (int, error) {
+	hash, err := s.lookupHash(key)
+	defer s.Mu.RUnlock()
+
+	return len(hash[field]), err
+}
+
+func (s *Shard) HKeys(key string) ([]string, error) {
+	hash, err := s.lookupHash(key)
+	defer s.Mu.RUnlock()
+
+	arr := make([]string, 0, len(hash))
+	for field := range hash {
+		arr = append(arr, field)
+	}
+	return arr, err
+}
+
+func (s *Shard) HVals(key string) ([]string, error) {
+	hash, err := s.lookupHash(key)
+	defer s.Mu.RUnlock()
+
+	arr := make([]string, 0, len(hash))
+	for _, val := range hash {
+		arr = append(arr, val)
+	}
+	return arr, err
+}
+
+// HMGet returns the values of fields, along with whether each one exists.
+func (s *Shard) HMGet(key string, fields []string) ([]string, []bool, error) {
+	hash, err := s.lookupHash(key)
+	defer s.Mu.RUnlock()
+
+	vals := make([]string, len(fields))
+	found := make([]bool, len(fields))
+	for i, field := range fields {
+		vals[i], found[i] = hash[field]
+	}
+	return vals, found, err
+}
+
+// HRandField returns count distinct random fields, or -count fields that may
+// repeat when count is negative, like SRandMember.
+func (s *Shard) HRandField(key string, count int) ([]HashField, error) {
+	hash, err := s.lookupHash(key)
+	defer s.Mu.RUnlock()
+
+	if len(hash) == 0 {
+		return []HashField{}, err
+	}
+
+	all := make([]HashField, 0, len(hash))
+	for field, val := range hash {
+		all = append(all, HashField{Field: field, Value: val})
+	}
+
+	if count < 0 {
+		arr := make([]HashField, -count)
+		for i := range arr {
+			arr[i] = all[rand.IntN(len(all))]
+		}
+		return arr, nil
+	}
+
+	if count >= len(all) {
+		return all, nil
+	}
+	for i := range count {
+		j := i + rand.IntN(len(all)-i)
+		all[i], all[j] = all[j], all[i]
+	}
+	return all[:count], nil
+}
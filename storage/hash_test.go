@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/devkarim/goredis/eviction"
+)
+
+func TestHash_MemoryAccounting(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 100)
+
+	added, _ := shard.HSet("h", []HashField{{"a", "1"}, {"b", "22"}, {"a", "333"}})
+	if added != 2 {
+		t.Errorf("HSet added = %d; want 2", added)
+	}
+	if want := len("a333") + len("b22"); shard.CurrentMemory != want {
+		t.Errorf("CurrentMemory = %d; want %d", shard.CurrentMemory, want)
+	}
+
+	shard.HSetNX("h", "c", "4")
+	shard.HSetNX("h", "c", "55555")
+	if want := len("a333") + len("b22") + len("c4"); shard.CurrentMemory != want {
+		t.Errorf("CurrentMemory = %d; want %d", shard.CurrentMemory, want)
+	}
+
+	if removed, _ := shard.HDel("h", []string{"a", "b", "c", "d"}); removed != 3 {
+		t.Errorf("HDel removed = %d; want 3", removed)
+	}
+	if shard.CurrentMemory != 0 {
+		t.Errorf("CurrentMemory = %d; want 0", shard.CurrentMemory)
+	}
+	if _, ok := shard.Store["h"]; ok {
+		t.Errorf("an emptied hash should be deleted")
+	}
+}
+
+func TestHash_Eviction(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 10)
+
+	shard.HSet("h1", []HashField{{"a", "1234"}})
+	shard.HSet("h2", []HashField{{"b", "1234"}})
+	shard.HSet("h2", []HashField{{"c", "1234"}})
+
+	if _, ok := shard.Store["h1"]; ok {
+		t.Errorf("'h1' should have been evicted")
+	}
+	if shard.CurrentMemory != 10 {
+		t.Errorf("CurrentMemory = %d; want 10", shard.CurrentMemory)
+	}
+}
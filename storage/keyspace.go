@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"errors"
+	"math/rand/v2"
+)
+
+var ErrSameObject = errors.New("ERR source and destination objects are the same")
+
+const typeNone = "none"
+
+// lockAll write-locks every shard in ascending id order.
+func lockAll() func() {
+	for _, shard := range shards {
+		shard.Mu.Lock()
+	}
+
+	return func() {
+		for i := len(shards) - 1; i >= 0; i-- {
+			shards[i].Mu.Unlock()
+		}
+	}
+}
+
+// store puts obj at key, which must not exist, making room for it first.
+// expireAt is the deadline to carry over, 0 for none.
+// Caller must hold the write lock.
+func (s *Shard) store(key string, obj *RedisObject, expireAt int64) {
+	size := obj.Size()
+	s.evict(size)
+
+	s.put(key, obj)
+	s.CurrentMemory += size
+	if expireAt > 0 {
+		s.Expires[key] = expireAt
+	}
+	if len(obj.HashExpires) > 0 {
+		s.trackHashExpires(key)
+	}
+	s.Policy.Access(key)
+	s.touch(key)
+}
+
+// Delete removes keys and returns how many of them existed.
+func Delete(keys []string) int {
+	unlock := lockShards(keys...)
+	defer unlock()
+
+	deleted := 0
+	for _, key := range keys {
+		shard := GetShard(key)
+		shard.expireIfNeeded(key)
+		if _, ok := shard.Store[key]; ok {
+			shard.remove(key)
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+// Exists returns how many of keys exist, counting repeated keys every time.
+func Exists(keys []string) int {
+	count := 0
+	for _, key := range keys {
+		shard := GetShard(key)
+		shard.rlockKey(key)
+		if _, ok := shard.lookup(key); ok {
+			count++
+		}
+		shard.Mu.RUnlock()
+	}
+
+	return count
+}
+
+// Type returns the type of the value stored at key, or "none".
+func (s *Shard) Type(key string) string {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok := s.lookup(key)
+	if !ok {
+		return typeNone
+	}
+	return string(obj.Type)
+}
+
+// Rename moves the value at src, along with its deadline, to dst. When nx is
+// set it does nothing if dst already exists. Both shards are held for the
+// whole operation, so no client can see the key missing from both places.
+func Rename(src, dst string, nx bool) (bool, error) {
+	unlock := lockShards(src, dst)
+	defer unlock()
+
+	srcShard, dstShard := GetShard(src), GetShard(dst)
+	srcShard.expireIfNeeded(src)
+	dstShard.expireIfNeeded(dst)
+
+	obj, ok := srcShard.Store[src]
+	if !ok {
+		return false, ErrNoSuchKey
+	}
+	if src == dst {
+		return !nx, nil
+	}
+	if _, ok := dstShard.Store[dst]; ok {
+		if nx {
+			return false, nil
+		}
+		dstShard.remove(dst)
+	}
+
+	expireAt := srcShard.Expires[src]
+	srcShard.remove(src)
+	dstShard.store(dst, obj, expireAt)
+
+	return true, nil
+}
+
+// Copy stores a deep copy of the value at src, along with its deadline, at
+// dst. It does nothing if dst already exists unless replace is set.
+func Copy(src, dst string, replace bool) (bool, error) {
+	if src == dst {
+		return false, ErrSameObject
+	}
+
+	unlock := lockShards(src, dst)
+	defer unlock()
+
+	srcShard, dstShard := GetShard(src), GetShard(dst)
+	srcShard.expireIfNeeded(src)
+	dstShard.expireIfNeeded(dst)
+
+	obj, ok := srcShard.Store[src]
+	if !ok {
+		return false, nil
+	}
+	if _, ok := dstShard.Store[dst]; ok {
+		if !replace {
+			return false, nil
+		}
+		dstShard.remove(dst)
+	}
+
+	srcShard.Policy.Access(src)
+	dstShard.store(dst, obj.Clone(), srcShard.Expires[src])
+
+	return true, nil
+}
+
+// RandomKey returns a random live key, picking shards proportionally to
+// their size.
+func RandomKey() (string, bool) {
+	unlock := lockAll()
+	defer unlock()
+
+	for {
+		total := 0
+		for _, shard := range shards {
+			total += len(shard.Store)
+		}
+		if total == 0 {
+			return "", false
+		}
+
+		n := rand.IntN(total)
+		for _, shard := range shards {
+			if n >= len(shard.Store) {
+				n -= len(shard.Store)
+				continue
+			}
+
+			for key := range shard.Store {
+				if n > 0 {
+					n--
+					continue
+				}
+				// an expired key is deleted and another one is drawn
+				if !shard.expireIfNeeded(key) {
+					return key, true
+				}
+				break
+			}
+			break
+		}
+	}
+}
+
+// DBSize returns the number of keys, including expired keys that have not
+// been reclaimed yet.
+func DBSize() int {
+	size := 0
+	for _, shard := range shards {
+		shard.Mu.RLock()
+		size += len(shard.Store)
+		shard.Mu.RUnlock()
+	}
+
+	return size
+}
+
+// ExpiresSize returns the number of keys with a deadline.
+func ExpiresSize() int {
+	size := 0
+	for _, shard := range shards {
+		shard.Mu.RLock()
+		size += len(shard.Expires)
+		shard.Mu.RUnlock()
+	}
+
+	return size
+}
+
+// Flush deletes every key. The old keyspace is dropped for the garbage
+// collector to reclaim, so it is never walked while the shards are locked.
+func Flush() {
+	unlock := lockAll()
+	defer unlock()
+
+	for _, shard := range shards {
+		shard.flush()
+	}
+}
+
+// flush empties the shard, dropping its previous maps.
+// Caller must hold the write lock.
+func (s *Shard) flush() {
+	for key := range s.watchers {
+		if _, ok := s.Store[key]; ok {
+			s.touch(key)
+		}
+	}
+
+	s.Store = map[string]*RedisObject{}
+	s.Expires = map[string]int64{}
+	s.buckets = nil
+	s.expiringHashes = nil
+	s.CurrentMemory = 0
+	s.Policy.Reset()
+}
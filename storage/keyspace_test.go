@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"runtime"
+	"testing"
+	"weak"
+
+	"github.com/devkarim/goredis/eviction"
+)
+
+// keyOnOtherShard returns a key that does not live on the shard of key.
+func keyOnOtherShard(key string) string {
+	other := "b"
+	for i := 0; GetShard(other) == GetShard(key); i++ {
+		other = "b" + string(rune('0'+i))
+	}
+	return other
+}
+
+func TestSetup_PolicyPerShard(t *testing.T) {
+	Setup(eviction.PolicyLRU, 1000)
+
+	for i, shard := range shards[1:] {
+		if shard.Policy == shards[0].Policy {
+			t.Errorf("shard %d shares its eviction policy with shard 0", i+1)
+		}
+	}
+}
+
+func TestRename_AcrossShards(t *testing.T) {
+	withClock(t, 1000)
+	Setup(eviction.PolicyLRU, 1000)
+	src := "a"
+	dst := keyOnOtherShard(src)
+
+	GetShard(src).SetString(src, "12345")
+	GetShard(src).ExpireAt(src, 5000, ExpireAlways)
+
+	if ok, err := Rename(src, dst, false); !ok || err != nil {
+		t.Fatalf("Rename = %t, %v; want true, nil", ok, err)
+	}
+
+	if got := GetShard(src).CurrentMemory; got != 0 {
+		t.Errorf("source shard CurrentMemory = %d; want 0", got)
+	}
+	if got := GetShard(dst).CurrentMemory; got != 5 {
+		t.Errorf("destination shard CurrentMemory = %d; want 5", got)
+	}
+	if got := GetShard(dst).TTL(dst); got != 4000 {
+		t.Errorf("TTL = %d; want 4000", got)
+	}
+	if _, err := Rename(src, dst, false); err != ErrNoSuchKey {
+		t.Errorf("Rename of a missing key = %v; want %v", err, ErrNoSuchKey)
+	}
+
+	// the source must be gone from its policy, or it would be picked as a victim
+	if victim, ok := GetShard(src).Policy.SelectVictim(); ok {
+		t.Errorf("source policy still tracks %q", victim)
+	}
+}
+
+func TestCopy_IsIndependent(t *testing.T) {
+	Setup(eviction.PolicyLRU, 1000)
+	src := "a"
+	dst := keyOnOtherShard(src)
+
+	GetShard(src).ListPush(src, []string{"x", "y"}, false, false)
+
+	if ok, _ := Copy(src, dst, false); !ok {
+		t.Fatalf("Copy should succeed")
+	}
+	if ok, _ := Copy(src, dst, false); ok {
+		t.Errorf("Copy without replace should not overwrite the destination")
+	}
+
+	GetShard(dst).ListPush(dst, []string{"z"}, false, false)
+
+	if n, _ := GetShard(src).LLen(src); n != 2 {
+		t.Errorf("source LLen = %d; want 2", n)
+	}
+	if got := GetShard(dst).CurrentMemory; got != 3 {
+		t.Errorf("destination shard CurrentMemory = %d; want 3", got)
+	}
+}
+
+func TestCopy_SameKey(t *testing.T) {
+	Setup(eviction.PolicyLRU, 1000)
+	GetShard("a").SetString("a", "1")
+
+	if ok, err := Copy("a", "a", true); ok || err != ErrSameObject {
+		t.Errorf("Copy(a, a) = %v, %v; want false, %v", ok, err, ErrSameObject)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	Setup(eviction.PolicyFIFO, 1000)
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		GetShard(key).SetString(key, "1")
+	}
+	Flush()
+
+	if n := DBSize(); n != 0 {
+		t.Errorf("DBSize = %d; want 0", n)
+	}
+	for i, shard := range shards {
+		if shard.CurrentMemory != 0 {
+			t.Errorf("shard %d CurrentMemory = %d; want 0", i, shard.CurrentMemory)
+		}
+		if victim, ok := shard.Policy.SelectVictim(); ok {
+			t.Errorf("shard %d policy still tracks %q", i, victim)
+		}
+	}
+}
+
+func TestFlush_ReleasesMemory(t *testing.T) {
+	Setup(eviction.PolicyLRU, 1<<20)
+	GetShard("k").SetString("k", "v")
+	obj := weak.Make(GetShard("k").Store["k"])
+
+	Flush()
+	runtime.GC()
+
+	if obj.Value() != nil {
+		t.Error("Flush left the old keys reachable")
+	}
+}
@@ -0,0 +1,309 @@
+package storage
+
+func newListObject() *RedisObject {
+	return &RedisObject{Type: RedisObjectList, List: NewDeque()}
+}
+
+// normalizeRange clamps a Redis style [start, stop] range with negative
+// indexes counting from the end, reporting false when it is empty.
+func normalizeRange(start, stop, length int) (int, int, bool) {
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	start = max(start, 0)
+	stop = min(stop, length-1)
+
+	if start > stop || start >= length {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
+
+// ListPush adds vals to the head (left) or tail of the list at key and
+// returns its new length. With onlyIfExists nothing is created for a
+// missing key.
+func (s *Shard) ListPush(key string, vals []string, left bool, onlyIfExists bool) (int, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	if onlyIfExists {
+		if _, ok, err := s.lookupType(key, RedisObjectList); err != nil || !ok {
+			return 0, err
+		}
+	}
+
+	return s.listPush(key, vals, left)
+}
+
+func (s *Shard) listPush(key string, vals []string, left bool) (int, error) {
+	neededSize := 0
+	for _, val := range vals {
+		neededSize += len(val)
+	}
+
+	obj, err := s.prepareWrite(key, RedisObjectList, neededSize, newListObject)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, val := range vals {
+		if left {
+			obj.List.PushFront(val)
+		} else {
+			obj.List.PushBack(val)
+		}
+	}
+	s.CurrentMemory += neededSize
+
+	return obj.List.Len(), nil
+}
+
+// ListPop removes up to count elements from the head (left) or tail of the
+// list at key, deleting the key once it is empty.
+func (s *Shard) ListPop(key string, count int, left bool) ([]string, bool, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	return s.listPop(key, count, left)
+}
+
+func (s *Shard) listPop(key string, count int, left bool) ([]string, bool, error) {
+	obj, ok, err := s.lookupType(key, RedisObjectList)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	popped := make([]string, 0, min(count, obj.List.Len()))
+	for range count {
+		var val string
+		if left {
+			val, ok = obj.List.PopFront()
+		} else {
+			val, ok = obj.List.PopBack()
+		}
+		if !ok {
+			break
+		}
+		popped = append(popped, val)
+		s.CurrentMemory -= len(val)
+	}
+
+	if obj.List.Len() == 0 {
+		s.remove(key)
+	}
+
+	return popped, true, nil
+}
+
+func (s *Shard) LRange(key string, start, stop int) ([]string, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectList)
+	if err != nil || !ok {
+		return []string{}, err
+	}
+
+	start, stop, ok = normalizeRange(start, stop, obj.List.Len())
+	if !ok {
+		return []string{}, nil
+	}
+
+	return obj.List.Range(start, stop), nil
+}
+
+func (s *Shard) LLen(key string) (int, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectList)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	return obj.List.Len(), nil
+}
+
+func (s *Shard) LIndex(key string, index int) (string, bool, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectList)
+	if err != nil || !ok {
+		return "", false, err
+	}
+
+	if index < 0 {
+		index += obj.List.Len()
+	}
+	if index < 0 || index >= obj.List.Len() {
+		return "", false, nil
+	}
+
+	return obj.List.At(index), true, nil
+}
+
+func (s *Shard) LSet(key string, index int, val string) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	obj, ok, err := s.lookupType(key, RedisObjectList)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNoSuchKey
+	}
+
+	if index < 0 {
+		index += obj.List.Len()
+	}
+	if index < 0 || index >= obj.List.Len() {
+		return ErrIndexOutOfRange
+	}
+
+	delta := len(val) - len(obj.List.At(index))
+	s.evict(max(delta, 0))
+	if _, ok := s.Store[key]; !ok {
+		return ErrNoSuchKey
+	}
+
+	obj.List.Set(index, val)
+	s.CurrentMemory += delta
+
+	return nil
+}
+
+// LRem removes elements equal to val: the first count from the head when
+// count > 0, the last -count from the tail when count < 0, or all of them.
+func (s *Shard) LRem(key string, count int, val string) (int, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	obj, ok, err := s.lookupType(key, RedisObjectList)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	length := obj.List.Len()
+	toRemove := map[int]bool{}
+	if count >= 0 {
+		for i := 0; i < length && (count == 0 || len(toRemove) < count); i++ {
+			if obj.List.At(i) == val {
+				toRemove[i] = true
+			}
+		}
+	} else {
+		for i := length - 1; i >= 0 && len(toRemove) < -count; i-- {
+			if obj.List.At(i) == val {
+				toRemove[i] = true
+			}
+		}
+	}
+
+	if len(toRemove) == 0 {
+		return 0, nil
+	}
+
+	obj.List.Filter(func(i int, _ string) bool { return !toRemove[i] })
+	s.CurrentMemory -= len(toRemove) * len(val)
+
+	if obj.List.Len() == 0 {
+		s.remove(key)
+	}
+
+	return len(toRemove), nil
+}
+
+// LTrim keeps only the elements in the [start, stop] range.
+func (s *Shard) LTrim(key string, start, stop int) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	obj, ok, err := s.lookupType(key, RedisObjectList)
+	if err != nil || !ok {
+		return err
+	}
+
+	start, stop, ok = normalizeRange(start, stop, obj.List.Len())
+	if !ok {
+		s.remove(key)
+		return nil
+	}
+
+	before := obj.List.Bytes()
+	obj.List.Filter(func(i int, _ string) bool { return i >= start && i <= stop })
+	s.CurrentMemory -= before - obj.List.Bytes()
+
+	return nil
+}
+
+// LInsert inserts val before or after the first occurrence of pivot and
+// returns the new length, -1 when pivot is missing or 0 when the key is.
+func (s *Shard) LInsert(key string, before bool, pivot, val string) (int, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	obj, ok, err := s.lookupType(key, RedisObjectList)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	idx := -1
+	for i := range obj.List.Len() {
+		if obj.List.At(i) == pivot {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return -1, nil
+	}
+	if !before {
+		idx++
+	}
+
+	s.evict(len(val))
+	if _, ok := s.Store[key]; !ok {
+		return 0, nil
+	}
+
+	obj.List.Insert(idx, val)
+	s.CurrentMemory += len(val)
+
+	return obj.List.Len(), nil
+}
+
+// LMove atomically pops an element from one end of src and pushes it to one
+// end of dst, even when both keys live on different shards.
+func LMove(src, dst string, fromLeft, toLeft bool) (string, bool, error) {
+	unlock := lockShards(src, dst)
+	defer unlock()
+
+	srcShard, dstShard := GetShard(src), GetShard(dst)
+	srcShard.expireIfNeeded(src)
+	dstShard.expireIfNeeded(dst)
+
+	if _, _, err := dstShard.lookupType(dst, RedisObjectList); err != nil {
+		return "", false, err
+	}
+
+	popped, ok, err := srcShard.listPop(src, 1, fromLeft)
+	if err != nil || !ok || len(popped) == 0 {
+		return "", false, err
+	}
+
+	if _, err := dstShard.listPush(dst, popped, toLeft); err != nil {
+		return "", false, err
+	}
+
+	return popped[0], true, nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/devkarim/goredis/eviction"
+)
+
+func TestDeque_WrapAround(t *testing.T) {
+	d := NewDeque()
+	for i := range 20 {
+		d.PushBack(string(rune('a' + i)))
+		d.PopFront()
+		d.PushFront("x")
+	}
+
+	if d.Len() != 20 {
+		t.Errorf("Len() = %d; want 20", d.Len())
+	}
+	if d.Bytes() != 20 {
+		t.Errorf("Bytes() = %d; want 20", d.Bytes())
+	}
+}
+
+func TestDeque_InsertAndFilter(t *testing.T) {
+	d := NewDeque()
+	d.PushBack("a")
+	d.PushBack("c")
+	d.Insert(1, "b")
+
+	got := d.Range(0, d.Len()-1)
+	if !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("Range() = %v; want [a b c]", got)
+	}
+
+	d.Filter(func(_ int, v string) bool { return v != "b" })
+
+	got = d.Range(0, d.Len()-1)
+	if !slices.Equal(got, []string{"a", "c"}) || d.Bytes() != 2 {
+		t.Errorf("Range() = %v, Bytes() = %d; want [a c] and 2", got, d.Bytes())
+	}
+}
+
+func TestList_MemoryAccounting(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 100)
+
+	shard.ListPush("l", []string{"aa", "bbb", "aa"}, false, false)
+	if shard.CurrentMemory != 7 {
+		t.Errorf("CurrentMemory = %d; want 7", shard.CurrentMemory)
+	}
+
+	shard.LRem("l", 0, "aa")
+	if shard.CurrentMemory != 3 {
+		t.Errorf("CurrentMemory = %d; want 3", shard.CurrentMemory)
+	}
+
+	shard.ListPop("l", 1, true)
+	if shard.CurrentMemory != 0 {
+		t.Errorf("CurrentMemory = %d; want 0", shard.CurrentMemory)
+	}
+	if _, ok := shard.Store["l"]; ok {
+		t.Errorf("empty list should have been deleted")
+	}
+}
+
+func TestList_Eviction(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 10)
+
+	shard.SetString("a", "12345")
+	shard.ListPush("l", []string{"123", "45"}, false, false)
+	shard.ListPush("l", []string{"678"}, false, false)
+
+	if _, ok := shard.Store["a"]; ok {
+		t.Errorf("'a' should have been evicted")
+	}
+	if n, _ := shard.LLen("l"); n != 3 {
+		t.Errorf("LLen = %d; want 3", n)
+	}
+	if shard.CurrentMemory != 8 {
+		t.Errorf("CurrentMemory = %d; want 8", shard.CurrentMemory)
+	}
+}
+
+func TestList_Range(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 100)
+	shard.ListPush("l", []string{"a", "b", "c", "d"}, false, false)
+
+	cases := []struct {
+		start, stop int
+		want        []string
+	}{
+		{0, -1, []string{"a", "b", "c", "d"}},
+		{-2, 10, []string{"c", "d"}},
+		{2, 1, []string{}},
+		{5, 10, []string{}},
+	}
+
+	for _, c := range cases {
+		got, _ := shard.LRange("l", c.start, c.stop)
+		if !slices.Equal(got, c.want) {
+			t.Errorf("LRange(%d, %d) = %v; want %v", c.start, c.stop, got, c.want)
+		}
+	}
+}
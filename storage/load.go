@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// LoadProgress counts the bytes read by Aof.Read or Rdb.Read, so that the
+// progress of a load can be reported while it runs.
+type LoadProgress struct {
+	total  atomic.Int64
+	loaded atomic.Int64
+}
+
+// Total returns the size of the files being loaded.
+func (p *LoadProgress) Total() int64 {
+	return p.total.Load()
+}
+
+// Loaded returns how many of the Total bytes were read so far.
+func (p *LoadProgress) Loaded() int64 {
+	return p.loaded.Load()
+}
+
+// start begins a load of total bytes, p may be nil.
+func (p *LoadProgress) start(total int64) {
+	if p != nil {
+		p.total.Store(total)
+		p.loaded.Store(0)
+	}
+}
+
+// reader counts the bytes read from r as loaded, p may be nil.
+func (p *LoadProgress) reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &progressReader{r: r, p: p}
+}
+
+type progressReader struct {
+	r io.Reader
+	p *LoadProgress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.p.loaded.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrBadManifest = errors.New("bad AOF manifest")
+
+type aofFileType byte
+
+const (
+	aofBase aofFileType = 'b'
+	aofIncr aofFileType = 'i'
+)
+
+// aofFile is an entry of the manifest.
+type aofFile struct {
+	name string
+	seq  int
+	typ  aofFileType
+}
+
+// aofManifest lists the files of the AOF: a base file holding the keyspace
+// as of the last rewrite, a snapshot or commands, followed by the
+// incremental files holding the writes made since, oldest first. Files are
+// named after the manifest, see baseFileName and incrFileName.
+//
+//	file database.aof.2.base.rdb seq 2 type b
+//	file database.aof.5.incr.aof seq 5 type i
+type aofManifest struct {
+	base  *aofFile // nil before the first rewrite
+	incrs []aofFile
+}
+
+func manifestName(name string) string {
+	return name + ".manifest"
+}
+
+func baseFileName(name string, seq int, rdb bool) string {
+	if rdb {
+		return fmt.Sprintf("%s.%d.base.rdb", name, seq)
+	}
+	return fmt.Sprintf("%s.%d.base.aof", name, seq)
+}
+
+func incrFileName(name string, seq int) string {
+	return fmt.Sprintf("%s.%d.incr.aof", name, seq)
+}
+
+// files returns the files in the order they are loaded.
+func (m *aofManifest) files() []aofFile {
+	files := make([]aofFile, 0, len(m.incrs)+1)
+	if m.base != nil {
+		files = append(files, *m.base)
+	}
+	return append(files, m.incrs...)
+}
+
+func (m *aofManifest) lastIncr() aofFile {
+	return m.incrs[len(m.incrs)-1]
+}
+
+func (m *aofManifest) nextBaseSeq() int {
+	if m.base == nil {
+		return 1
+	}
+	return m.base.seq + 1
+}
+
+func (m *aofManifest) nextIncrSeq() int {
+	if len(m.incrs) == 0 {
+		return 1
+	}
+	return m.lastIncr().seq + 1
+}
+
+func (m *aofManifest) marshal() []byte {
+	var b bytes.Buffer
+	for _, f := range m.files() {
+		fmt.Fprintf(&b, "file %s seq %d type %c\n", f.name, f.seq, f.typ)
+	}
+	return b.Bytes()
+}
+
+func parseManifest(data []byte) (*aofManifest, error) {
+	m := &aofManifest{}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields)%2 != 0 {
+			return nil, fmt.Errorf("%w: line %d", ErrBadManifest, i+1)
+		}
+		var f aofFile
+		for j := 0; j < len(fields); j += 2 {
+			switch value := fields[j+1]; fields[j] {
+			case "file":
+				f.name = value
+			case "seq":
+				seq, err := strconv.Atoi(value)
+				if err != nil || seq <= 0 {
+					return nil, fmt.Errorf("%w: line %d: invalid seq %q", ErrBadManifest, i+1, value)
+				}
+				f.seq = seq
+			case "type":
+				if len(value) != 1 {
+					return nil, fmt.Errorf("%w: line %d: invalid type %q", ErrBadManifest, i+1, value)
+				}
+				f.typ = aofFileType(value[0])
+			}
+		}
+		if f.name == "" || f.seq == 0 || filepath.Base(f.name) != f.name {
+			return nil, fmt.Errorf("%w: line %d", ErrBadManifest, i+1)
+		}
+
+		switch f.typ {
+		case aofBase:
+			if m.base != nil {
+				return nil, fmt.Errorf("%w: more than one base file", ErrBadManifest)
+			}
+			m.base = &f
+		case aofIncr:
+			if len(m.incrs) > 0 && f.seq <= m.lastIncr().seq {
+				return nil, fmt.Errorf("%w: incremental files out of order", ErrBadManifest)
+			}
+			m.incrs = append(m.incrs, f)
+		default:
+			// history files are left over by a rewrite and not loaded
+		}
+	}
+
+	return m, nil
+}
+
+// readManifest returns the manifest of the AOF called name in dir, an
+// error wrapping os.ErrNotExist when there is none yet.
+func readManifest(dir, name string) (*aofManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName(name)))
+	if err != nil {
+		return nil, err
+	}
+	return parseManifest(data)
+}
+
+// writeManifest atomically replaces the manifest of the AOF called name.
+func writeManifest(dir, name string, m *aofManifest) error {
+	path := filepath.Join(dir, manifestName(name))
+	tmpPath := filepath.Join(dir, "temp-"+manifestName(name))
+
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(m.marshal())
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	syncDir(dir)
+	return nil
+}
+
+// AofFiles returns the paths of the files of the AOF described by the
+// manifest at path, in the order they are loaded.
+func AofFiles(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := parseManifest(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, f := range m.files() {
+		paths = append(paths, filepath.Join(filepath.Dir(path), f.name))
+	}
+	return paths, nil
+}
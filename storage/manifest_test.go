@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/devkarim/goredis/eviction"
+	"github.com/devkarim/goredis/resp"
+)
+
+func TestAof_RewriteReplacesBaseAndIncrementalFiles(t *testing.T) {
+	withClock(t, 1000)
+	Setup(eviction.PolicyLRU, 1<<20)
+	cfg := AofConfig{Dir: t.TempDir(), Name: "test.aof", Fsync: FsyncEverySec, RdbBase: true}
+
+	aof, err := NewAof(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	GetShard("a").SetString("a", "1")
+	aof.Write(command("SET", "a", "1"))
+	if err := aof.Rewrite(); err != nil {
+		t.Fatalf("Rewrite: %v", err)
+	}
+	aof.Write(command("SET", "b", "2"))
+	if err := aof.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{"test.aof.1.base.rdb", "test.aof.2.incr.aof", "test.aof.manifest"}
+	if !slices.Equal(names, want) {
+		t.Errorf("files after rewrite = %q; want %q", names, want)
+	}
+
+	Setup(eviction.PolicyLRU, 1<<20)
+	aof, err = NewAof(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aof.Close()
+
+	var commands []string
+	err = aof.Read(nil, func(v resp.Value) {
+		commands = append(commands, v.Array[0].Str+" "+v.Array[1].Str)
+	})
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if v, _, _ := GetShard("a").GetString("a"); v != "1" {
+		t.Errorf("a = %q after loading the base file; want 1", v)
+	}
+	if !slices.Equal(commands, []string{"SET b"}) {
+		t.Errorf("commands of the incremental file = %q; want [SET b]", commands)
+	}
+}
+
+func TestNewAof_MovesLegacyFile(t *testing.T) {
+	parent := t.TempDir()
+	path := filepath.Join(parent, "database.aof")
+	set := command("SET", "k", "v")
+	legacy := set.Marshal(resp.RESP2)
+	if err := os.WriteFile(path, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(parent, "appendonlydir")
+	aof, err := NewAof(AofConfig{Dir: dir, Name: "database.aof", Legacy: path, Fsync: FsyncEverySec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aof.Close()
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("legacy file still exists, Stat error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "database.aof.1.base.aof"))
+	if err != nil || string(data) != string(legacy) {
+		t.Errorf("base file = %q, %v; want the legacy file", data, err)
+	}
+	if aof.Size() != int64(len(legacy)) {
+		t.Errorf("Size() = %d; want %d", aof.Size(), len(legacy))
+	}
+}
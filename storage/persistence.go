@@ -1,82 +1,729 @@
 package storage
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/devkarim/goredis/resp"
 )
 
+var (
+	ErrRewriteInProgress  = errors.New("ERR Background append only file rewriting already in progress")
+	ErrInvalidFsyncPolicy = errors.New("invalid appendfsync, must be one of: always, everysec, no")
+
+	errTruncatedNotLast = errors.New("unexpected end of file, only the last file may be truncated")
+)
+
+// FsyncPolicy decides when the AOF is flushed to disk.
+type FsyncPolicy string
+
+const (
+	FsyncAlways   FsyncPolicy = "always"   // before replying to every write
+	FsyncEverySec FsyncPolicy = "everysec" // once per second in the background
+	FsyncNo       FsyncPolicy = "no"       // whenever the OS decides to
+)
+
+func (p FsyncPolicy) String() string {
+	return string(p)
+}
+
+func (p *FsyncPolicy) Set(value string) error {
+	switch value {
+	case string(FsyncAlways), string(FsyncEverySec), string(FsyncNo):
+		*p = FsyncPolicy(value)
+		return nil
+	default:
+		return ErrInvalidFsyncPolicy
+	}
+}
+
+// AofConfig describes where the AOF is kept and how it is written.
+type AofConfig struct {
+	Dir     string // holds the manifest and the files listed in it
+	Name    string // prefix of the file names
+	Legacy  string // path of the single file AOF of older versions
+	Fsync   FsyncPolicy
+	RdbBase bool // rewrites write the base file as a snapshot instead of commands
+
+	// Timestamps annotates the writes with the second they were made at,
+	// so the AOF can be truncated to a point in time.
+	Timestamps bool
+
+	Cipher *Cipher // encrypts the files written from now on, nil for none
+}
+
+// Aof is an append only file split in parts listed by a manifest, see
+// aofManifest. Writes are appended to the last incremental file, a rewrite
+// starts a new one and replaces the base file and the older ones.
 type Aof struct {
-	mu   sync.Mutex
-	file *os.File
+	mu       sync.Mutex
+	cfg      AofConfig
+	manifest *aofManifest
+	file     *os.File // the last incremental file
+	fileSize int64
+
+	timestamp int64   // of the last annotation written to file
+	sealer    *sealer // of the records of file, nil until its header is written
+
+	// syncMu serializes fsyncs. A writer waiting for it usually finds its
+	// data already flushed by the fsync of another one, which commits
+	// concurrent writes as a group.
+	syncMu sync.Mutex
+	synced int64 // bytes of file known to be on disk
+
+	pending        []byte // bytes a failed write left out of the file
+	err            error  // of the last failed write or fsync, until one succeeds
+	lastRewriteErr error
+
+	size     int64 // bytes in all the files
+	baseSize int64 // size after the last rewrite, auto rewrites compare to it
+
+	rewriting bool
 }
 
-func NewAof(path string) (*Aof, error) {
-	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+// NewAof opens the AOF described by cfg, creating its directory and
+// manifest when they do not exist yet. A single file AOF left by an older
+// version at cfg.Legacy becomes the base file of the new one.
+func NewAof(cfg AofConfig) (*Aof, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	m, err := readManifest(cfg.Dir, cfg.Name)
+	if errors.Is(err, os.ErrNotExist) {
+		m = &aofManifest{}
+		if _, err := os.Stat(cfg.Legacy); cfg.Legacy != "" && err == nil {
+			m.base = &aofFile{name: baseFileName(cfg.Name, 1, false), seq: 1, typ: aofBase}
+		}
+		err = writeManifest(cfg.Dir, cfg.Name, m)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := moveLegacyFile(cfg, m); err != nil {
+		return nil, err
+	}
+	if len(m.incrs) == 0 {
+		m.incrs = []aofFile{{name: incrFileName(cfg.Name, 1), seq: 1, typ: aofIncr}}
+		if err := writeManifest(cfg.Dir, cfg.Name, m); err != nil {
+			return nil, err
+		}
+	}
+
+	size := int64(0)
+	files := m.files()
+	for _, f := range files[:len(files)-1] {
+		info, err := os.Stat(filepath.Join(cfg.Dir, f.name))
+		if err != nil {
+			return nil, fmt.Errorf("AOF file listed in the manifest: %w", err)
+		}
+		size += info.Size()
+	}
 
+	file, err := os.OpenFile(filepath.Join(cfg.Dir, m.lastIncr().name), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return nil, err
 	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	size += info.Size()
+
+	aof := &Aof{
+		cfg:      cfg,
+		manifest: m,
+		file:     file,
+		fileSize: info.Size(),
+		synced:   info.Size(),
+		size:     size,
+		baseSize: size,
+	}
+	if err := aof.openSealer(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return aof, nil
+}
+
+// openSealer sets the sealer of the records appended to the last file of an
+// encrypted AOF, following the ones it holds.
+func (aof *Aof) openSealer() error {
+	aof.sealer = nil
+	if aof.cfg.Cipher == nil || aof.fileSize == 0 {
+		return nil
+	}
 
-	return &Aof{file: file}, nil
+	encrypted, err := isEncrypted(aof.file.Name())
+	if err != nil || !encrypted {
+		return err
+	}
+	aof.sealer, err = aof.cfg.Cipher.appendTo(aof.file.Name())
+	return err
 }
 
-func (aof *Aof) Write(v resp.Value) error {
+// Loaded is called once the AOF was loaded, before the first write. When
+// encryption was turned on or off since the last file was written, it starts
+// a new one so that appends are encrypted like the rest of their file. This
+// is left until the load succeeded so that a failed start does not change
+// the manifest.
+func (aof *Aof) Loaded() error {
+	aof.mu.Lock()
+	size, name := aof.fileSize, aof.file.Name()
+	aof.mu.Unlock()
+
+	encrypted, err := isEncrypted(name)
+	if err != nil {
+		return err
+	}
+	if size == 0 || encrypted == (aof.cfg.Cipher != nil) {
+		return nil
+	}
+
+	slog.Info("Starting a new AOF file since encryption was turned on or off, rewrite the AOF to apply it to the older ones")
+	_, err = aof.rotate()
+	return err
+}
+
+// moveLegacyFile moves the single file AOF of older versions into the
+// directory, as the base file the manifest was created with. The manifest
+// is written first so that a crash in between is finished at the next start.
+func moveLegacyFile(cfg AofConfig, m *aofManifest) error {
+	if m.base == nil || m.base.name != baseFileName(cfg.Name, 1, false) {
+		return nil
+	}
+	path := filepath.Join(cfg.Dir, m.base.name)
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if _, err := os.Stat(cfg.Legacy); cfg.Legacy == "" || err != nil {
+		return nil
+	}
+
+	slog.Info("Moving the AOF into its directory", "from", cfg.Legacy, "to", path)
+	if err := os.Rename(cfg.Legacy, path); err != nil {
+		return err
+	}
+	syncDir(cfg.Dir)
+
+	return nil
+}
+
+// Write appends values with a single write, so a block such as a
+// MULTI ... EXEC transaction is never interleaved with other commands. What
+// could not be written is kept and retried first by the following writes and
+// syncs, the AOF reports an error until it went through. An encrypted AOF
+// seals each write in a record of its own.
+func (aof *Aof) Write(values ...resp.Value) error {
 	aof.mu.Lock()
 	defer aof.mu.Unlock()
 
-	_, err := aof.file.Write(v.Marshal())
+	if len(values) == 0 {
+		return nil
+	}
+
+	var header []byte
+	if c := aof.cfg.Cipher; c != nil && aof.sealer == nil {
+		var err error
+		if header, aof.sealer, err = c.newFile(); err != nil {
+			aof.fail(err)
+			return err
+		}
+	}
+
+	var bytes []byte
+	if ts := now() / 1000; aof.cfg.Timestamps && ts != aof.timestamp {
+		bytes = appendTimestamp(bytes, ts)
+		aof.timestamp = ts
+	}
+	for _, v := range values {
+		bytes = v.Append(bytes, resp.RESP2)
+	}
+	if aof.sealer != nil {
+		bytes = aof.sealer.seal(header, bytes)
+	}
+
+	if len(aof.pending) > 0 {
+		aof.pending = append(aof.pending, bytes...)
+		return aof.flushPending()
+	}
+
+	n, err := aof.file.Write(bytes)
+	aof.grow(n)
 	if err != nil {
+		aof.pending = append(aof.pending, bytes[n:]...)
+		aof.fail(err)
 		return err
 	}
 
 	return nil
 }
 
-func (aof *Aof) Read(callback func(val resp.Value)) error {
+// flushPending retries writing what previous writes could not.
+func (aof *Aof) flushPending() error {
+	if len(aof.pending) == 0 {
+		return nil
+	}
+
+	n, err := aof.file.Write(aof.pending)
+	aof.grow(n)
+	aof.pending = aof.pending[n:]
+	if err != nil {
+		aof.fail(err)
+		return err
+	}
+	aof.pending = nil
+
+	return nil
+}
+
+func (aof *Aof) grow(n int) {
+	aof.fileSize += int64(n)
+	aof.size += int64(n)
+}
+
+func (aof *Aof) fail(err error) {
+	if aof.err == nil {
+		slog.Error("Couldn't write the AOF, refusing writes until it succeeds", "error", err)
+	}
+	aof.err = err
+}
+
+// Commit makes the writes done so far durable when the fsync policy is
+// always, and is a no-op otherwise. It must be called before replying to a
+// write, outside of the shard gates so that other writers can join the
+// same fsync.
+func (aof *Aof) Commit() error {
+	if aof.cfg.Fsync != FsyncAlways {
+		return nil
+	}
+
+	aof.mu.Lock()
+	size := aof.fileSize
+	aof.mu.Unlock()
+
+	return aof.syncTo(size)
+}
+
+// Sync retries the pending writes and flushes the file to disk.
+func (aof *Aof) Sync() error {
+	aof.mu.Lock()
+	size := aof.fileSize
+	aof.mu.Unlock()
+
+	return aof.syncTo(size)
+}
+
+// syncTo makes sure the first size bytes of the file are on disk.
+func (aof *Aof) syncTo(size int64) error {
+	aof.syncMu.Lock()
+	defer aof.syncMu.Unlock()
+
+	aof.mu.Lock()
+	if aof.err == nil && aof.synced >= size {
+		aof.mu.Unlock()
+		return nil
+	}
+	if err := aof.flushPending(); err != nil {
+		aof.mu.Unlock()
+		return err
+	}
+	file, target := aof.file, aof.fileSize
+	aof.mu.Unlock()
+
+	// fsync without holding mu, writes made meanwhile are committed by
+	// the next one
+	err := file.Sync()
+
 	aof.mu.Lock()
 	defer aof.mu.Unlock()
 
-	// start at the beginning of the file
-	_, err := aof.file.Seek(0, 0)
 	if err != nil {
+		aof.fail(err)
 		return err
 	}
+	aof.synced = max(aof.synced, target)
+	if aof.err != nil && len(aof.pending) == 0 {
+		slog.Info("AOF is written again, accepting writes")
+		aof.err = nil
+	}
 
-	rd := resp.NewReader(aof.file)
+	return nil
+}
 
-	for {
-		val, err := rd.Read()
-		if err != nil {
-			if err == io.EOF {
-				break
+// Err returns the error of the last failed write or fsync, or nil once the
+// AOF is written and synced again.
+func (aof *Aof) Err() error {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+
+	return aof.err
+}
+
+// Read loads the files in the order of the manifest. The keys of a snapshot
+// base file are added to the keyspace, callback is called with every
+// command of the others, see ReadAof. Only the last file may end with an
+// incomplete command. The bytes read are counted in progress, which may be
+// nil. The AOF is not locked while reading, so that its state can be
+// reported in the meantime, it must not be written to until Read returns.
+func (aof *Aof) Read(progress *LoadProgress, callback func(val resp.Value)) error {
+	return aof.ReadKeys(progress, func(key string, obj *RedisObject, expireAt int64) {
+		LoadKey(key, obj, expireAt)
+	}, callback)
+}
+
+// ReadKeys is Read calling onKey with the keys of a snapshot base file,
+// for callers adding them to the keyspace with LoadKey themselves.
+func (aof *Aof) ReadKeys(progress *LoadProgress, onKey func(key string, obj *RedisObject, expireAt int64), callback func(val resp.Value)) error {
+	aof.mu.Lock()
+	progress.start(aof.size)
+	files := aof.manifest.files()
+	aof.mu.Unlock()
+
+	for i, f := range files {
+		err := aof.readFile(f, progress, onKey, callback)
+
+		var aofErr *AofError
+		if errors.As(err, &aofErr) {
+			aofErr.File = f.name
+			if aofErr.Err == ErrAofTruncated && i < len(files)-1 {
+				aofErr.Err = errTruncatedNotLast
 			}
+			return aofErr
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+
+	return nil
+}
+
+func (aof *Aof) readFile(f aofFile, progress *LoadProgress, onKey func(key string, obj *RedisObject, expireAt int64), callback func(val resp.Value)) error {
+	file, err := os.Open(filepath.Join(aof.cfg.Dir, f.name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if f.typ == aofBase && filepath.Ext(f.name) == ".rdb" {
+		info, err := file.Stat()
+		if err != nil {
 			return err
 		}
+		return ReadRdbFile(progress.reader(file), info.Size(), aof.cfg.Cipher, onKey)
+	}
+
+	_, err = ReadAofFile(progress.reader(file), aof.cfg.Cipher, AofLimit{}, callback)
+	return err
+}
+
+// Truncate drops everything after the first size bytes of the last file,
+// such as the incomplete command reported by an *AofError.
+func (aof *Aof) Truncate(size int64) error {
+	aof.syncMu.Lock()
+	defer aof.syncMu.Unlock()
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
 
-		callback(val)
+	if err := aof.file.Truncate(size); err != nil {
+		return err
+	}
+	if err := aof.file.Sync(); err != nil {
+		return err
 	}
 
-	return nil
+	aof.size -= aof.fileSize - size
+	aof.baseSize = aof.size
+	aof.fileSize = size
+	aof.synced = size
+
+	return aof.openSealer()
 }
 
+// Close flushes the file to disk and closes it.
 func (aof *Aof) Close() error {
+	aof.syncMu.Lock()
+	defer aof.syncMu.Unlock()
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+
+	err := aof.flushPending()
+	if err == nil {
+		err = aof.file.Sync()
+	}
+	if closeErr := aof.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Rewriting reports whether a rewrite is in progress.
+func (aof *Aof) Rewriting() bool {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+
+	return aof.rewriting
+}
+
+// ShouldRewrite reports whether the AOF grew by percentage percent since the
+// last rewrite and is at least minSize bytes, a zero percentage never does.
+func (aof *Aof) ShouldRewrite(percentage int, minSize int64) bool {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+
+	if aof.rewriting || percentage <= 0 || aof.size < minSize {
+		return false
+	}
+
+	base := max(aof.baseSize, 1)
+	return (aof.size-base)*100/base >= int64(percentage)
+}
+
+// RewriteInBackground starts a rewrite of the AOF on its own goroutine, see
+// Rewrite.
+func (aof *Aof) RewriteInBackground() error {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+
+	if aof.rewriting {
+		return ErrRewriteInProgress
+	}
+	aof.rewriting = true
+
+	go func() {
+		start := time.Now()
+		if err := aof.rewrite(); err != nil {
+			slog.Error("Background AOF rewrite failed", "error", err)
+			return
+		}
+		slog.Info("Background AOF rewrite finished", "duration", time.Since(start), "size", aof.Size())
+	}()
+
+	return nil
+}
+
+// Rewrite replaces the base file with the current keyspace. Writes go to a
+// new incremental file from the moment the keyspace is frozen, and once the
+// base file is written the manifest atomically swaps the old base and
+// incremental files for the new ones.
+func (aof *Aof) Rewrite() error {
+	aof.mu.Lock()
+	if aof.rewriting {
+		aof.mu.Unlock()
+		return ErrRewriteInProgress
+	}
+	aof.rewriting = true
+	aof.mu.Unlock()
+
+	return aof.rewrite()
+}
+
+// AofInfo is the state of the AOF reported by INFO.
+type AofInfo struct {
+	Size           int64
+	BaseSize       int64
+	Rewriting      bool
+	LastErr        error // of the last write or fsync, nil once one succeeds
+	LastRewriteErr error
+}
+
+func (aof *Aof) Info() AofInfo {
 	aof.mu.Lock()
 	defer aof.mu.Unlock()
 
-	err := aof.file.Close()
+	return AofInfo{
+		Size:           aof.size,
+		BaseSize:       aof.baseSize,
+		Rewriting:      aof.rewriting,
+		LastErr:        aof.err,
+		LastRewriteErr: aof.lastRewriteErr,
+	}
+}
+
+// Size returns the number of bytes in all the files.
+func (aof *Aof) Size() int64 {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
 
+	return aof.size
+}
+
+func (aof *Aof) rewrite() (err error) {
+	tmpPath := filepath.Join(aof.cfg.Dir, "temp-rewrite-"+aof.cfg.Name)
+	defer func() {
+		aof.mu.Lock()
+		aof.rewriting = false
+		aof.lastRewriteErr = err
+		aof.mu.Unlock()
+
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	tmp, err := os.Create(tmpPath)
 	if err != nil {
 		return err
 	}
+	defer tmp.Close()
 
-	return nil
+	var firstIncr int
+	snap := Freeze(func() {
+		firstIncr, err = aof.rotate()
+	})
+	if err != nil {
+		return err
+	}
+
+	w, err := aof.cfg.Cipher.writer(tmp)
+	if err != nil {
+		return err
+	}
+	if aof.cfg.RdbBase {
+		err = WriteRdb(w, snap)
+	} else {
+		err = writeSnapshot(w, snap)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		return err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return err
+	}
+
+	return aof.installBase(tmpPath, info.Size(), firstIncr)
 }
 
-func (aof *Aof) Sync() {
+// rotate makes the following writes go to a new incremental file and
+// returns its sequence number. It is called while the keyspace is frozen, so
+// the files before it hold exactly the writes of the snapshot.
+func (aof *Aof) rotate() (int, error) {
+	aof.syncMu.Lock()
+	defer aof.syncMu.Unlock()
 	aof.mu.Lock()
-	aof.file.Sync()
 	defer aof.mu.Unlock()
+
+	// pending writes belong to the old file, they cannot follow the
+	// snapshot in the new one
+	if len(aof.pending) > 0 {
+		return 0, aof.err
+	}
+	if err := aof.file.Sync(); err != nil {
+		aof.fail(err)
+		return 0, err
+	}
+
+	seq := aof.manifest.nextIncrSeq()
+	incr := aofFile{name: incrFileName(aof.cfg.Name, seq), seq: seq, typ: aofIncr}
+	path := filepath.Join(aof.cfg.Dir, incr.name)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	m := &aofManifest{base: aof.manifest.base, incrs: append(slices.Clone(aof.manifest.incrs), incr)}
+	if err := writeManifest(aof.cfg.Dir, aof.cfg.Name, m); err != nil {
+		file.Close()
+		os.Remove(path)
+		return 0, err
+	}
+
+	aof.file.Close()
+	aof.file = file
+	aof.fileSize = 0
+	aof.synced = 0
+	aof.timestamp = 0
+	aof.sealer = nil
+	aof.manifest = m
+
+	return seq, nil
+}
+
+// installBase makes the file at tmpPath the base file, dropping the files
+// made obsolete by it: the old base file and the incremental files before
+// firstIncr.
+func (aof *Aof) installBase(tmpPath string, size int64, firstIncr int) error {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+
+	seq := aof.manifest.nextBaseSeq()
+	base := aofFile{name: baseFileName(aof.cfg.Name, seq, aof.cfg.RdbBase), seq: seq, typ: aofBase}
+	basePath := filepath.Join(aof.cfg.Dir, base.name)
+	if err := os.Rename(tmpPath, basePath); err != nil {
+		return err
+	}
+
+	m := &aofManifest{base: &base}
+	var obsolete []aofFile
+	if aof.manifest.base != nil {
+		obsolete = append(obsolete, *aof.manifest.base)
+	}
+	for _, f := range aof.manifest.incrs {
+		if f.seq >= firstIncr {
+			m.incrs = append(m.incrs, f)
+		} else {
+			obsolete = append(obsolete, f)
+		}
+	}
+	if err := writeManifest(aof.cfg.Dir, aof.cfg.Name, m); err != nil {
+		os.Remove(basePath)
+		return err
+	}
+	aof.manifest = m
+
+	for _, f := range obsolete {
+		os.Remove(filepath.Join(aof.cfg.Dir, f.name))
+	}
+
+	aof.size = size + aof.fileSize
+	aof.baseSize = aof.size
+
+	return nil
+}
+
+// writeSnapshot writes the commands recreating snap to wr.
+func writeSnapshot(wr io.Writer, snap *Snapshot) error {
+	w := bufio.NewWriterSize(wr, 64*1024)
+	var buf []byte
+
+	err := snap.Each(func(key string, obj *RedisObject, expireAt int64) error {
+		buf = buf[:0]
+		rewriteCommands(key, obj, expireAt, func(v resp.Value) {
+			buf = v.Append(buf, resp.RESP2)
+		})
+		_, err := w.Write(buf)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
 }
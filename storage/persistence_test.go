@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/devkarim/goredis/resp"
+)
+
+func TestAof_FailedWriteIsRetried(t *testing.T) {
+	dir := t.TempDir()
+	aof, err := NewAof(AofConfig{Dir: dir, Name: "test.aof", Fsync: FsyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aof.Close()
+
+	// a file opened read only makes every write fail
+	writable := aof.file
+	readOnly, err := os.Open(filepath.Join(dir, aof.manifest.lastIncr().name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readOnly.Close()
+	aof.file = readOnly
+
+	if err := aof.Write(command("SET", "k", "v")); err == nil {
+		t.Fatal("Write to a read only file succeeded")
+	}
+	if aof.Err() == nil {
+		t.Error("Err() = nil after a failed write")
+	}
+	if err := aof.Commit(); err == nil {
+		t.Error("Commit succeeded while the write is still pending")
+	}
+	if got := aof.Info().LastErr; got == nil {
+		t.Error("Info().LastErr = nil after a failed write")
+	}
+
+	aof.mu.Lock()
+	aof.file = writable
+	aof.mu.Unlock()
+
+	if err := aof.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if err := aof.Err(); err != nil {
+		t.Errorf("Err() = %v after a successful sync; want nil", err)
+	}
+
+	var got []resp.Value
+	aof.Read(nil, func(v resp.Value) { got = append(got, v) })
+	if len(got) != 1 || got[0].Array[2].Str != "v" {
+		t.Errorf("AOF holds %v; want the retried SET", got)
+	}
+}
@@ -0,0 +1,544 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// A snapshot file starts with rdbMagic and the format version in four
+// digits, followed by a record per key and rdbOpEOF. The file ends with the
+// CRC-64 of everything before it, in little endian.
+//
+//	record = [rdbOpExpire deadline] type key value
+//	string = length bytes
+//
+// Lengths and counts are uvarints, deadlines are unix milliseconds and
+// scores are float64 bits, both as 8 bytes in little endian.
+const (
+	rdbMagic   = "GOREDIS"
+	RdbVersion = 1
+)
+
+const (
+	rdbTypeString byte = iota
+	rdbTypeList
+	rdbTypeSet
+	rdbTypeZSet
+	rdbTypeHash
+
+	rdbOpExpire byte = 0xfc
+	rdbOpEOF    byte = 0xff
+)
+
+// rdbSaveRetryDelay is how long automatic saves wait after a failed one.
+const rdbSaveRetryDelay = 5 * time.Second
+
+var rdbTable = crc64.MakeTable(crc64.ECMA)
+
+var (
+	ErrSaveInProgress = errors.New("ERR Background save already in progress")
+	ErrBadSnapshot    = errors.New("bad snapshot file")
+)
+
+// Rdb saves the keyspace to a snapshot file and tracks the changes made
+// since the last save, which the save rules are compared to.
+type Rdb struct {
+	mu     sync.Mutex
+	path   string
+	cipher *Cipher
+
+	dirty       int64 // changes since the last successful save
+	dirtyAtSave int64 // changes already covered by the running save
+
+	saving   bool
+	lastSave time.Time // of the last successful save
+	lastTry  time.Time // of the last save, successful or not
+	lastErr  error
+}
+
+// NewRdb returns the snapshots kept at path, encrypted with c unless it is
+// nil.
+func NewRdb(path string, c *Cipher) *Rdb {
+	started := time.Now()
+	return &Rdb{path: path, cipher: c, lastSave: started, lastTry: started}
+}
+
+// Changed records n changes to the keyspace. It must be called while
+// holding the shards they were made to, so that a save counts exactly the
+// changes its snapshot holds.
+func (rdb *Rdb) Changed(n int) {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	rdb.dirty += int64(n)
+}
+
+// ShouldSave reports whether at least changes changes were made in the
+// seconds since the last save. After a failed save it waits
+// rdbSaveRetryDelay before trying again.
+func (rdb *Rdb) ShouldSave(seconds int, changes int64) bool {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	if rdb.saving || rdb.dirty < changes {
+		return false
+	}
+	if rdb.lastErr != nil && time.Since(rdb.lastTry) < rdbSaveRetryDelay {
+		return false
+	}
+	return time.Since(rdb.lastSave) >= time.Duration(seconds)*time.Second
+}
+
+// SaveInBackground starts a save on its own goroutine, see Save.
+func (rdb *Rdb) SaveInBackground() error {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	if rdb.saving {
+		return ErrSaveInProgress
+	}
+	rdb.saving = true
+
+	go func() {
+		start := time.Now()
+		if err := rdb.save(); err != nil {
+			slog.Error("Background save failed", "error", err)
+			return
+		}
+		slog.Info("Background save finished", "duration", time.Since(start))
+	}()
+
+	return nil
+}
+
+// Save writes a snapshot of the keyspace, see Freeze, and atomically
+// replaces the file with it.
+func (rdb *Rdb) Save() error {
+	rdb.mu.Lock()
+	if rdb.saving {
+		rdb.mu.Unlock()
+		return ErrSaveInProgress
+	}
+	rdb.saving = true
+	rdb.mu.Unlock()
+
+	return rdb.save()
+}
+
+func (rdb *Rdb) save() (err error) {
+	tmpPath := rdb.path + ".tmp"
+	defer func() {
+		rdb.mu.Lock()
+		rdb.saving = false
+		rdb.lastTry = time.Now()
+		rdb.lastErr = err
+		if err == nil {
+			rdb.dirty -= rdb.dirtyAtSave
+			rdb.lastSave = rdb.lastTry
+		}
+		rdb.mu.Unlock()
+
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+
+	snap := Freeze(func() {
+		rdb.mu.Lock()
+		rdb.dirtyAtSave = rdb.dirty
+		rdb.mu.Unlock()
+	})
+
+	w, err := rdb.cipher.writer(tmp)
+	if err != nil {
+		return err
+	}
+	if err := WriteRdb(w, snap); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, rdb.path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(rdb.path))
+
+	return nil
+}
+
+// LastSave returns the time of the last successful save.
+func (rdb *Rdb) LastSave() time.Time {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	return rdb.lastSave
+}
+
+// RdbInfo is the state of the snapshots reported by INFO.
+type RdbInfo struct {
+	Changes  int64
+	Saving   bool
+	LastSave time.Time
+	LastErr  error
+}
+
+func (rdb *Rdb) Info() RdbInfo {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	return RdbInfo{
+		Changes:  rdb.dirty,
+		Saving:   rdb.saving,
+		LastSave: rdb.lastSave,
+		LastErr:  rdb.lastErr,
+	}
+}
+
+// Read calls fn with every key of the snapshot file, for the caller to add
+// them to the keyspace with LoadKey. The checksum is only verified at the
+// end, so a corrupted file may have keys loaded already. The bytes read are
+// counted in progress, which may be nil.
+func (rdb *Rdb) Read(progress *LoadProgress, fn func(key string, obj *RedisObject, expireAt int64)) error {
+	file, err := os.Open(rdb.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	progress.start(info.Size())
+	return ReadRdbFile(progress.reader(file), info.Size(), rdb.cipher, fn)
+}
+
+// LoadKey adds a key read from a snapshot to the keyspace, unless it has
+// already expired, and reports whether it did.
+func LoadKey(key string, obj *RedisObject, expireAt int64) bool {
+	if expireAt != 0 && expireAt <= now() {
+		return false
+	}
+
+	shard := GetShard(key)
+	shard.Mu.Lock()
+	defer shard.Mu.Unlock()
+
+	shard.remove(key)
+	shard.store(key, obj, expireAt)
+	return true
+}
+
+// WriteRdb writes snap to w in the snapshot format.
+func WriteRdb(w io.Writer, snap *Snapshot) error {
+	crc := crc64.New(rdbTable)
+	bw := bufio.NewWriterSize(io.MultiWriter(w, crc), 64*1024)
+
+	if _, err := fmt.Fprintf(bw, "%s%04d", rdbMagic, RdbVersion); err != nil {
+		return err
+	}
+
+	var buf []byte
+	err := snap.Each(func(key string, obj *RedisObject, expireAt int64) error {
+		buf = appendRecord(buf[:0], key, obj, expireAt)
+		_, err := bw.Write(buf)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := bw.WriteByte(rdbOpEOF); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	_, err = w.Write(binary.LittleEndian.AppendUint64(nil, crc.Sum64()))
+	return err
+}
+
+func appendRecord(buf []byte, key string, obj *RedisObject, expireAt int64) []byte {
+	if expireAt != 0 {
+		buf = append(buf, rdbOpExpire)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(expireAt))
+	}
+
+	switch obj.Type {
+	case RedisObjectString:
+		buf = append(buf, rdbTypeString)
+		buf = appendRdbString(buf, key)
+		buf = appendRdbString(buf, obj.Str)
+	case RedisObjectList:
+		buf = append(buf, rdbTypeList)
+		buf = appendRdbString(buf, key)
+		buf = binary.AppendUvarint(buf, uint64(obj.List.Len()))
+		for i := range obj.List.Len() {
+			buf = appendRdbString(buf, obj.List.At(i))
+		}
+	case RedisObjectSet:
+		buf = append(buf, rdbTypeSet)
+		buf = appendRdbString(buf, key)
+		buf = binary.AppendUvarint(buf, uint64(len(obj.Set)))
+		for member := range obj.Set {
+			buf = appendRdbString(buf, member)
+		}
+	case RedisObjectZSet:
+		buf = append(buf, rdbTypeZSet)
+		buf = appendRdbString(buf, key)
+		buf = binary.AppendUvarint(buf, uint64(obj.ZSet.Len()))
+		for _, m := range obj.ZSet.Range(0, obj.ZSet.Len()-1, false) {
+			buf = appendRdbString(buf, m.Member)
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(m.Score))
+		}
+	case RedisObjectHash:
+		buf = append(buf, rdbTypeHash)
+		buf = appendRdbString(buf, key)
+		buf = binary.AppendUvarint(buf, uint64(len(obj.Hash)))
+		for field, value := range obj.Hash {
+			buf = appendRdbString(buf, field)
+			buf = appendRdbString(buf, value)
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(obj.HashExpires[field]))
+		}
+	}
+
+	return buf
+}
+
+func appendRdbString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// rdbReader reads a snapshot while computing its checksum. No length read
+// may exceed the size of the file, so a corrupted one cannot make it
+// allocate more.
+type rdbReader struct {
+	r    *bufio.Reader
+	crc  hash.Hash64
+	size int64
+	one  [1]byte
+}
+
+func (r *rdbReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	r.one[0] = b
+	r.crc.Write(r.one[:])
+	return b, nil
+}
+
+func (r *rdbReader) readFull(buf []byte) error {
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return err
+	}
+	r.crc.Write(buf)
+	return nil
+}
+
+func (r *rdbReader) readLength() (int, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(r.size) {
+		return 0, fmt.Errorf("%w: length %d exceeds the file size", ErrBadSnapshot, n)
+	}
+	return int(n), nil
+}
+
+func (r *rdbReader) readString() (string, error) {
+	n, err := r.readLength()
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	if err := r.readFull(buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func (r *rdbReader) readUint64() (uint64, error) {
+	var buf [8]byte
+	if err := r.readFull(buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+// ReadRdbFile is ReadRdb for the file of size bytes read from r, which is
+// decrypted with c when it is encrypted.
+func ReadRdbFile(r io.Reader, size int64, c *Cipher, fn func(key string, obj *RedisObject, expireAt int64)) error {
+	plain, _, err := openPlaintext(r, c)
+	if err != nil {
+		return err
+	}
+	return ReadRdb(plain, size, fn)
+}
+
+// ReadRdb calls fn with every key of the snapshot of size bytes read from
+// rd. The checksum is only verified at the end.
+func ReadRdb(rd io.Reader, size int64, fn func(key string, obj *RedisObject, expireAt int64)) error {
+	r := &rdbReader{r: bufio.NewReaderSize(rd, 64*1024), crc: crc64.New(rdbTable), size: size}
+
+	header := make([]byte, len(rdbMagic)+4)
+	if err := r.readFull(header); err != nil || string(header[:len(rdbMagic)]) != rdbMagic {
+		return fmt.Errorf("%w: wrong signature", ErrBadSnapshot)
+	}
+	var version int
+	if _, err := fmt.Sscanf(string(header[len(rdbMagic):]), "%04d", &version); err != nil {
+		return fmt.Errorf("%w: wrong signature", ErrBadSnapshot)
+	}
+	if version > RdbVersion {
+		return fmt.Errorf("%w: version %d is newer than %d", ErrBadSnapshot, version, RdbVersion)
+	}
+
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return truncated(err)
+		}
+		if op == rdbOpEOF {
+			break
+		}
+
+		var expireAt int64
+		if op == rdbOpExpire {
+			at, err := r.readUint64()
+			if err != nil {
+				return truncated(err)
+			}
+			expireAt = int64(at)
+			if op, err = r.ReadByte(); err != nil {
+				return truncated(err)
+			}
+		}
+
+		key, err := r.readString()
+		if err != nil {
+			return truncated(err)
+		}
+		obj, err := r.readObject(op)
+		if err != nil {
+			return truncated(err)
+		}
+		fn(key, obj, expireAt)
+	}
+
+	sum := r.crc.Sum64()
+	var stored [8]byte
+	if _, err := io.ReadFull(r.r, stored[:]); err != nil {
+		return truncated(err)
+	}
+	if binary.LittleEndian.Uint64(stored[:]) != sum {
+		return fmt.Errorf("%w: checksum mismatch", ErrBadSnapshot)
+	}
+
+	return nil
+}
+
+func (r *rdbReader) readObject(typ byte) (*RedisObject, error) {
+	if typ == rdbTypeString {
+		str, err := r.readString()
+		return &RedisObject{Type: RedisObjectString, Str: str}, err
+	}
+
+	n, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ {
+	case rdbTypeList:
+		list := NewDeque()
+		for range n {
+			item, err := r.readString()
+			if err != nil {
+				return nil, err
+			}
+			list.PushBack(item)
+		}
+		return &RedisObject{Type: RedisObjectList, List: list}, nil
+	case rdbTypeSet:
+		set := make(map[string]struct{}, n)
+		for range n {
+			member, err := r.readString()
+			if err != nil {
+				return nil, err
+			}
+			set[member] = struct{}{}
+		}
+		return &RedisObject{Type: RedisObjectSet, Set: set}, nil
+	case rdbTypeZSet:
+		zset := NewZSet()
+		for range n {
+			member, err := r.readString()
+			if err != nil {
+				return nil, err
+			}
+			score, err := r.readUint64()
+			if err != nil {
+				return nil, err
+			}
+			zset.Add(member, math.Float64frombits(score))
+		}
+		return &RedisObject{Type: RedisObjectZSet, ZSet: zset}, nil
+	case rdbTypeHash:
+		obj := &RedisObject{Type: RedisObjectHash, Hash: make(map[string]string, n)}
+		for range n {
+			field, err := r.readString()
+			if err != nil {
+				return nil, err
+			}
+			value, err := r.readString()
+			if err != nil {
+				return nil, err
+			}
+			at, err := r.readUint64()
+			if err != nil {
+				return nil, err
+			}
+			obj.Hash[field] = value
+			if at != 0 {
+				obj.setFieldExpire(field, int64(at))
+			}
+		}
+		return obj, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown type %d", ErrBadSnapshot, typ)
+}
+
+// truncated reports a snapshot ending early as a bad one.
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: unexpected end of file", ErrBadSnapshot)
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/devkarim/goredis/eviction"
+)
+
+// loadRdb adds the keys of the snapshot to the keyspace the way the server
+// does, and returns how many it added.
+func loadRdb(rdb *Rdb) (int, error) {
+	loaded := 0
+	err := rdb.Read(nil, func(key string, obj *RedisObject, expireAt int64) {
+		if LoadKey(key, obj, expireAt) {
+			loaded++
+		}
+	})
+	return loaded, err
+}
+
+func TestRdb_SaveAndLoad(t *testing.T) {
+	clock := withClock(t, 1000)
+	Setup(eviction.PolicyLRU, 1<<20)
+
+	GetShard("s").SetString("s", "value")
+	GetShard("s").ExpireAt("s", 9000, ExpireAlways)
+	GetShard("gone").SetString("gone", "soon")
+	GetShard("gone").ExpireAt("gone", 2000, ExpireAlways)
+	GetShard("l").ListPush("l", []string{"a", "b", "c"}, false, false)
+	GetShard("set").SAdd("set", []string{"x", "y"})
+	GetShard("z").ZAdd("z", ZAddOptions{}, []ZMember{{"a", 1.5}, {"b", math.Inf(-1)}})
+	GetShard("h").HSet("h", []HashField{{"f", "v"}, {"g", "w"}})
+	GetShard("h").HExpireAt("h", []string{"f"}, 8000, ExpireAlways)
+
+	rdb := NewRdb(filepath.Join(t.TempDir(), "dump.rdb"), nil)
+	rdb.Changed(7)
+	if err := rdb.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if changes := rdb.Info().Changes; changes != 0 {
+		t.Errorf("Changes after save = %d; want 0", changes)
+	}
+
+	*clock = 3000
+	Setup(eviction.PolicyLRU, 1<<20)
+	loaded, err := loadRdb(rdb)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if loaded != 5 {
+		t.Errorf("Read() = %d keys; want 5 as gone expired", loaded)
+	}
+
+	if v, _, _ := GetShard("s").GetString("s"); v != "value" {
+		t.Errorf("s = %q; want value", v)
+	}
+	if ttl := GetShard("s").TTL("s"); ttl != 6000 {
+		t.Errorf("TTL(s) = %d; want 6000", ttl)
+	}
+	if list, _ := GetShard("l").LRange("l", 0, -1); !slices.Equal(list, []string{"a", "b", "c"}) {
+		t.Errorf("l = %q; want [a b c]", list)
+	}
+	if members, _ := GetShard("set").SMembers("set"); len(members) != 2 {
+		t.Errorf("set = %q; want 2 members", members)
+	}
+	if score, _, _ := GetShard("z").ZScore("z", "b"); !math.IsInf(score, -1) {
+		t.Errorf("score of b = %v; want -inf", score)
+	}
+	if ttls, _ := GetShard("h").HTTL("h", []string{"f", "g"}); ttls[0] != 5000 || ttls[1] != TTLNoExpire {
+		t.Errorf("HTTL(h, f, g) = %v; want [5000 %d]", ttls, TTLNoExpire)
+	}
+}
+
+func TestRdb_RejectsCorruptedFile(t *testing.T) {
+	withClock(t, 1000)
+	Setup(eviction.PolicyLRU, 1<<20)
+	GetShard("k").SetString("k", "value")
+
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	rdb := NewRdb(path, nil)
+	if err := rdb.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, corrupt := range map[string][]byte{
+		"flipped byte": append(slices.Clone(data[:len(data)-10]), append([]byte{data[len(data)-10] ^ 1}, data[len(data)-9:]...)...),
+		"truncated":    data[:len(data)-4],
+		"newer":        append([]byte(rdbMagic+"9999"), data[len(rdbMagic)+4:]...),
+	} {
+		if err := os.WriteFile(path, corrupt, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadRdb(rdb); !errors.Is(err, ErrBadSnapshot) {
+			t.Errorf("%s: Read() error = %v; want ErrBadSnapshot", name, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/devkarim/goredis/resp"
+)
+
+// rewriteItemsPerCommand bounds the elements added by a single command of a
+// rewritten AOF, so that loading it never needs huge commands.
+const rewriteItemsPerCommand = 64
+
+func bulk(str string) resp.Value {
+	return resp.Value{Type: resp.RespBulk, Str: str}
+}
+
+func command(name string, args ...string) resp.Value {
+	arr := make([]resp.Value, 0, len(args)+1)
+	arr = append(arr, bulk(name))
+	for _, arg := range args {
+		arr = append(arr, bulk(arg))
+	}
+	return resp.Value{Type: resp.RespArray, Array: arr}
+}
+
+// batched emits name key items... in commands of at most
+// rewriteItemsPerCommand items, where an item spans width arguments.
+func batched(name, key string, args []string, width int, emit func(resp.Value)) {
+	step := rewriteItemsPerCommand * width
+	for start := 0; start < len(args); start += step {
+		end := min(start+step, len(args))
+		emit(command(name, append([]string{key}, args[start:end]...)...))
+	}
+}
+
+// rewriteCommands emits the shortest commands recreating obj at key.
+func rewriteCommands(key string, obj *RedisObject, expireAt int64, emit func(resp.Value)) {
+	switch obj.Type {
+	case RedisObjectString:
+		emit(command("SET", key, obj.Str))
+	case RedisObjectList:
+		batched("RPUSH", key, obj.List.Range(0, obj.List.Len()-1), 1, emit)
+	case RedisObjectSet:
+		batched("SADD", key, setMembers(obj.Set), 1, emit)
+	case RedisObjectZSet:
+		members := obj.ZSet.Range(0, obj.ZSet.Len()-1, false)
+		args := make([]string, 0, len(members)*2)
+		for _, m := range members {
+			args = append(args, resp.FormatDouble(m.Score), m.Member)
+		}
+		batched("ZADD", key, args, 2, emit)
+	case RedisObjectHash:
+		args := make([]string, 0, len(obj.Hash)*2)
+		for field, value := range obj.Hash {
+			args = append(args, field, value)
+		}
+		batched("HSET", key, args, 2, emit)
+
+		// fields sharing a deadline are expired by the same command
+		byDeadline := map[int64][]string{}
+		for field, at := range obj.HashExpires {
+			byDeadline[at] = append(byDeadline[at], field)
+		}
+		for _, at := range slices.Sorted(maps.Keys(byDeadline)) {
+			fields := byDeadline[at]
+			args := append([]string{key, strconv.FormatInt(at, 10), "FIELDS", strconv.Itoa(len(fields))}, fields...)
+			emit(command("HPEXPIREAT", args...))
+		}
+	}
+
+	if expireAt != 0 {
+		emit(command("PEXPIREAT", key, strconv.FormatInt(expireAt, 10)))
+	}
+}
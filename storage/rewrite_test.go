@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/devkarim/goredis/eviction"
+	"github.com/devkarim/goredis/resp"
+)
+
+func TestRewrite_CompactsToCurrentKeyspace(t *testing.T) {
+	withClock(t, 1000)
+	Setup(eviction.PolicyLRU, 1<<20)
+
+	aof, err := NewAof(AofConfig{Dir: t.TempDir(), Name: "test.aof", Fsync: FsyncEverySec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aof.Close()
+
+	// many overwrites of the same key only leave the last one
+	for i := range 100 {
+		v := strconv.Itoa(i)
+		GetShard("s").SetString("s", v)
+		aof.Write(command("SET", "s", v))
+	}
+	items := make([]string, 100)
+	for i := range items {
+		items[i] = strconv.Itoa(i)
+	}
+	GetShard("l").ListPush("l", items, false, false)
+	GetShard("l").ExpireAt("l", 5000, ExpireAlways)
+	GetShard("h").HSet("h", []HashField{{"f", "v"}, {"g", "w"}})
+	GetShard("h").HExpireAt("h", []string{"f"}, 9000, ExpireAlways)
+	before := aof.Size()
+
+	if err := aof.Rewrite(); err != nil {
+		t.Fatalf("Rewrite: %v", err)
+	}
+	if after := aof.Size(); after >= before {
+		t.Errorf("Size after rewrite = %d; want less than %d", after, before)
+	}
+
+	var got []string
+	aof.Read(nil, func(v resp.Value) {
+		args := make([]string, len(v.Array))
+		for i, arg := range v.Array {
+			args[i] = arg.Str
+		}
+		got = append(got, strings.Join(args, " "))
+	})
+
+	want := map[string]bool{
+		"SET s 99":                                 true,
+		"PEXPIREAT l 5000":                         true,
+		"HPEXPIREAT h 9000 FIELDS 1 f":             true,
+		"RPUSH l " + strings.Join(items[:64], " "): true,
+		"RPUSH l " + strings.Join(items[64:], " "): true,
+	}
+	for _, cmd := range got {
+		delete(want, cmd)
+	}
+	for cmd := range want {
+		t.Errorf("rewritten AOF lacks %q, got %q", cmd, got)
+	}
+}
+
+func TestRewrite_ConcurrentWritesAreLoggedOnce(t *testing.T) {
+	Setup(eviction.PolicyLRU, 1<<30)
+
+	aof, err := NewAof(AofConfig{Dir: t.TempDir(), Name: "test.aof", Fsync: FsyncEverySec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aof.Close()
+
+	counters := make([]string, 32)
+	for i := range counters {
+		counters[i] = "counter:" + strconv.Itoa(i)
+	}
+	for i := range 20000 {
+		key := "filler:" + strconv.Itoa(i)
+		GetShard(key).SetString(key, "x")
+	}
+
+	// each increment is applied and logged like a command, racing with the
+	// copy of the keyspace
+	incr := func(key string) {
+		release := Acquire([]string{key}, false, false)
+		defer release()
+		BeforeWrite([]string{key}, false)
+		GetShard(key).IncrBy(key, 1)
+		aof.Write(command("INCR", key))
+	}
+	var wg sync.WaitGroup
+	for _, key := range counters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				incr(key)
+			}
+		}()
+	}
+	if err := aof.Rewrite(); err != nil {
+		t.Fatalf("Rewrite: %v", err)
+	}
+	wg.Wait()
+
+	Setup(eviction.PolicyLRU, 1<<30)
+	err = aof.Read(nil, func(v resp.Value) {
+		key := v.Array[1].Str
+		switch v.Array[0].Str {
+		case "SET":
+			GetShard(key).SetString(key, v.Array[2].Str)
+		case "INCR":
+			GetShard(key).IncrBy(key, 1)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range counters {
+		if v, _, _ := GetShard(key).GetString(key); v != "200" {
+			t.Errorf("%s = %q after loading the rewritten AOF; want 200", key, v)
+		}
+	}
+}
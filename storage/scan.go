@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"container/heap"
+	"iter"
+	"maps"
+	"math"
+
+	"github.com/devkarim/goredis/glob"
+)
+
+// scanBuckets is the number of buckets the keys of a shard are spread over.
+// SCAN walks the buckets in order, and since the bucket of a key only
+// depends on its hash, every key present during the whole scan is returned.
+const scanBuckets = 1 << 10
+
+// scanMaxEmptyFactor bounds the empty buckets visited per call to
+// COUNT * scanMaxEmptyFactor, so a sparse keyspace cannot stall the server.
+const scanMaxEmptyFactor = 10
+
+const DefaultScanCount = 10
+
+type ScanOptions struct {
+	Match string          // glob pattern, empty matches everything
+	Count int             // amount of work done per call
+	Type  RedisObjectType // only used by SCAN, empty for any type
+}
+
+func (opts ScanOptions) match(name string) bool {
+	return opts.Match == "" || glob.Match(opts.Match, name)
+}
+
+func bucketOf(key string) int {
+	// the low bits of the hash already pick the shard
+	return int(hashKey(key)/ShardCount) % scanBuckets
+}
+
+// index must be called with the write lock held.
+func (s *Shard) index(key string) {
+	if s.buckets == nil {
+		s.buckets = make([]map[string]struct{}, scanBuckets)
+	}
+
+	b := bucketOf(key)
+	if s.buckets[b] == nil {
+		s.buckets[b] = map[string]struct{}{}
+	}
+	s.buckets[b][key] = struct{}{}
+}
+
+// unindex must be called with the write lock held.
+func (s *Shard) unindex(key string) {
+	if s.buckets == nil {
+		return
+	}
+
+	b := bucketOf(key)
+	delete(s.buckets[b], key)
+	if len(s.buckets[b]) == 0 {
+		s.buckets[b] = nil
+	}
+}
+
+// Scan returns the keys found from cursor on, and the cursor to continue
+// from, which is 0 once every shard has been walked. The cursor encodes a
+// shard and a bucket within it, so a call only holds one shard at a time.
+func Scan(cursor uint64, opts ScanOptions) ([]string, uint64) {
+	total := uint64(ShardCount) * scanBuckets
+	keys := []string{}
+
+	examined, empty := 0, 0
+	for ; cursor < total && examined < opts.Count && empty < opts.Count*scanMaxEmptyFactor; cursor++ {
+		shard := shards[cursor/scanBuckets]
+		b := int(cursor % scanBuckets)
+
+		shard.Mu.RLock()
+		if shard.buckets == nil || len(shard.buckets[b]) == 0 {
+			shard.Mu.RUnlock()
+			empty++
+			continue
+		}
+
+		for key := range shard.buckets[b] {
+			examined++
+			obj, ok := shard.lookup(key)
+			if !ok || !opts.match(key) || (opts.Type != "" && obj.Type != opts.Type) {
+				continue
+			}
+			keys = append(keys, key)
+		}
+		shard.Mu.RUnlock()
+	}
+
+	if cursor >= total {
+		cursor = 0
+	}
+
+	return keys, cursor
+}
+
+// Keys returns every live key matching pattern.
+func Keys(pattern string) []string {
+	keys := []string{}
+	for _, shard := range shards {
+		shard.Mu.RLock()
+		for key := range shard.Store {
+			if _, ok := shard.lookup(key); ok && glob.Match(pattern, key) {
+				keys = append(keys, key)
+			}
+		}
+		shard.Mu.RUnlock()
+	}
+
+	return keys
+}
+
+// hashHeap is a max-heap of member hashes, see scanMembers.
+type hashHeap []uint64
+
+func (h hashHeap) Len() int           { return len(h) }
+func (h hashHeap) Less(i, j int) bool { return h[i] > h[j] }
+func (h hashHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *hashHeap) Push(x any)        { *h = append(*h, x.(uint64)) }
+func (h *hashHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// scanMembers pages through the members of a collection in the order of
+// their hash: the cursor is the next hash to return. Like Scan, every member
+// present during the whole iteration is returned, whatever the writes in
+// between. Members sharing a hash are always returned together.
+//
+// A first pass finds the COUNT lowest hashes from cursor on, keeping only
+// those in a heap, and a second one collects the members up to the highest
+// of them, so a call never holds more than a page of the collection.
+func scanMembers(cursor uint64, opts ScanOptions, members iter.Seq[string]) ([]string, uint64) {
+	lowest := hashHeap{}
+	for member := range members {
+		h := uint64(hashKey(member))
+		switch {
+		case h < cursor:
+		case len(lowest) < opts.Count:
+			heap.Push(&lowest, h)
+		case h < lowest[0]:
+			lowest[0] = h
+			heap.Fix(&lowest, 0)
+		}
+	}
+
+	arr := []string{}
+	if len(lowest) == 0 {
+		return arr, 0
+	}
+
+	last := lowest[0]
+	for member := range members {
+		if h := uint64(hashKey(member)); h >= cursor && h <= last && opts.match(member) {
+			arr = append(arr, member)
+		}
+	}
+
+	if len(lowest) < opts.Count || last == math.MaxUint32 {
+		return arr, 0
+	}
+
+	return arr, last + 1
+}
+
+// HScan returns the fields and values of the hash at key, flattened.
+func (s *Shard) HScan(key string, cursor uint64, opts ScanOptions) ([]string, uint64, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectHash)
+	if err != nil || !ok {
+		return []string{}, 0, err
+	}
+
+	fields, cursor := scanMembers(cursor, opts, maps.Keys(obj.Hash))
+
+	arr := make([]string, 0, len(fields)*2)
+	for _, field := range fields {
+		arr = append(arr, field, obj.Hash[field])
+	}
+
+	return arr, cursor, nil
+}
+
+func (s *Shard) SScan(key string, cursor uint64, opts ScanOptions) ([]string, uint64, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectSet)
+	if err != nil || !ok {
+		return []string{}, 0, err
+	}
+
+	members, cursor := scanMembers(cursor, opts, maps.Keys(obj.Set))
+
+	return members, cursor, nil
+}
+
+func (s *Shard) ZScan(key string, cursor uint64, opts ScanOptions) ([]ZMember, uint64, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectZSet)
+	if err != nil || !ok {
+		return []ZMember{}, 0, err
+	}
+
+	names, cursor := scanMembers(cursor, opts, maps.Keys(obj.ZSet.dict))
+
+	arr := make([]ZMember, len(names))
+	for i, member := range names {
+		score, _ := obj.ZSet.Score(member)
+		arr[i] = ZMember{Member: member, Score: score}
+	}
+
+	return arr, cursor, nil
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/devkarim/goredis/eviction"
+)
+
+func TestScan_ReturnsStableKeysDespiteWrites(t *testing.T) {
+	Setup(eviction.PolicyLRU, 1<<20)
+
+	for i := range 500 {
+		key := "stable" + strconv.Itoa(i)
+		GetShard(key).SetString(key, "v")
+	}
+
+	seen := map[string]bool{}
+	cursor, calls := uint64(0), 0
+	for {
+		var keys []string
+		keys, cursor = Scan(cursor, ScanOptions{Count: 10})
+		for _, key := range keys {
+			seen[key] = true
+		}
+
+		// churn the keyspace between calls
+		added := "churn" + strconv.Itoa(calls)
+		GetShard(added).SetString(added, "v")
+		if calls > 0 {
+			Delete([]string{"churn" + strconv.Itoa(calls-1)})
+		}
+
+		calls++
+		if cursor == 0 {
+			break
+		}
+	}
+
+	for i := range 500 {
+		if key := "stable" + strconv.Itoa(i); !seen[key] {
+			t.Errorf("SCAN missed %q", key)
+		}
+	}
+}
+
+func TestScan_Filters(t *testing.T) {
+	Setup(eviction.PolicyLRU, 1<<20)
+
+	GetShard("s1").SetString("s1", "v")
+	GetShard("s2").SetString("s2", "v")
+	GetShard("l1").ListPush("l1", []string{"x"}, false, false)
+
+	var keys []string
+	for cursor := uint64(0); ; {
+		var page []string
+		page, cursor = Scan(cursor, ScanOptions{Count: 100, Match: "?1", Type: RedisObjectString})
+		keys = append(keys, page...)
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if len(keys) != 1 || keys[0] != "s1" {
+		t.Errorf("SCAN MATCH ?1 TYPE string = %v; want [s1]", keys)
+	}
+}
+
+func TestSScan_Paginates(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 1<<20)
+
+	members := make([]string, 100)
+	for i := range members {
+		members[i] = "m" + strconv.Itoa(i)
+	}
+	shard.SAdd("s", members)
+
+	seen := map[string]int{}
+	cursor, calls := uint64(0), 0
+	for {
+		var page []string
+		page, cursor, _ = shard.SScan("s", cursor, ScanOptions{Count: 7})
+		for _, member := range page {
+			seen[member]++
+		}
+		calls++
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if len(seen) != len(members) {
+		t.Errorf("SSCAN returned %d distinct members; want %d", len(seen), len(members))
+	}
+	for member, n := range seen {
+		if n != 1 {
+			t.Errorf("SSCAN returned %q %d times", member, n)
+		}
+	}
+	if calls < 100/7 {
+		t.Errorf("SSCAN took %d calls; want pages of about 7 members", calls)
+	}
+}
+
+func TestHScan_WritesDuringIteration(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 1<<20)
+
+	fields := make([]HashField, 100)
+	for i := range fields {
+		fields[i] = HashField{"f" + strconv.Itoa(i), "v"}
+	}
+	shard.HSet("h", fields)
+
+	// fields seen by page, the writes happen after the first one
+	seen, deleted := map[string]bool{}, false
+	cursor := uint64(0)
+	for {
+		var page []string
+		page, cursor, _ = shard.HScan("h", cursor, ScanOptions{Count: 10})
+		for j := 0; j < len(page); j += 2 {
+			if deleted && (page[j] == "f99" || page[j] == "f98") {
+				t.Errorf("HSCAN returned %q after it was deleted", page[j])
+			}
+			seen[page[j]] = true
+		}
+		if cursor == 0 {
+			break
+		}
+		if !deleted {
+			shard.HDel("h", []string{"f99", "f98"})
+			shard.HSet("h", []HashField{{"new", "v"}})
+			deleted = true
+		}
+	}
+
+	for _, f := range fields[:98] {
+		if !seen[f.Field] {
+			t.Errorf("HSCAN missed %q, present during the whole iteration", f.Field)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"math/rand/v2"
+)
+
+type SetOperation int
+
+const (
+	SetUnion SetOperation = iota
+	SetInter
+	SetDiff
+)
+
+func newSetObject() *RedisObject {
+	return &RedisObject{Type: RedisObjectSet, Set: map[string]struct{}{}}
+}
+
+func (s *Shard) SAdd(key string, members []string) (int, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	return s.sadd(key, members)
+}
+
+func (s *Shard) sadd(key string, members []string) (int, error) {
+	neededSize := 0
+	for _, member := range members {
+		neededSize += len(member)
+	}
+
+	obj, err := s.prepareWrite(key, RedisObjectSet, neededSize, newSetObject)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, member := range members {
+		if _, ok := obj.Set[member]; ok {
+			continue
+		}
+		obj.Set[member] = struct{}{}
+		s.CurrentMemory += len(member)
+		added++
+	}
+
+	return added, nil
+}
+
+func (s *Shard) SRem(key string, members []string) (int, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	return s.srem(key, members)
+}
+
+func (s *Shard) srem(key string, members []string) (int, error) {
+	obj, ok, err := s.lookupType(key, RedisObjectSet)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	removed := 0
+	for _, member := range members {
+		if _, ok := obj.Set[member]; !ok {
+			continue
+		}
+		delete(obj.Set, member)
+		s.CurrentMemory -= len(member)
+		removed++
+	}
+
+	if len(obj.Set) == 0 {
+		s.remove(key)
+	}
+
+	return removed, nil
+}
+
+func (s *Shard) SMembers(key string) ([]string, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectSet)
+	if err != nil || !ok {
+		return []string{}, err
+	}
+
+	return setMembers(obj.Set), nil
+}
+
+// SIsMember reports for each of members whether it belongs to the set at key.
+func (s *Shard) SIsMember(key string, members []string) ([]bool, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	result := make([]bool, len(members))
+
+	obj, ok, err := s.lookupType(key, RedisObjectSet)
+	if err != nil || !ok {
+		return result, err
+	}
+
+	for i, member := range members {
+		_, result[i] = obj.Set[member]
+	}
+
+	return result, nil
+}
+
+func (s *Shard) SCard(key string) (int, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectSet)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	return len(obj.Set), nil
+}
+
+// SPop removes and returns up to count random members of the set at key.
+func (s *Shard) SPop(key string, count int) ([]string, bool, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	obj, ok, err := s.lookupType(key, RedisObjectSet)
+	if err != nil || !ok {
+		return []string{}, false, err
+	}
+
+	members := randomMembers(obj.Set, count)
+	for _, member := range members {
+		delete(obj.Set, member)
+		s.CurrentMemory -= len(member)
+	}
+
+	if len(obj.Set) == 0 {
+		s.remove(key)
+	}
+
+	return members, true, nil
+}
+
+// SRandMember returns up to count distinct random members of the set at key,
+// or exactly -count members possibly repeated when count is negative.
+func (s *Shard) SRandMember(key string, count int) ([]string, bool, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectSet)
+	if err != nil || !ok {
+		return []string{}, false, err
+	}
+
+	if count >= 0 {
+		return randomMembers(obj.Set, count), true, nil
+	}
+
+	all := setMembers(obj.Set)
+	members := make([]string, -count)
+	for i := range members {
+		members[i] = all[rand.IntN(len(all))]
+	}
+
+	return members, true, nil
+}
+
+// SMove atomically moves member from the set at src to the set at dst, even
+// when both keys live on different shards.
+func SMove(src, dst, member string) (bool, error) {
+	unlock := lockShards(src, dst)
+	defer unlock()
+
+	srcShard, dstShard := GetShard(src), GetShard(dst)
+	srcShard.expireIfNeeded(src)
+	dstShard.expireIfNeeded(dst)
+
+	obj, ok, err := srcShard.lookupType(src, RedisObjectSet)
+	if err != nil || !ok {
+		return false, err
+	}
+	if _, _, err := dstShard.lookupType(dst, RedisObjectSet); err != nil {
+		return false, err
+	}
+	if _, ok := obj.Set[member]; !ok {
+		return false, nil
+	}
+
+	srcShard.srem(src, []string{member})
+	if _, err := dstShard.sadd(dst, []string{member}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SetCombine computes the union, intersection or difference of the sets at
+// keys while holding all their shards, so the result is a consistent snapshot.
+func SetCombine(op SetOperation, keys []string) ([]string, error) {
+	unlock := lockShards(keys...)
+	defer unlock()
+
+	result, err := combineSets(op, keys)
+	if err != nil {
+		return []string{}, err
+	}
+
+	return setMembers(result), nil
+}
+
+// SetCombineStore is like SetCombine but overwrites dst with the result,
+// deleting it when the result is empty, and returns its cardinality.
+func SetCombineStore(op SetOperation, dst string, keys []string) (int, error) {
+	unlock := lockShards(append([]string{dst}, keys...)...)
+	defer unlock()
+
+	result, err := combineSets(op, keys)
+	if err != nil {
+		return 0, err
+	}
+
+	shard := GetShard(dst)
+	shard.remove(dst)
+	if len(result) == 0 {
+		return 0, nil
+	}
+
+	if _, err := shard.sadd(dst, setMembers(result)); err != nil {
+		return 0, err
+	}
+
+	return len(result), nil
+}
+
+// combineSets must be called with the shards of all keys locked.
+func combineSets(op SetOperation, keys []string) (map[string]struct{}, error) {
+	sets := make([]map[string]struct{}, len(keys))
+	for i, key := range keys {
+		shard := GetShard(key)
+		shard.expireIfNeeded(key)
+		obj, ok, err := shard.lookupType(key, RedisObjectSet)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			sets[i] = obj.Set
+		}
+	}
+
+	result := map[string]struct{}{}
+	switch op {
+	case SetUnion:
+		for _, set := range sets {
+			for member := range set {
+				result[member] = struct{}{}
+			}
+		}
+	case SetInter:
+		for member := range sets[0] {
+			inAll := true
+			for _, set := range sets[1:] {
+				if _, ok := set[member]; !ok {
+					inAll = false
+					break
+				}
+			}
+			if inAll {
+				result[member] = struct{}{}
+			}
+		}
+	case SetDiff:
+		for member := range sets[0] {
+			result[member] = struct{}{}
+		}
+		for _, set := range sets[1:] {
+			for member := range set {
+				delete(result, member)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func setMembers(set map[string]struct{}) []string {
+	arr := make([]string, 0, len(set))
+	for member := range set {
+		arr = append(arr, member)
+	}
+	return arr
+}
+
+// randomMembers picks up to count distinct members uniformly at random.
+func randomMembers(set map[string]struct{}, count int) []string {
+	all := setMembers(set)
+	if count >= len(all) {
+		return all
+	}
+
+	for i := range count {
+		j := i + rand.IntN(len(all)-i)
+		all[i], all[j] = all[j], all[i]
+	}
+
+	return all[:count]
+}
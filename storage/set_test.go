@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/devkarim/goredis/eviction"
+)
+
+func TestSet_MemoryAccounting(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 100)
+
+	shard.SAdd("s", []string{"aa", "bbb", "aa"})
+	if shard.CurrentMemory != 5 {
+		t.Errorf("CurrentMemory = %d; want 5", shard.CurrentMemory)
+	}
+
+	shard.SRem("s", []string{"aa", "bbb"})
+	if shard.CurrentMemory != 0 {
+		t.Errorf("CurrentMemory = %d; want 0", shard.CurrentMemory)
+	}
+	if _, ok := shard.Store["s"]; ok {
+		t.Errorf("empty set should have been deleted")
+	}
+}
+
+func TestSet_Combine(t *testing.T) {
+	Setup(eviction.PolicyLRU, 1000)
+
+	// pick keys that live on different shards
+	a, b := "a", "b"
+	for i := 0; GetShard(a) == GetShard(b); i++ {
+		b = "b" + string(rune('0'+i))
+	}
+
+	GetShard(a).SAdd(a, []string{"1", "2", "3"})
+	GetShard(b).SAdd(b, []string{"2", "3", "4"})
+
+	cases := []struct {
+		op   SetOperation
+		want []string
+	}{
+		{SetUnion, []string{"1", "2", "3", "4"}},
+		{SetInter, []string{"2", "3"}},
+		{SetDiff, []string{"1"}},
+	}
+
+	for _, c := range cases {
+		got, err := SetCombine(c.op, []string{a, b})
+		slices.Sort(got)
+		if err != nil || !slices.Equal(got, c.want) {
+			t.Errorf("SetCombine(%d) = %v, %v; want %v", c.op, got, err, c.want)
+		}
+	}
+
+	n, _ := SetCombineStore(SetInter, a, []string{a, b})
+	members, _ := GetShard(a).SMembers(a)
+	slices.Sort(members)
+	if n != 2 || !slices.Equal(members, []string{"2", "3"}) {
+		t.Errorf("SetCombineStore stored %v (%d); want [2 3]", members, n)
+	}
+}
+
+func TestSet_Pop(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 100)
+	shard.SAdd("s", []string{"a", "b", "c"})
+
+	popped, _, _ := shard.SPop("s", 2)
+	if len(popped) != 2 || popped[0] == popped[1] {
+		t.Errorf("SPop returned %v; want 2 distinct members", popped)
+	}
+
+	if n, _ := shard.SCard("s"); n != 1 {
+		t.Errorf("SCard = %d; want 1", n)
+	}
+	if shard.CurrentMemory != 1 {
+		t.Errorf("CurrentMemory = %d; want 1", shard.CurrentMemory)
+	}
+}
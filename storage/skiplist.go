@@ -0,0 +1,255 @@
+package storage
+
+import "math/rand/v2"
+
+const (
+	skiplistMaxLevel = 32
+	skiplistP        = 0.25
+)
+
+// ScoreRange is a [Min, Max] score interval where either end may be exclusive.
+type ScoreRange struct {
+	Min, Max     float64
+	MinEx, MaxEx bool
+}
+
+func (r ScoreRange) gteMin(score float64) bool {
+	if r.MinEx {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+func (r ScoreRange) lteMax(score float64) bool {
+	if r.MaxEx {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+func (r ScoreRange) empty() bool {
+	return r.Min > r.Max || (r.Min == r.Max && (r.MinEx || r.MaxEx))
+}
+
+type skiplistLevel struct {
+	forward *skiplistNode
+	span    int // number of nodes skipped by forward, used to compute ranks
+}
+
+type skiplistNode struct {
+	member   string
+	score    float64
+	backward *skiplistNode
+	level    []skiplistLevel
+}
+
+// skiplist keeps members ordered by (score, member) with O(log n) inserts,
+// deletes, rank lookups and range queries, following the Redis zskiplist.
+type skiplist struct {
+	header *skiplistNode
+	tail   *skiplistNode
+	length int
+	level  int
+}
+
+func newSkiplistNode(level int, score float64, member string) *skiplistNode {
+	return &skiplistNode{member: member, score: score, level: make([]skiplistLevel, level)}
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{header: newSkiplistNode(skiplistMaxLevel, 0, ""), level: 1}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Float64() < skiplistP {
+		level++
+	}
+	return level
+}
+
+// less reports whether (score, member) sorts before node.
+func (n *skiplistNode) less(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+func (zsl *skiplist) insert(score float64, member string) *skiplistNode {
+	var update [skiplistMaxLevel]*skiplistNode
+	var rank [skiplistMaxLevel]int
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i < zsl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && x.level[i].forward.less(score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+
+	x = newSkiplistNode(level, score, member)
+	for i := range level {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = (rank[0] - rank[i]) + 1
+	}
+
+	for i := level; i < zsl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+	zsl.length++
+
+	return x
+}
+
+func (zsl *skiplist) deleteNode(x *skiplistNode, update []*skiplistNode) {
+	for i := range zsl.level {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+
+	for zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+}
+
+func (zsl *skiplist) delete(score float64, member string) bool {
+	update := make([]*skiplistNode, skiplistMaxLevel)
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.less(score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+
+	zsl.deleteNode(x, update)
+	return true
+}
+
+// rank returns the 1-based position of (score, member), or 0 when missing.
+func (zsl *skiplist) rank(score float64, member string) int {
+	rank := 0
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.less(score, member) ||
+				(x.level[i].forward.score == score && x.level[i].forward.member == member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+
+		if x != zsl.header && x.member == member {
+			return rank
+		}
+	}
+
+	return 0
+}
+
+// byRank returns the node at the 1-based position rank.
+func (zsl *skiplist) byRank(rank int) *skiplistNode {
+	traversed := 0
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+
+		if traversed == rank {
+			return x
+		}
+	}
+
+	return nil
+}
+
+func (zsl *skiplist) inRange(r ScoreRange) bool {
+	if r.empty() || zsl.tail == nil {
+		return false
+	}
+
+	return r.gteMin(zsl.tail.score) && r.lteMax(zsl.header.level[0].forward.score)
+}
+
+// firstInRange returns the lowest node within r.
+func (zsl *skiplist) firstInRange(r ScoreRange) *skiplistNode {
+	if !zsl.inRange(r) {
+		return nil
+	}
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.gteMin(x.level[i].forward.score) {
+			x = x.level[i].forward
+		}
+	}
+
+	x = x.level[0].forward
+	if x == nil || !r.lteMax(x.score) {
+		return nil
+	}
+	return x
+}
+
+// lastInRange returns the highest node within r.
+func (zsl *skiplist) lastInRange(r ScoreRange) *skiplistNode {
+	if !zsl.inRange(r) {
+		return nil
+	}
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && r.lteMax(x.level[i].forward.score) {
+			x = x.level[i].forward
+		}
+	}
+
+	if x == zsl.header || !r.gteMin(x.score) {
+		return nil
+	}
+	return x
+}
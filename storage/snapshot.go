@@ -0,0 +1,119 @@
+package storage
+
+import "sync"
+
+// Snapshot is a copy of the keyspace taken at a single instant, which
+// background persistence can walk without holding any lock.
+type Snapshot struct {
+	shards []shardSnapshot
+}
+
+type shardSnapshot struct {
+	store   map[string]*RedisObject
+	expires map[string]int64
+}
+
+// frozenShard is a shard of a snapshot that is not copied yet. It is copied
+// once, by the goroutine taking the snapshot or by the first write to the
+// shard, whichever comes first.
+type frozenShard struct {
+	shard *Shard
+	into  *shardSnapshot
+	ts    int64
+	once  sync.Once
+}
+
+// Freeze takes a snapshot of the keyspace as it is when atomically is
+// called, with every shard held exclusively: writes logged after it returns
+// are exactly the ones missing from the snapshot. Only marking the shards
+// happens with the world stopped. They are then copied one at a time, each
+// while its writers wait, and a write to a shard not copied yet copies it
+// first, see BeforeWrite.
+func Freeze(atomically func()) *Snapshot {
+	snap := &Snapshot{shards: make([]shardSnapshot, len(shards))}
+
+	release := Acquire(nil, true, true)
+	ts := now()
+	frozen := make([]*frozenShard, len(shards))
+	for i, shard := range shards {
+		// a snapshot still being taken keeps its own state of the shard
+		if previous := shard.frozen.Load(); previous != nil {
+			previous.copy()
+		}
+		frozen[i] = &frozenShard{shard: shard, into: &snap.shards[i], ts: ts}
+		shard.frozen.Store(frozen[i])
+	}
+	if atomically != nil {
+		atomically()
+	}
+	release()
+
+	for _, f := range frozen {
+		f.copy()
+	}
+
+	return snap
+}
+
+// BeforeWrite copies the shards owning keys, or every shard when all is set,
+// for the snapshot being taken before a logged write changes them. The
+// caller holds their gates, so that no snapshot can start meanwhile.
+func BeforeWrite(keys []string, all bool) {
+	owners := shards
+	if !all {
+		owners = shardsOf(keys)
+	}
+
+	for _, shard := range owners {
+		if f := shard.frozen.Load(); f != nil {
+			f.copy()
+		}
+	}
+}
+
+func (f *frozenShard) copy() {
+	f.once.Do(func() {
+		shard := f.shard
+		shard.Mu.RLock()
+		defer shard.Mu.RUnlock()
+
+		copied := shardSnapshot{
+			store:   make(map[string]*RedisObject, len(shard.Store)),
+			expires: map[string]int64{},
+		}
+		for key, obj := range shard.Store {
+			when, hasExpiry := shard.Expires[key]
+			if hasExpiry && when <= f.ts {
+				continue
+			}
+			copied.store[key] = obj.Clone()
+			if hasExpiry {
+				copied.expires[key] = when
+			}
+		}
+		*f.into = copied
+		shard.frozen.CompareAndSwap(f, nil)
+	})
+}
+
+// Each calls fn for every key of the snapshot, with its deadline in unix
+// milliseconds or 0 when it has none, stopping at the first error.
+func (snap *Snapshot) Each(fn func(key string, obj *RedisObject, expireAt int64) error) error {
+	for _, shard := range snap.shards {
+		for key, obj := range shard.store {
+			if err := fn(key, obj, shard.expires[key]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Len returns the number of keys in the snapshot.
+func (snap *Snapshot) Len() int {
+	n := 0
+	for _, shard := range snap.shards {
+		n += len(shard.store)
+	}
+	return n
+}
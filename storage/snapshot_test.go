@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/devkarim/goredis/eviction"
+)
+
+func TestFreeze_IgnoresLaterWrites(t *testing.T) {
+	Setup(eviction.PolicyLRU, 1<<30)
+	keys := make([]string, 100000)
+	var written []string // keys of the shard copied last
+	for i := range keys {
+		keys[i] = "key:" + strconv.Itoa(i)
+		GetShard(keys[i]).SetString(keys[i], "before")
+		if GetShard(keys[i]).Id == ShardCount-1 && len(written) < 100 {
+			written = append(written, keys[i])
+		}
+	}
+
+	// the writers wait for the shards to be released, then race with the
+	// copy of the snapshot
+	var wg sync.WaitGroup
+	snap := Freeze(func() {
+		for _, key := range written {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release := Acquire([]string{key}, false, false)
+				defer release()
+				BeforeWrite([]string{key}, false)
+				GetShard(key).SetString(key, "after")
+			}()
+		}
+	})
+	wg.Wait()
+
+	if snap.Len() != len(keys) {
+		t.Fatalf("snapshot holds %d keys; want %d", snap.Len(), len(keys))
+	}
+	snap.Each(func(key string, obj *RedisObject, expireAt int64) error {
+		if obj.Str != "before" {
+			t.Errorf("%s = %q in the snapshot; want the value at Freeze", key, obj.Str)
+		}
+		return nil
+	})
+	for _, key := range written {
+		if v, _, _ := GetShard(key).GetString(key); v != "after" {
+			t.Fatalf("%s = %q; want the later write", key, v)
+		}
+	}
+}
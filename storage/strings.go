@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNotInteger = errors.New("ERR value is not an integer or out of range")
+	ErrNotFloat   = errors.New("ERR value is not a valid float")
+	ErrOverflow   = errors.New("ERR increment or decrement would overflow")
+	ErrNaNOrInf   = errors.New("ERR increment would produce NaN or Infinity")
+)
+
+func newStringObject() *RedisObject {
+	return &RedisObject{Type: RedisObjectString}
+}
+
+// parseInt parses str the way Redis does: no sign other than '-', no leading
+// zeros and no surrounding spaces.
+func parseInt(str string) (int64, bool) {
+	if str == "" || str[0] == '+' || (len(str) > 1 && str[0] == '0') || strings.HasPrefix(str, "-0") {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(str, 10, 64)
+	return n, err == nil
+}
+
+func parseFloat(str string) (float64, bool) {
+	f, err := strconv.ParseFloat(str, 64)
+	return f, err == nil && !math.IsNaN(f)
+}
+
+// formatFloat renders the result of INCRBYFLOAT, without exponent like Redis.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func addInt(n, delta int64) (int64, error) {
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, ErrOverflow
+	}
+	return n + delta, nil
+}
+
+func addFloat(f, delta float64) (float64, error) {
+	sum := f + delta
+	if math.IsNaN(sum) || math.IsInf(sum, 0) {
+		return 0, ErrNaNOrInf
+	}
+	return sum, nil
+}
+
+// updateString replaces the string at key, or the empty string when missing,
+// with the result of update. The deadline of the key is kept.
+func (s *Shard) updateString(key string, update func(old string, found bool) (string, error)) (string, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	obj, ok, err := s.lookupType(key, RedisObjectString)
+	if err != nil {
+		return "", err
+	}
+
+	old := ""
+	if ok {
+		old = obj.Str
+	}
+	val, err := update(old, ok)
+	if err != nil {
+		return "", err
+	}
+
+	obj, err = s.prepareWrite(key, RedisObjectString, len(val)-len(old), newStringObject)
+	if err != nil {
+		return "", err
+	}
+	s.CurrentMemory += len(val) - len(obj.Str)
+	obj.Str = val
+
+	return val, nil
+}
+
+// IncrBy adds delta to the integer stored at key, which counts as 0 when missing.
+func (s *Shard) IncrBy(key string, delta int64) (int64, error) {
+	var result int64
+	_, err := s.updateString(key, func(old string, found bool) (string, error) {
+		n := int64(0)
+		if found {
+			var ok bool
+			if n, ok = parseInt(old); !ok {
+				return "", ErrNotInteger
+			}
+		}
+
+		var err error
+		result, err = addInt(n, delta)
+		return strconv.FormatInt(result, 10), err
+	})
+
+	return result, err
+}
+
+// IncrByFloat adds delta to the number stored at key, which counts as 0 when
+// missing, and returns the new value as stored.
+func (s *Shard) IncrByFloat(key string, delta float64) (string, error) {
+	return s.updateString(key, func(old string, found bool) (string, error) {
+		f := 0.0
+		if found {
+			var ok bool
+			if f, ok = parseFloat(old); !ok {
+				return "", ErrNotFloat
+			}
+		}
+
+		sum, err := addFloat(f, delta)
+		return formatFloat(sum), err
+	})
+}
+
+// MaxStringSize is the largest string SETRANGE and APPEND may create, the
+// proto-max-bulk-len a client could have sent it with.
+var MaxStringSize = 512 * 1024 * 1024
+
+var ErrStringTooLong = errors.New("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+
+// Append adds val at the end of the string at key and returns its new length.
+func (s *Shard) Append(key, val string) (int, error) {
+	str, err := s.updateString(key, func(old string, found bool) (string, error) {
+		if len(old)+len(val) > MaxStringSize {
+			return "", ErrStringTooLong
+		}
+		return old + val, nil
+	})
+
+	return len(str), err
+}
+
+func (s *Shard) StrLen(key string) (int, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectString)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return len(obj.Str), nil
+}
+
+// GetRange returns the substring between the start and end offsets, both
+// inclusive, where negative offsets count from the end of the string.
+func (s *Shard) GetRange(key string, start, end int) (string, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectString)
+	if err != nil || !ok {
+		return "", err
+	}
+
+	n := len(obj.Str)
+	if start < 0 && end < 0 && start > end {
+		return "", nil
+	}
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if end < 0 {
+		end = max(n+end, 0)
+	}
+	end = min(end, n-1)
+	if start > end || n == 0 {
+		return "", nil
+	}
+
+	return obj.Str[start : end+1], nil
+}
+
+// SetRange overwrites the string at key from offset on, padding it with zero
+// bytes when it is shorter, and returns its new length.
+func (s *Shard) SetRange(key string, offset int, val string) (int, error) {
+	if offset+len(val) > MaxStringSize {
+		return 0, ErrStringTooLong
+	}
+
+	if val == "" {
+		// nothing is written, and a missing key is not created
+		return s.StrLen(key)
+	}
+
+	str, err := s.updateString(key, func(old string, found bool) (string, error) {
+		buf := []byte(old)
+		if len(buf) < offset+len(val) {
+			buf = append(buf, make([]byte, offset+len(val)-len(buf))...)
+		}
+		copy(buf[offset:], val)
+		return string(buf), nil
+	})
+
+	return len(str), err
+}
+
+// GetDel returns the string at key and deletes the key.
+func (s *Shard) GetDel(key string) (string, bool, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	obj, ok, err := s.lookupType(key, RedisObjectString)
+	if err != nil || !ok {
+		return "", false, err
+	}
+
+	s.remove(key)
+	return obj.Str, true, nil
+}
+
+// GetEx returns the string at key and sets its deadline to expireAt, or
+// removes it when persist is set. Neither changes the deadline when zero.
+func (s *Shard) GetEx(key string, expireAt int64, persist bool) (string, bool, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	obj, ok, err := s.lookupType(key, RedisObjectString)
+	if err != nil || !ok {
+		return "", false, err
+	}
+
+	switch {
+	case expireAt > 0:
+		s.Expires[key] = expireAt
+		s.expireIfNeeded(key)
+	case persist:
+		delete(s.Expires, key)
+	}
+
+	return obj.Str, true, nil
+}
+
+// MGet returns the strings at keys, along with whether each one exists. Keys
+// holding another type count as missing. Each shard is read-locked once for
+// all of its keys.
+func MGet(keys []string) ([]string, []bool) {
+	vals := make([]string, len(keys))
+	found := make([]bool, len(keys))
+
+	byShard := map[*Shard][]int{}
+	for i, key := range keys {
+		shard := GetShard(key)
+		byShard[shard] = append(byShard[shard], i)
+	}
+
+	for shard, indexes := range byShard {
+		shard.Mu.RLock()
+		for _, i := range indexes {
+			obj, ok := shard.lookup(keys[i])
+			if ok && obj.Type == RedisObjectString {
+				vals[i], found[i] = obj.Str, true
+				shard.Policy.Access(keys[i])
+			}
+		}
+		shard.Mu.RUnlock()
+	}
+
+	return vals, found
+}
+
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// MSet stores every key/value pair atomically, holding all their shards.
+// With nx nothing is written if any of the keys already exists.
+func MSet(pairs []KeyValue, nx bool) (bool, error) {
+	keys := make([]string, len(pairs))
+	for i, pair := range pairs {
+		keys[i] = pair.Key
+	}
+
+	unlock := lockShards(keys...)
+	defer unlock()
+
+	for _, key := range keys {
+		shard := GetShard(key)
+		shard.expireIfNeeded(key)
+		obj, ok := shard.Store[key]
+		if ok && nx {
+			return false, nil
+		}
+		if ok && obj.Type != RedisObjectString {
+			return false, ErrWrongType
+		}
+	}
+
+	for _, pair := range pairs {
+		if _, err := GetShard(pair.Key).set(pair.Key, pair.Value, SetOptions{}); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
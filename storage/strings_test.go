@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/devkarim/goredis/eviction"
+)
+
+func TestIncrBy(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 100)
+
+	if n, err := shard.IncrBy("a", 5); n != 5 || err != nil {
+		t.Errorf("IncrBy on a missing key = %d, %v; want 5, nil", n, err)
+	}
+	if n, err := shard.IncrBy("a", -15); n != -10 || err != nil {
+		t.Errorf("IncrBy = %d, %v; want -10, nil", n, err)
+	}
+	if shard.CurrentMemory != len("-10") {
+		t.Errorf("CurrentMemory = %d; want %d", shard.CurrentMemory, len("-10"))
+	}
+
+	shard.SetString("max", strconv.FormatInt(math.MaxInt64, 10))
+	if _, err := shard.IncrBy("max", 1); err != ErrOverflow {
+		t.Errorf("IncrBy past MaxInt64 = %v; want %v", err, ErrOverflow)
+	}
+
+	for _, val := range []string{"abc", "01", "+1", " 1", "-0", ""} {
+		shard.SetString("bad", val)
+		if _, err := shard.IncrBy("bad", 1); err != ErrNotInteger {
+			t.Errorf("IncrBy on %q = %v; want %v", val, err, ErrNotInteger)
+		}
+	}
+}
+
+func TestIncrByFloat(t *testing.T) {
+	withClock(t, 1000)
+	shard := NewShard(0, eviction.NewLRU(), 100)
+
+	shard.SetString("a", "10.5")
+	shard.ExpireAt("a", 5000, ExpireAlways)
+
+	if val, err := shard.IncrByFloat("a", 0.1); val != "10.6" || err != nil {
+		t.Errorf("IncrByFloat = %q, %v; want 10.6, nil", val, err)
+	}
+	if got := shard.TTL("a"); got != 4000 {
+		t.Errorf("TTL = %d; want the deadline to be kept", got)
+	}
+	if _, err := shard.IncrByFloat("a", math.Inf(1)); err != ErrNaNOrInf {
+		t.Errorf("IncrByFloat by +inf = %v; want %v", err, ErrNaNOrInf)
+	}
+}
+
+func TestHIncrBy_MemoryAccounting(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 100)
+
+	shard.HIncrBy("h", "n", 5)
+	shard.HIncrBy("h", "n", 5)
+	if shard.CurrentMemory != len("n")+len("10") {
+		t.Errorf("CurrentMemory = %d; want %d", shard.CurrentMemory, len("n")+len("10"))
+	}
+
+	shard.HSet("h", []HashField{{Field: "s", Value: "x"}})
+	if _, err := shard.HIncrBy("h", "s", 1); err != ErrHashNotInteger {
+		t.Errorf("HIncrBy on a non integer field = %v; want %v", err, ErrHashNotInteger)
+	}
+}
+
+func TestGetRange(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 100)
+	shard.SetString("a", "Hello World")
+
+	cases := []struct {
+		start, end int
+		want       string
+	}{
+		{0, 4, "Hello"},
+		{-5, -1, "World"},
+		{-100, 2, "Hel"},
+		{6, 100, "World"},
+		{5, 2, ""},
+		{-1, -5, ""},
+	}
+
+	for _, c := range cases {
+		if got, _ := shard.GetRange("a", c.start, c.end); got != c.want {
+			t.Errorf("GetRange(%d, %d) = %q; want %q", c.start, c.end, got, c.want)
+		}
+	}
+}
+
+func TestSetRange_PadsAndAccountsMemory(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 100)
+
+	if n, _ := shard.SetRange("a", 3, "xy"); n != 5 {
+		t.Errorf("SetRange = %d; want 5", n)
+	}
+	if val, _, _ := shard.GetString("a"); val != "\x00\x00\x00xy" {
+		t.Errorf("value = %q; want zero padding", val)
+	}
+	if shard.CurrentMemory != 5 {
+		t.Errorf("CurrentMemory = %d; want 5", shard.CurrentMemory)
+	}
+
+	if n, _ := shard.SetRange("missing", 10, ""); n != 0 {
+		t.Errorf("SetRange with an empty value = %d; want 0", n)
+	}
+	if _, ok := shard.Store["missing"]; ok {
+		t.Errorf("SetRange with an empty value should not create the key")
+	}
+}
+
+func TestMSet_AllOrNothing(t *testing.T) {
+	Setup(eviction.PolicyLRU, 1000)
+	a := "a"
+	b := keyOnOtherShard(a)
+
+	GetShard(b).SetString(b, "old")
+
+	if ok, _ := MSet([]KeyValue{{a, "1"}, {b, "2"}}, true); ok {
+		t.Errorf("MSET NX should fail when a key exists")
+	}
+	if _, found := MGet([]string{a}); found[0] {
+		t.Errorf("a failed MSET NX should not write any key")
+	}
+
+	GetShard(b+"list").ListPush(b+"list", []string{"x"}, false, false)
+	if _, err := MSet([]KeyValue{{a, "1"}, {b + "list", "2"}}, false); err != ErrWrongType {
+		t.Errorf("MSET over a list = %v; want %v", err, ErrWrongType)
+	}
+	if _, found := MGet([]string{a}); found[0] {
+		t.Errorf("a failed MSET should not write any key")
+	}
+
+	MSet([]KeyValue{{a, "1"}, {b, "2"}}, false)
+	vals, found := MGet([]string{a, b, "missing"})
+	if !slices.Equal(vals, []string{"1", "2", ""}) || !slices.Equal(found, []bool{true, true, false}) {
+		t.Errorf("MGet = %v, %v", vals, found)
+	}
+}
@@ -0,0 +1,101 @@
+package storage
+
+import "slices"
+
+// shardsOf returns the distinct shards owning keys in ascending id order.
+func shardsOf(keys []string) []*Shard {
+	owners := make([]*Shard, 0, len(keys))
+	for _, key := range keys {
+		shard := GetShard(key)
+		if !slices.Contains(owners, shard) {
+			owners = append(owners, shard)
+		}
+	}
+	slices.SortFunc(owners, func(a, b *Shard) int { return a.Id - b.Id })
+
+	return owners
+}
+
+// Acquire holds the gates of the shards owning keys, or of every shard when
+// all is set, until the returned func is called. Single commands acquire
+// them shared while EXEC acquires them exclusively, which keeps other
+// clients out of the shards of a transaction while it runs. Gates are taken
+// in ascending shard id order, so concurrent callers can never deadlock.
+func Acquire(keys []string, all bool, exclusive bool) func() {
+	owners := shards
+	if !all {
+		owners = shardsOf(keys)
+	}
+
+	for _, shard := range owners {
+		if exclusive {
+			shard.gate.Lock()
+		} else {
+			shard.gate.RLock()
+		}
+	}
+
+	return func() {
+		for i := len(owners) - 1; i >= 0; i-- {
+			if exclusive {
+				owners[i].gate.Unlock()
+			} else {
+				owners[i].gate.RUnlock()
+			}
+		}
+	}
+}
+
+// Watch starts tracking modifications of key and returns its current version.
+// Versions are only kept while at least one client watches the key.
+func Watch(key string) uint64 {
+	s := GetShard(key)
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	if s.watchers == nil {
+		s.watchers = map[string]int{}
+		s.versions = map[string]uint64{}
+	}
+	s.watchers[key]++
+
+	return s.versions[key]
+}
+
+func Unwatch(key string) {
+	s := GetShard(key)
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.watchers[key]--
+	if s.watchers[key] <= 0 {
+		delete(s.watchers, key)
+		delete(s.versions, key)
+	}
+}
+
+// Version returns the version of a watched key.
+func Version(key string) uint64 {
+	s := GetShard(key)
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	return s.versions[key]
+}
+
+// Touch marks keys as modified, invalidating the transactions watching them.
+func Touch(keys ...string) {
+	for _, key := range keys {
+		s := GetShard(key)
+		s.Mu.Lock()
+		s.touch(key)
+		s.Mu.Unlock()
+	}
+}
+
+// touch must be called with the write lock held.
+func (s *Shard) touch(key string) {
+	if _, ok := s.watchers[key]; ok {
+		s.versions[key]++
+	}
+}
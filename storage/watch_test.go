@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/devkarim/goredis/eviction"
+)
+
+func TestWatch_VersionChanges(t *testing.T) {
+	clock := withClock(t, 1000)
+	Setup(eviction.PolicyLRU, 1000)
+	shard := GetShard("a")
+
+	shard.SetString("a", "1")
+	version := Watch("a")
+
+	if got := Version("a"); got != version {
+		t.Errorf("Version = %d; want %d before any change", got, version)
+	}
+
+	Touch("a")
+	if Version("a") == version {
+		t.Errorf("Version should change after Touch")
+	}
+
+	version = Version("a")
+	shard.ExpireAt("a", 2000, ExpireAlways)
+	*clock = 2000
+	if Version("a") == version {
+		t.Errorf("Version should change when the key expires")
+	}
+
+	Unwatch("a")
+	if _, ok := shard.versions["a"]; ok {
+		t.Errorf("version of 'a' should be dropped once nobody watches it")
+	}
+}
+
+func TestWatch_EvictionChangesVersion(t *testing.T) {
+	Setup(eviction.PolicyFIFO, 10)
+	shard := GetShard("a")
+
+	// find a second key on the same shard to push 'a' out
+	b := "b"
+	for i := 0; GetShard(b) != shard; i++ {
+		b = "b" + string(rune('0'+i))
+	}
+
+	shard.SetString("a", "12345")
+	version := Watch("a")
+	defer Unwatch("a")
+
+	shard.SetString(b, "678901")
+
+	if Version("a") == version {
+		t.Errorf("Version should change when the key is evicted")
+	}
+}
@@ -0,0 +1,383 @@
+package storage
+
+import (
+	"errors"
+	"math"
+)
+
+var ErrScoreNaN = errors.New("ERR resulting score is not a number (NaN)")
+
+// zsetEntryOverhead accounts for the score held both in the dict and in the
+// skiplist node of every member.
+const zsetEntryOverhead = 16
+
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// ZSet pairs a member -> score dict for O(1) score lookups with a skiplist
+// ordered by score for O(log n) rank and range queries.
+type ZSet struct {
+	dict  map[string]float64
+	zsl   *skiplist
+	bytes int
+}
+
+func NewZSet() *ZSet {
+	return &ZSet{dict: map[string]float64{}, zsl: newSkiplist()}
+}
+
+func zsetEntrySize(member string) int {
+	// the member is referenced by both the dict and the skiplist
+	return 2*len(member) + zsetEntryOverhead
+}
+
+func (z *ZSet) Len() int {
+	return len(z.dict)
+}
+
+func (z *ZSet) Bytes() int {
+	return z.bytes
+}
+
+func (z *ZSet) Score(member string) (float64, bool) {
+	score, ok := z.dict[member]
+	return score, ok
+}
+
+// Add inserts member or moves it to its new score, reporting whether it is new.
+func (z *ZSet) Add(member string, score float64) bool {
+	current, ok := z.dict[member]
+	if ok {
+		if current != score {
+			z.zsl.delete(current, member)
+			z.zsl.insert(score, member)
+			z.dict[member] = score
+		}
+		return false
+	}
+
+	z.zsl.insert(score, member)
+	z.dict[member] = score
+	z.bytes += zsetEntrySize(member)
+	return true
+}
+
+func (z *ZSet) Remove(member string) bool {
+	score, ok := z.dict[member]
+	if !ok {
+		return false
+	}
+
+	z.zsl.delete(score, member)
+	delete(z.dict, member)
+	z.bytes -= zsetEntrySize(member)
+	return true
+}
+
+// Rank returns the 0-based position of member, counted from the highest
+// score when reverse is set.
+func (z *ZSet) Rank(member string, reverse bool) (int, bool) {
+	score, ok := z.dict[member]
+	if !ok {
+		return 0, false
+	}
+
+	rank := z.zsl.rank(score, member)
+	if reverse {
+		return z.Len() - rank, true
+	}
+	return rank - 1, true
+}
+
+// Range returns the members in the clamped [start, stop] rank range.
+func (z *ZSet) Range(start, stop int, reverse bool) []ZMember {
+	arr := make([]ZMember, 0, stop-start+1)
+
+	var x *skiplistNode
+	if reverse {
+		x = z.zsl.byRank(z.Len() - start)
+	} else {
+		x = z.zsl.byRank(start + 1)
+	}
+
+	for i := start; i <= stop && x != nil; i++ {
+		arr = append(arr, ZMember{Member: x.member, Score: x.score})
+		if reverse {
+			x = x.backward
+		} else {
+			x = x.level[0].forward
+		}
+	}
+
+	return arr
+}
+
+// Clone returns an independent copy of the sorted set.
+func (z *ZSet) Clone() *ZSet {
+	clone := NewZSet()
+	for member, score := range z.dict {
+		clone.Add(member, score)
+	}
+	return clone
+}
+
+// RangeByScore returns the members within r, skipping offset of them and
+// returning at most count when count is not negative.
+func (z *ZSet) RangeByScore(r ScoreRange, reverse bool, offset, count int) []ZMember {
+	arr := []ZMember{}
+
+	var x *skiplistNode
+	if reverse {
+		x = z.zsl.lastInRange(r)
+	} else {
+		x = z.zsl.firstInRange(r)
+	}
+
+	for x != nil && count != 0 {
+		if reverse && !r.gteMin(x.score) || !reverse && !r.lteMax(x.score) {
+			break
+		}
+
+		if offset > 0 {
+			offset--
+		} else {
+			arr = append(arr, ZMember{Member: x.member, Score: x.score})
+			count--
+		}
+
+		if reverse {
+			x = x.backward
+		} else {
+			x = x.level[0].forward
+		}
+	}
+
+	return arr
+}
+
+// Count returns the number of members within r using two rank lookups.
+func (z *ZSet) Count(r ScoreRange) int {
+	first := z.zsl.firstInRange(r)
+	if first == nil {
+		return 0
+	}
+	last := z.zsl.lastInRange(r)
+
+	return z.zsl.rank(last.score, last.member) - z.zsl.rank(first.score, first.member) + 1
+}
+
+func newZSetObject() *RedisObject {
+	return &RedisObject{Type: RedisObjectZSet, ZSet: NewZSet()}
+}
+
+type ZAddOptions struct {
+	Condition SetCondition // SetNX only adds new members, SetXX only updates existing ones
+	GT        bool         // only update when the new score is greater
+	LT        bool         // only update when the new score is lower
+	Incr      bool         // increment the score of the single member instead
+}
+
+type ZAddResult struct {
+	Added   int
+	Updated int
+	Score   float64 // resulting score in Incr mode
+	Applied bool    // false when Incr mode was aborted by the options
+}
+
+func (s *Shard) ZAdd(key string, opts ZAddOptions, members []ZMember) (ZAddResult, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	neededSize := 0
+	for _, m := range members {
+		neededSize += zsetEntrySize(m.Member)
+	}
+
+	s.expireIfNeeded(key)
+	if opts.Condition == SetXX {
+		if _, ok, err := s.lookupType(key, RedisObjectZSet); err != nil || !ok {
+			return ZAddResult{}, err
+		}
+	}
+
+	obj, err := s.prepareWrite(key, RedisObjectZSet, neededSize, newZSetObject)
+	if err != nil {
+		return ZAddResult{}, err
+	}
+
+	var result ZAddResult
+	before := obj.ZSet.Bytes()
+
+	for _, m := range members {
+		score := m.Score
+		current, exists := obj.ZSet.Score(m.Member)
+
+		if (opts.Condition == SetNX && exists) || (opts.Condition == SetXX && !exists) {
+			continue
+		}
+
+		if exists {
+			if opts.Incr {
+				score += current
+				if math.IsNaN(score) {
+					err = ErrScoreNaN
+					break
+				}
+			}
+			if (opts.GT && score <= current) || (opts.LT && score >= current) {
+				continue
+			}
+			if score != current {
+				result.Updated++
+			}
+		} else {
+			result.Added++
+		}
+
+		obj.ZSet.Add(m.Member, score)
+		result.Score = score
+		result.Applied = true
+	}
+
+	s.CurrentMemory += obj.ZSet.Bytes() - before
+	if obj.ZSet.Len() == 0 {
+		s.remove(key)
+	}
+
+	return result, err
+}
+
+func (s *Shard) ZRem(key string, members []string) (int, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	obj, ok, err := s.lookupType(key, RedisObjectZSet)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	before := obj.ZSet.Bytes()
+	removed := 0
+	for _, member := range members {
+		if obj.ZSet.Remove(member) {
+			removed++
+		}
+	}
+	s.CurrentMemory -= before - obj.ZSet.Bytes()
+
+	if obj.ZSet.Len() == 0 {
+		s.remove(key)
+	}
+
+	return removed, nil
+}
+
+func (s *Shard) ZScore(key, member string) (float64, bool, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectZSet)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+
+	score, ok := obj.ZSet.Score(member)
+	return score, ok, nil
+}
+
+func (s *Shard) ZCard(key string) (int, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectZSet)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	return obj.ZSet.Len(), nil
+}
+
+func (s *Shard) ZRank(key, member string, reverse bool) (int, bool, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectZSet)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+
+	rank, ok := obj.ZSet.Rank(member, reverse)
+	return rank, ok, nil
+}
+
+func (s *Shard) ZRange(key string, start, stop int, reverse bool) ([]ZMember, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectZSet)
+	if err != nil || !ok {
+		return []ZMember{}, err
+	}
+
+	start, stop, ok = normalizeRange(start, stop, obj.ZSet.Len())
+	if !ok {
+		return []ZMember{}, nil
+	}
+
+	return obj.ZSet.Range(start, stop, reverse), nil
+}
+
+func (s *Shard) ZRangeByScore(key string, r ScoreRange, reverse bool, offset, count int) ([]ZMember, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectZSet)
+	if err != nil || !ok {
+		return []ZMember{}, err
+	}
+
+	return obj.ZSet.RangeByScore(r, reverse, offset, count), nil
+}
+
+func (s *Shard) ZCount(key string, r ScoreRange) (int, error) {
+	s.rlockKey(key)
+	defer s.Mu.RUnlock()
+
+	obj, ok, err := s.lookupType(key, RedisObjectZSet)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	return obj.ZSet.Count(r), nil
+}
+
+// ZPop removes and returns up to count members with the lowest scores, or
+// the highest ones when max is set.
+func (s *Shard) ZPop(key string, count int, max bool) ([]ZMember, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.expireIfNeeded(key)
+	obj, ok, err := s.lookupType(key, RedisObjectZSet)
+	if err != nil || !ok {
+		return []ZMember{}, err
+	}
+
+	stop := min(count, obj.ZSet.Len()) - 1
+	popped := obj.ZSet.Range(0, stop, max)
+
+	before := obj.ZSet.Bytes()
+	for _, m := range popped {
+		obj.ZSet.Remove(m.Member)
+	}
+	s.CurrentMemory -= before - obj.ZSet.Bytes()
+
+	if obj.ZSet.Len() == 0 {
+		s.remove(key)
+	}
+
+	return popped, nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/devkarim/goredis/eviction"
+)
+
+func TestZSet_RankMatchesOrder(t *testing.T) {
+	z := NewZSet()
+	for i := range 500 {
+		z.Add(fmt.Sprintf("m%d", i), float64(rand.IntN(50)))
+	}
+	for i := range 200 {
+		z.Remove(fmt.Sprintf("m%d", i*2))
+	}
+
+	members := z.Range(0, z.Len()-1, false)
+	if len(members) != 300 {
+		t.Fatalf("Range returned %d members; want 300", len(members))
+	}
+
+	sorted := slices.IsSortedFunc(members, func(a, b ZMember) int {
+		return cmp.Or(cmp.Compare(a.Score, b.Score), cmp.Compare(a.Member, b.Member))
+	})
+	if !sorted {
+		t.Errorf("members are not ordered by (score, member)")
+	}
+
+	for i, m := range members {
+		if rank, _ := z.Rank(m.Member, false); rank != i {
+			t.Fatalf("Rank(%s) = %d; want %d", m.Member, rank, i)
+		}
+		if rank, _ := z.Rank(m.Member, true); rank != len(members)-1-i {
+			t.Fatalf("reverse Rank(%s) = %d; want %d", m.Member, rank, len(members)-1-i)
+		}
+	}
+}
+
+func TestZSet_ScoreRange(t *testing.T) {
+	z := NewZSet()
+	for i := 1; i <= 10; i++ {
+		z.Add(fmt.Sprintf("m%02d", i), float64(i))
+	}
+
+	r := ScoreRange{Min: 3, Max: 7, MinEx: true}
+	if got := z.Count(r); got != 4 {
+		t.Errorf("Count = %d; want 4", got)
+	}
+
+	got := z.RangeByScore(r, true, 1, 2)
+	if len(got) != 2 || got[0].Member != "m06" || got[1].Member != "m05" {
+		t.Errorf("RangeByScore = %v; want [m06 m05]", got)
+	}
+
+	if got := z.Count(ScoreRange{Min: 11, Max: 20}); got != 0 {
+		t.Errorf("Count = %d; want 0", got)
+	}
+}
+
+func TestZSet_MemoryAccounting(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 1000)
+
+	shard.ZAdd("z", ZAddOptions{}, []ZMember{{Member: "ab", Score: 1}, {Member: "c", Score: 2}})
+	want := zsetEntrySize("ab") + zsetEntrySize("c")
+	if shard.CurrentMemory != want {
+		t.Errorf("CurrentMemory = %d; want %d", shard.CurrentMemory, want)
+	}
+
+	shard.ZAdd("z", ZAddOptions{Incr: true}, []ZMember{{Member: "ab", Score: 5}})
+	if shard.CurrentMemory != want {
+		t.Errorf("CurrentMemory = %d after update; want %d", shard.CurrentMemory, want)
+	}
+
+	shard.ZPop("z", 5, false)
+	if shard.CurrentMemory != 0 {
+		t.Errorf("CurrentMemory = %d; want 0", shard.CurrentMemory)
+	}
+	if _, ok := shard.Store["z"]; ok {
+		t.Errorf("empty sorted set should have been deleted")
+	}
+}
+
+func TestZSet_AddOptions(t *testing.T) {
+	shard := NewShard(0, eviction.NewLRU(), 1000)
+	shard.ZAdd("z", ZAddOptions{}, []ZMember{{Member: "a", Score: 10}})
+
+	res, _ := shard.ZAdd("z", ZAddOptions{GT: true}, []ZMember{{Member: "a", Score: 5}, {Member: "b", Score: 1}})
+	if res.Added != 1 || res.Updated != 0 {
+		t.Errorf("GT result = %+v; want 1 added, 0 updated", res)
+	}
+
+	res, _ = shard.ZAdd("z", ZAddOptions{Condition: SetXX}, []ZMember{{Member: "a", Score: 20}, {Member: "c", Score: 1}})
+	if res.Added != 0 || res.Updated != 1 {
+		t.Errorf("XX result = %+v; want 0 added, 1 updated", res)
+	}
+
+	if score, _, _ := shard.ZScore("z", "a"); score != 20 {
+		t.Errorf("ZScore = %v; want 20", score)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/devkarim/goredis/commands"
+	"github.com/devkarim/goredis/resp"
+	"github.com/devkarim/goredis/storage"
+)
+
+// transactionCommands run right away instead of being queued inside MULTI.
+var transactionCommands = map[string]bool{
+	"MULTI":   true,
+	"EXEC":    true,
+	"DISCARD": true,
+	"WATCH":   true,
+	"QUIT":    true,
+}
+
+// queue adds a command to the transaction of c. Commands that cannot be
+// queued make the following EXEC abort.
+func (s *Server) queue(c *client, cmd string, message resp.Value) {
+	cmdUpper := strings.ToUpper(cmd)
+
+	// UNWATCH is queued like in Redis but has no effect when it runs, EXEC
+	// forgets the watched keys anyway
+	if cmdUpper == "UNWATCH" {
+		c.queued = append(c.queued, message)
+		c.Send(resp.Value{Type: resp.RespString, Str: "QUEUED"})
+		return
+	}
+	if _, ok := clientHandlers[cmdUpper]; ok && cmdUpper != "PING" {
+		c.multiErr = true
+		c.Send(resp.Value{Type: resp.RespError, Str: "ERR Command not allowed inside a transaction"})
+		return
+	}
+	command, ok := commands.Registry[cmdUpper]
+	if !ok {
+		c.multiErr = true
+		c.Send(resp.Value{Type: resp.RespError, Str: "ERR unknown command '" + cmd + "'"})
+		return
+	}
+	if !command.ValidArity(len(message.Array)) {
+		c.multiErr = true
+		wrongArgs(c, strings.ToLower(cmd))
+		return
+	}
+
+	c.queued = append(c.queued, message)
+	c.Send(resp.Value{Type: resp.RespString, Str: "QUEUED"})
+}
+
+// resetTransaction leaves MULTI and forgets every watched key.
+func (c *client) resetTransaction() {
+	c.multi = false
+	c.multiErr = false
+	c.queued = nil
+	c.unwatchAll()
+}
+
+func (c *client) unwatchAll() {
+	for key := range c.watched {
+		storage.Unwatch(key)
+	}
+	c.watched = nil
+}
+
+func multi(s *Server, c *client, args []resp.Value) {
+	if c.multi {
+		c.Send(resp.Value{Type: resp.RespError, Str: "ERR MULTI calls can not be nested"})
+		return
+	}
+
+	c.multi = true
+	c.Send(resp.Value{Type: resp.RespString, Str: "OK"})
+}
+
+func discard(s *Server, c *client, args []resp.Value) {
+	if !c.multi {
+		c.Send(resp.Value{Type: resp.RespError, Str: "ERR DISCARD without MULTI"})
+		return
+	}
+
+	c.resetTransaction()
+	c.Send(resp.Value{Type: resp.RespString, Str: "OK"})
+}
+
+// exec applies the queued commands while holding every shard they touch
+// exclusively, so no other client can observe or interleave with a partial
+// transaction. The transaction is aborted when a watched key changed.
+func exec(s *Server, c *client, args []resp.Value) {
+	if !c.multi {
+		c.Send(resp.Value{Type: resp.RespError, Str: "ERR EXEC without MULTI"})
+		return
+	}
+	defer c.resetTransaction()
+
+	if c.multiErr {
+		c.Send(resp.Value{Type: resp.RespError, Str: "EXECABORT Transaction discarded because of previous errors."})
+		return
+	}
+
+	keys := make([]string, 0, len(c.watched))
+	for key := range c.watched {
+		keys = append(keys, key)
+	}
+	all, writes := false, false
+	for _, message := range c.queued {
+		command := commands.Registry[strings.ToUpper(message.Array[0].Str)]
+		keys = append(keys, commandKeys(command, message.Array[1:])...)
+		all = all || command.AllShards
+		writes = writes || command.IsWrite
+	}
+
+	if writes {
+		if err := s.aof.Err(); err != nil {
+			c.Send(misconf(err))
+			return
+		}
+	}
+
+	reply, wrote := s.execQueued(c, keys, all, writes)
+	if wrote {
+		if err := s.aof.Commit(); err != nil {
+			reply = misconf(err)
+		}
+	}
+	c.Send(reply)
+}
+
+// execQueued runs the transaction of c while holding its shards and logs its
+// writes, reporting whether there were any to commit.
+func (s *Server) execQueued(c *client, keys []string, all, writes bool) (resp.Value, bool) {
+	release := storage.Acquire(keys, all, true)
+	defer release()
+	if writes {
+		storage.BeforeWrite(keys, all)
+	}
+
+	for key, version := range c.watched {
+		if storage.Version(key) != version {
+			return resp.Value{Type: resp.RespNil, NullArray: true}, false
+		}
+	}
+
+	responses := make([]resp.Value, len(c.queued))
+	var propagated []resp.Value
+	changes := 0
+
+	for i, message := range c.queued {
+		cmdUpper := strings.ToUpper(message.Array[0].Str)
+		if cmdUpper == "UNWATCH" {
+			responses[i] = resp.Value{Type: resp.RespString, Str: "OK"}
+			continue
+		}
+		command := commands.Registry[cmdUpper]
+		args := message.Array[1:]
+
+		var values []resp.Value
+		responses[i], values = s.run(command, message)
+		if command.IsWrite && responses[i].Type != resp.RespError {
+			storage.Touch(commandKeys(command, args)...)
+			propagated = append(propagated, values...)
+			changes++
+		}
+	}
+
+	if len(propagated) > 0 {
+		block := append([]resp.Value{commands.NewCommand("MULTI")}, propagated...)
+		block = append(block, commands.NewCommand("EXEC"))
+		s.aof.Write(block...)
+	}
+	s.rdb.Changed(changes)
+
+	return resp.Value{Type: resp.RespArray, Array: responses}, len(propagated) > 0
+}
+
+func watch(s *Server, c *client, args []resp.Value) {
+	if c.multi {
+		c.Send(resp.Value{Type: resp.RespError, Str: "ERR WATCH inside MULTI is not allowed"})
+		return
+	}
+	if len(args) < 1 {
+		wrongArgs(c, "watch")
+		return
+	}
+
+	if c.watched == nil {
+		c.watched = map[string]uint64{}
+	}
+	for _, arg := range args {
+		if _, ok := c.watched[arg.Str]; !ok {
+			c.watched[arg.Str] = storage.Watch(arg.Str)
+		}
+	}
+
+	c.Send(resp.Value{Type: resp.RespString, Str: "OK"})
+}
+
+func unwatch(s *Server, c *client, args []resp.Value) {
+	c.unwatchAll()
+	c.Send(resp.Value{Type: resp.RespString, Str: "OK"})
+}